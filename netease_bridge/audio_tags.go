@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// audioTags 写入下载文件的标签
+type audioTags struct {
+	Title     string
+	Artists   []string
+	Album     string
+	TrackNo   int    // 0 表示未知
+	DiscNo    string // 例如 "1" 或 "1/2"，空字符串表示未知
+	Cover     []byte // 封面图片，nil 表示没有
+	CoverMime string // image/jpeg, image/png
+}
+
+// FLAC 元数据块大小字段只有 24 位
+const maxFlacBlockSize = 1<<24 - 1
+
+// writeTaggedFile 把 src 的音频数据加上标签写入 dst（src 中原有的标签被替换）
+// 支持 MP3 (ID3v2.3) 和 FLAC (Vorbis comment + PICTURE)，其他格式原样复制
+func writeTaggedFile(src, dst string, format AudioFormat, tags audioTags) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriterSize(out, 64*1024)
+	switch format {
+	case FormatMP3:
+		err = writeMp3WithTags(w, in, tags)
+	case FormatFLAC:
+		err = writeFlacWithTags(w, in, tags)
+	default:
+		_, err = io.Copy(w, in)
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(dst)
+	}
+	return err
+}
+
+// writeMp3WithTags 写入新的 ID3v2 标签，再复制跳过原有 ID3v2 标签后的音频数据
+func writeMp3WithTags(w io.Writer, in io.ReadSeeker, tags audioTags) error {
+	var audioStart int64
+	head := make([]byte, 10)
+	for {
+		if _, err := io.ReadFull(in, head); err != nil {
+			break // 文件太短，没有标签
+		}
+		size := id3v2Size(head)
+		if size == 0 {
+			break
+		}
+		audioStart += size
+		if _, err := in.Seek(audioStart, io.SeekStart); err != nil {
+			return err
+		}
+	}
+	if _, err := in.Seek(audioStart, io.SeekStart); err != nil {
+		return err
+	}
+
+	if _, err := w.Write(buildID3v2Tag(tags)); err != nil {
+		return err
+	}
+	_, err := io.Copy(w, in)
+	return err
+}
+
+// buildID3v2Tag 生成 ID3v2.3 标签（文本使用带 BOM 的 UTF-16）
+func buildID3v2Tag(tags audioTags) []byte {
+	var frames bytes.Buffer
+	writeFrame := func(id string, body []byte) {
+		var header [10]byte
+		copy(header[:4], id)
+		binary.BigEndian.PutUint32(header[4:], uint32(len(body)))
+		frames.Write(header[:])
+		frames.Write(body)
+	}
+	writeText := func(id, text string) {
+		if text == "" {
+			return
+		}
+		body := []byte{0x01, 0xFF, 0xFE} // UTF-16，小端 BOM
+		for _, u := range utf16.Encode([]rune(text)) {
+			body = append(body, byte(u), byte(u>>8))
+		}
+		writeFrame(id, body)
+	}
+
+	writeText("TIT2", tags.Title)
+	writeText("TPE1", strings.Join(tags.Artists, "/"))
+	writeText("TALB", tags.Album)
+	if tags.TrackNo > 0 {
+		writeText("TRCK", strconv.Itoa(tags.TrackNo))
+	}
+	writeText("TPOS", tags.DiscNo)
+	if len(tags.Cover) > 0 {
+		// 编码 ISO-8859-1，MIME 类型，图片类型 3 = 封面，空描述
+		body := []byte{0x00}
+		body = append(body, tags.CoverMime...)
+		body = append(body, 0x00, 0x03, 0x00)
+		body = append(body, tags.Cover...)
+		writeFrame("APIC", body)
+	}
+
+	size := frames.Len()
+	header := []byte{'I', 'D', '3', 0x03, 0x00, 0x00,
+		byte(size>>21) & 0x7F, byte(size>>14) & 0x7F, byte(size>>7) & 0x7F, byte(size) & 0x7F}
+	return append(header, frames.Bytes()...)
+}
+
+// writeFlacWithTags 保留 STREAMINFO、SEEKTABLE 等元数据块，替换 VORBIS_COMMENT 和 PICTURE（去掉 PADDING），再复制音频帧
+// SEEKTABLE 中的偏移相对第一个音频帧，元数据长度变化不影响
+func writeFlacWithTags(w io.Writer, in io.Reader, tags audioTags) error {
+	r := bufio.NewReaderSize(in, 64*1024)
+
+	head := make([]byte, 10)
+	if _, err := io.ReadFull(r, head[:4]); err != nil {
+		return err
+	}
+	// 部分文件在 fLaC 标记前带有 ID3v2 标签，直接丢弃
+	if string(head[:3]) == "ID3" {
+		if _, err := io.ReadFull(r, head[4:]); err != nil {
+			return err
+		}
+		if _, err := r.Discard(int(id3v2Size(head) - 10)); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(r, head[:4]); err != nil {
+			return err
+		}
+	}
+	if string(head[:4]) != "fLaC" {
+		return errors.New("not a FLAC stream")
+	}
+
+	type metadataBlock struct {
+		blockType byte
+		data      []byte
+	}
+	var blocks []metadataBlock
+	blockHeader := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(r, blockHeader); err != nil {
+			return err
+		}
+		isLast := blockHeader[0]&0x80 != 0
+		blockType := blockHeader[0] & 0x7F
+		length := int(blockHeader[1])<<16 | int(blockHeader[2])<<8 | int(blockHeader[3])
+
+		switch blockType {
+		case 1, 4, 6: // PADDING, VORBIS_COMMENT, PICTURE
+			if _, err := r.Discard(length); err != nil {
+				return err
+			}
+		default:
+			data := make([]byte, length)
+			if _, err := io.ReadFull(r, data); err != nil {
+				return err
+			}
+			blocks = append(blocks, metadataBlock{blockType, data})
+		}
+		if isLast {
+			break
+		}
+	}
+	if len(blocks) == 0 || blocks[0].blockType != 0 {
+		return errors.New("missing STREAMINFO")
+	}
+
+	blocks = append(blocks, metadataBlock{4, buildVorbisComment(tags)})
+	if picture := buildFlacPicture(tags); picture != nil {
+		blocks = append(blocks, metadataBlock{6, picture})
+	}
+
+	if _, err := w.Write([]byte("fLaC")); err != nil {
+		return err
+	}
+	for i, block := range blocks {
+		header := []byte{block.blockType, byte(len(block.data) >> 16), byte(len(block.data) >> 8), byte(len(block.data))}
+		if i == len(blocks)-1 {
+			header[0] |= 0x80
+		}
+		if _, err := w.Write(header); err != nil {
+			return err
+		}
+		if _, err := w.Write(block.data); err != nil {
+			return err
+		}
+	}
+	_, err := io.Copy(w, r)
+	return err
+}
+
+// buildVorbisComment 生成 VORBIS_COMMENT 块（长度为小端）
+func buildVorbisComment(tags audioTags) []byte {
+	var comments []string
+	add := func(key, value string) {
+		if value != "" {
+			comments = append(comments, key+"="+value)
+		}
+	}
+	add("TITLE", tags.Title)
+	for _, artist := range tags.Artists {
+		add("ARTIST", artist)
+	}
+	add("ALBUM", tags.Album)
+	if tags.TrackNo > 0 {
+		add("TRACKNUMBER", strconv.Itoa(tags.TrackNo))
+	}
+	add("DISCNUMBER", tags.DiscNo)
+
+	var buf bytes.Buffer
+	writeString := func(s string) {
+		binary.Write(&buf, binary.LittleEndian, uint32(len(s)))
+		buf.WriteString(s)
+	}
+	writeString("ChillPatcher")
+	binary.Write(&buf, binary.LittleEndian, uint32(len(comments)))
+	for _, comment := range comments {
+		writeString(comment)
+	}
+	return buf.Bytes()
+}
+
+// buildFlacPicture 生成 PICTURE 块（长度为大端），没有封面或封面过大时返回 nil
+func buildFlacPicture(tags audioTags) []byte {
+	if len(tags.Cover) == 0 || len(tags.Cover)+64+len(tags.CoverMime) > maxFlacBlockSize {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	writeUint32 := func(v uint32) {
+		binary.Write(&buf, binary.BigEndian, v)
+	}
+	writeUint32(3) // 封面
+	writeUint32(uint32(len(tags.CoverMime)))
+	buf.WriteString(tags.CoverMime)
+	writeUint32(0) // 描述
+	// 宽、高、色深、索引色数量，未知时可以为 0
+	for i := 0; i < 4; i++ {
+		writeUint32(0)
+	}
+	writeUint32(uint32(len(tags.Cover)))
+	buf.Write(tags.Cover)
+	return buf.Bytes()
+}
+
+// detectImageMime 根据文件头判断图片类型
+func detectImageMime(data []byte) string {
+	if bytes.HasPrefix(data, []byte{0x89, 'P', 'N', 'G'}) {
+		return "image/png"
+	}
+	return "image/jpeg"
+}
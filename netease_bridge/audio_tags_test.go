@@ -0,0 +1,391 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+// parseID3v23Frames 解析 buildID3v2Tag 生成的标签，返回各帧的内容
+func parseID3v23Frames(t *testing.T, tag []byte) map[string][]byte {
+	t.Helper()
+	if len(tag) < 10 || string(tag[:3]) != "ID3" || tag[3] != 3 {
+		t.Fatalf("not an ID3v2.3 tag: % x", tag[:10])
+	}
+	for _, b := range tag[6:10] {
+		if b&0x80 != 0 {
+			t.Fatalf("size is not syncsafe: % x", tag[6:10])
+		}
+	}
+	if size := id3v2Size(tag); size != int64(len(tag)) {
+		t.Fatalf("tag size = %d, want %d", size, len(tag))
+	}
+
+	frames := map[string][]byte{}
+	data := tag[10:]
+	for len(data) >= 10 {
+		id := string(data[:4])
+		size := int(binary.BigEndian.Uint32(data[4:8]))
+		if 10+size > len(data) {
+			t.Fatalf("frame %s overruns the tag", id)
+		}
+		frames[id] = data[10 : 10+size]
+		data = data[10+size:]
+	}
+	if len(data) != 0 {
+		t.Fatalf("%d trailing bytes after frames", len(data))
+	}
+	return frames
+}
+
+// decodeID3Text 解码带 BOM 的 UTF-16LE 文本帧
+func decodeID3Text(t *testing.T, body []byte) string {
+	t.Helper()
+	if len(body) < 3 || body[0] != 0x01 || body[1] != 0xFF || body[2] != 0xFE || len(body)%2 != 1 {
+		t.Fatalf("bad text frame: % x", body)
+	}
+	units := make([]uint16, 0, (len(body)-3)/2)
+	for i := 3; i < len(body); i += 2 {
+		units = append(units, uint16(body[i])|uint16(body[i+1])<<8)
+	}
+	return string(utf16.Decode(units))
+}
+
+func TestBuildID3v2Tag(t *testing.T) {
+	cover := bytes.Repeat([]byte{0xAB}, 300) // 大于 127 字节，检查同步安全整数
+	tests := []struct {
+		name  string
+		tags  audioTags
+		texts map[string]string
+		cover bool
+	}{
+		{
+			name: "all fields",
+			tags: audioTags{Title: "Song", Artists: []string{"A", "B"}, Album: "Album", TrackNo: 7, DiscNo: "1/2"},
+			texts: map[string]string{
+				"TIT2": "Song", "TPE1": "A/B", "TALB": "Album", "TRCK": "7", "TPOS": "1/2",
+			},
+		},
+		{
+			name:  "non-BMP characters",
+			tags:  audioTags{Title: "晴天 🎵", Artists: []string{"周杰伦"}},
+			texts: map[string]string{"TIT2": "晴天 🎵", "TPE1": "周杰伦"},
+		},
+		{
+			name:  "empty fields are omitted",
+			tags:  audioTags{Title: "Only"},
+			texts: map[string]string{"TIT2": "Only"},
+		},
+		{
+			name:  "cover",
+			tags:  audioTags{Title: "Cover", Cover: cover, CoverMime: "image/png"},
+			texts: map[string]string{"TIT2": "Cover"},
+			cover: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frames := parseID3v23Frames(t, buildID3v2Tag(tt.tags))
+
+			wantFrames := len(tt.texts)
+			if tt.cover {
+				wantFrames++
+			}
+			if len(frames) != wantFrames {
+				t.Fatalf("got %d frames, want %d", len(frames), wantFrames)
+			}
+			for id, want := range tt.texts {
+				body, ok := frames[id]
+				if !ok {
+					t.Fatalf("missing frame %s", id)
+				}
+				if got := decodeID3Text(t, body); got != want {
+					t.Fatalf("%s = %q, want %q", id, got, want)
+				}
+			}
+			if tt.cover {
+				want := append([]byte{0x00}, "image/png"...)
+				want = append(want, 0x00, 0x03, 0x00)
+				want = append(want, tt.tags.Cover...)
+				if !bytes.Equal(frames["APIC"], want) {
+					t.Fatal("APIC frame does not match the cover")
+				}
+			}
+		})
+	}
+}
+
+// id3Tag 生成内容为 body 的 ID3v2.4 标签，footer 为 true 时带 10 字节的尾部
+func id3Tag(body []byte, footer bool) []byte {
+	size := len(body)
+	flags := byte(0)
+	if footer {
+		flags = 0x10
+	}
+	tag := []byte{'I', 'D', '3', 0x04, 0x00, flags,
+		byte(size>>21) & 0x7F, byte(size>>14) & 0x7F, byte(size>>7) & 0x7F, byte(size) & 0x7F}
+	tag = append(tag, body...)
+	if footer {
+		tag = append(tag, '3', 'D', 'I', 0x04, 0x00, flags, tag[6], tag[7], tag[8], tag[9])
+	}
+	return tag
+}
+
+func TestWriteMp3WithTags(t *testing.T) {
+	audio := append([]byte{0xFF, 0xFB, 0x90, 0x64}, bytes.Repeat([]byte{0x55}, 200)...)
+	oldTag := id3Tag(bytes.Repeat([]byte{'x'}, 150), false)
+	tests := []struct {
+		name  string
+		input []byte
+		audio []byte
+	}{
+		{"no tag", audio, audio},
+		{"one tag", concat(oldTag, audio), audio},
+		{"multiple tags", concat(oldTag, id3Tag([]byte("second"), false), audio), audio},
+		{"tag with footer", concat(id3Tag([]byte("footer"), true), audio), audio},
+		{"footer tag followed by another tag", concat(id3Tag([]byte("a"), true), oldTag, audio), audio},
+		{"shorter than a tag header", []byte{0xFF, 0xFB, 0x90}, []byte{0xFF, 0xFB, 0x90}},
+	}
+	tags := audioTags{Title: "New", Artists: []string{"Artist"}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := writeMp3WithTags(&out, bytes.NewReader(tt.input), tags); err != nil {
+				t.Fatalf("writeMp3WithTags() error: %v", err)
+			}
+			result := out.Bytes()
+			tagSize := id3v2Size(result)
+			if tagSize == 0 {
+				t.Fatal("output does not start with an ID3 tag")
+			}
+			frames := parseID3v23Frames(t, result[:tagSize])
+			if got := decodeID3Text(t, frames["TIT2"]); got != "New" {
+				t.Fatalf("TIT2 = %q, want %q", got, "New")
+			}
+			if id3v2Size(result[tagSize:]) != 0 {
+				t.Fatal("old ID3 tag left in the output")
+			}
+			if !bytes.Equal(result[tagSize:], tt.audio) {
+				t.Fatalf("audio data changed: got %d bytes, want %d", len(result)-int(tagSize), len(tt.audio))
+			}
+		})
+	}
+}
+
+func concat(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+// flacBlock 元数据块头 + 数据
+func flacBlock(blockType byte, last bool, data []byte) []byte {
+	if last {
+		blockType |= 0x80
+	}
+	return append([]byte{blockType, byte(len(data) >> 16), byte(len(data) >> 8), byte(len(data))}, data...)
+}
+
+type parsedFlacBlock struct {
+	blockType byte
+	last      bool
+	data      []byte
+}
+
+// parseFlacBlocks 解析 fLaC 标记后的元数据块，返回各块和剩余的音频数据
+func parseFlacBlocks(t *testing.T, data []byte) ([]parsedFlacBlock, []byte) {
+	t.Helper()
+	if !bytes.HasPrefix(data, []byte("fLaC")) {
+		t.Fatalf("output does not start with fLaC: % x", data[:4])
+	}
+	data = data[4:]
+	var blocks []parsedFlacBlock
+	for {
+		if len(data) < 4 {
+			t.Fatal("metadata ended without a last block")
+		}
+		length := int(data[1])<<16 | int(data[2])<<8 | int(data[3])
+		if 4+length > len(data) {
+			t.Fatal("metadata block overruns the file")
+		}
+		block := parsedFlacBlock{data[0] & 0x7F, data[0]&0x80 != 0, data[4 : 4+length]}
+		blocks = append(blocks, block)
+		data = data[4+length:]
+		if block.last {
+			return blocks, data
+		}
+	}
+}
+
+// parseVorbisComment 解析 VORBIS_COMMENT 块，返回厂商字符串和注释
+func parseVorbisComment(t *testing.T, data []byte) (string, []string) {
+	t.Helper()
+	readString := func() string {
+		if len(data) < 4 {
+			t.Fatal("truncated vorbis comment")
+		}
+		n := int(binary.LittleEndian.Uint32(data))
+		if 4+n > len(data) {
+			t.Fatal("truncated vorbis comment")
+		}
+		s := string(data[4 : 4+n])
+		data = data[4+n:]
+		return s
+	}
+	vendor := readString()
+	count := int(binary.LittleEndian.Uint32(data))
+	data = data[4:]
+	comments := make([]string, count)
+	for i := range comments {
+		comments[i] = readString()
+	}
+	return vendor, comments
+}
+
+func TestWriteFlacWithTags(t *testing.T) {
+	streamInfo := bytes.Repeat([]byte{0x11}, 34)
+	seekTable := bytes.Repeat([]byte{0x22}, 18)
+	application := []byte("APPLdata")
+	audio := append([]byte{0xFF, 0xF8, 0x69, 0x08}, bytes.Repeat([]byte{0x33}, 100)...)
+	oldComment := buildVorbisComment(audioTags{Title: "Old"})
+
+	tags := audioTags{Title: "New", Artists: []string{"A", "B"}, Album: "Album", TrackNo: 3, DiscNo: "1"}
+	wantComments := []string{"TITLE=New", "ARTIST=A", "ARTIST=B", "ALBUM=Album", "TRACKNUMBER=3", "DISCNUMBER=1"}
+
+	tests := []struct {
+		name       string
+		input      []byte
+		tags       audioTags
+		wantBlocks []byte // 输出的元数据块类型
+	}{
+		{
+			name:       "only streaminfo",
+			input:      concat([]byte("fLaC"), flacBlock(0, true, streamInfo), audio),
+			tags:       tags,
+			wantBlocks: []byte{0, 4},
+		},
+		{
+			name: "replaces comment and picture, drops padding",
+			input: concat([]byte("fLaC"),
+				flacBlock(0, false, streamInfo),
+				flacBlock(4, false, oldComment),
+				flacBlock(3, false, seekTable),
+				flacBlock(6, false, []byte("old picture")),
+				flacBlock(1, false, make([]byte, 1024)),
+				flacBlock(2, true, application),
+				audio),
+			tags:       tags,
+			wantBlocks: []byte{0, 3, 2, 4},
+		},
+		{
+			name:       "last block was padding",
+			input:      concat([]byte("fLaC"), flacBlock(0, false, streamInfo), flacBlock(3, false, seekTable), flacBlock(1, true, make([]byte, 8192)), audio),
+			tags:       tags,
+			wantBlocks: []byte{0, 3, 4},
+		},
+		{
+			name:       "id3 tag before fLaC",
+			input:      concat(id3Tag(bytes.Repeat([]byte{'i'}, 300), false), []byte("fLaC"), flacBlock(0, false, streamInfo), flacBlock(1, true, make([]byte, 16)), audio),
+			tags:       tags,
+			wantBlocks: []byte{0, 4},
+		},
+		{
+			name:       "with cover",
+			input:      concat([]byte("fLaC"), flacBlock(0, true, streamInfo), audio),
+			tags:       audioTags{Title: "New", Artists: []string{"A", "B"}, Album: "Album", TrackNo: 3, DiscNo: "1", Cover: []byte("png data"), CoverMime: "image/png"},
+			wantBlocks: []byte{0, 4, 6},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := writeFlacWithTags(&out, bytes.NewReader(tt.input), tt.tags); err != nil {
+				t.Fatalf("writeFlacWithTags() error: %v", err)
+			}
+			blocks, rest := parseFlacBlocks(t, out.Bytes())
+
+			var types []byte
+			for i, block := range blocks {
+				types = append(types, block.blockType)
+				if block.last != (i == len(blocks)-1) {
+					t.Fatalf("block %d last flag = %v", i, block.last)
+				}
+			}
+			if !bytes.Equal(types, tt.wantBlocks) {
+				t.Fatalf("block types = %v, want %v", types, tt.wantBlocks)
+			}
+			if !bytes.Equal(blocks[0].data, streamInfo) {
+				t.Fatal("STREAMINFO changed")
+			}
+			for _, block := range blocks {
+				switch block.blockType {
+				case 2:
+					if !bytes.Equal(block.data, application) {
+						t.Fatal("APPLICATION block changed")
+					}
+				case 3:
+					if !bytes.Equal(block.data, seekTable) {
+						t.Fatal("SEEKTABLE changed")
+					}
+				case 4:
+					vendor, comments := parseVorbisComment(t, block.data)
+					if vendor != "ChillPatcher" || !reflect.DeepEqual(comments, wantComments) {
+						t.Fatalf("vorbis comment = %q %q, want %q", vendor, comments, wantComments)
+					}
+				case 6:
+					if !bytes.HasSuffix(block.data, tt.tags.Cover) || !bytes.Contains(block.data, []byte(tt.tags.CoverMime)) {
+						t.Fatal("PICTURE block does not contain the cover")
+					}
+				}
+			}
+			if !bytes.Equal(rest, audio) {
+				t.Fatalf("audio frames changed: got %d bytes, want %d", len(rest), len(audio))
+			}
+		})
+	}
+}
+
+func TestWriteFlacWithTagsErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []byte
+		want  string
+	}{
+		{"not flac", []byte("RIFF0000WAVE"), "not a FLAC stream"},
+		{"missing streaminfo", concat([]byte("fLaC"), flacBlock(3, true, make([]byte, 18))), "missing STREAMINFO"},
+		{"truncated metadata", concat([]byte("fLaC"), []byte{0x00, 0x00, 0x00, 0x22}, make([]byte, 10)), "EOF"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := writeFlacWithTags(&bytes.Buffer{}, bytes.NewReader(tt.input), audioTags{Title: "x"})
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSanitizeFileName(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"plain", "Artist - Song", "Artist - Song"},
+		{"reserved characters", `a<b>c:d"e/f\g|h?i*j`, "a_b_c_d_e_f_g_h_i_j"},
+		{"control characters", "a\tb\nc\x00", "a_b_c_"},
+		{"trailing dots and spaces", "  Song...  ", "Song"},
+		{"only dots", "...", "_"},
+		{"empty", "", "_"},
+		{"unicode kept", "周杰伦 - 晴天", "周杰伦 - 晴天"},
+		{"long name truncated by runes", strings.Repeat("歌", 200), strings.Repeat("歌", 150)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sanitizeFileName(tt.in); got != tt.want {
+				t.Fatalf("sanitizeFileName(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
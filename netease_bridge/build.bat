@@ -18,6 +18,15 @@ set "GOMUSICFOX_URL=https://github.com/go-musicfox/go-musicfox.git"
 set "GOMUSICFOX_BRANCH=master"
 set "OUTPUT_DIR=%PROJECT_ROOT%\bin\native\x64"
 
+:: 可选构建标签：设置为 fdkaac 启用 AAC (m4a) 解码（需要安装 fdk-aac 开发库）
+:: 不启用时只返回 m4a 地址的音质会改用其他音质的 flac/mp3 地址播放
+if not defined BUILD_TAGS set "BUILD_TAGS="
+
+:: 解码器依赖的版本（固定版本，避免每次构建拉取最新代码）
+:: go-fdkaac 没有发布版本，使用 fdkaac 时需要指定 commit 对应的伪版本，例如 v0.0.0-YYYYMMDDhhmmss-abcdef123456
+set "OGGVORBIS_VERSION=v1.0.5"
+if not defined FDKAAC_VERSION set "FDKAAC_VERSION="
+
 echo ===========================================
 echo ChillNetease.dll Build Script
 echo ===========================================
@@ -88,7 +97,25 @@ cd go-musicfox
 :: 构建 DLL
 echo.
 echo [5/5] Building DLL...
-go build -buildmode=c-shared -o netease_bridge\ChillNetease.dll -ldflags "-s -w" ./netease_bridge
+:: 额外的解码器依赖（Ogg Vorbis，启用 fdkaac 时还需要 fdk-aac 绑定）
+go get github.com/jfreymuth/oggvorbis@%OGGVORBIS_VERSION%
+if errorlevel 1 (
+    echo ERROR: Failed to get oggvorbis %OGGVORBIS_VERSION%!
+    exit /b 1
+)
+if /i "%BUILD_TAGS%"=="fdkaac" (
+    if "%FDKAAC_VERSION%"=="" (
+        echo ERROR: FDKAAC_VERSION is not set! Set it to the go-fdkaac version to build with.
+        exit /b 1
+    )
+    go get github.com/winlinvip/go-fdkaac/fdkaac@%FDKAAC_VERSION%
+    if errorlevel 1 (
+        echo ERROR: Failed to get go-fdkaac %FDKAAC_VERSION%!
+        exit /b 1
+    )
+)
+
+go build -buildmode=c-shared -tags "%BUILD_TAGS%" -o netease_bridge\ChillNetease.dll -ldflags "-s -w" ./netease_bridge
 
 if errorlevel 1 (
     echo.
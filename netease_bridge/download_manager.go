@@ -0,0 +1,1163 @@
+package main
+
+/*
+#include <stdlib.h>
+*/
+import "C"
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/buger/jsonparser"
+	"github.com/go-musicfox/go-musicfox/internal/netease"
+	"github.com/go-musicfox/netease-music/service"
+)
+
+// 下载任务状态
+const (
+	DownloadJobQueued    = "queued"    // 等待下载或下载中
+	DownloadJobPaused    = "paused"    // 已暂停（重启后未完成的任务也处于暂停状态）
+	DownloadJobCompleted = "completed" // 全部下载完成
+	DownloadJobFailed    = "failed"    // 已结束，但有歌曲下载失败（继续任务会重试失败的歌曲）
+)
+
+// 歌曲下载状态
+const (
+	DownloadItemPending     = "pending"
+	DownloadItemDownloading = "downloading"
+	DownloadItemDone        = "done"
+	DownloadItemFailed      = "failed"
+)
+
+const (
+	defaultDownloadConcurrency = 2
+	maxDownloadConcurrency     = 8
+	songDetailBatchSize        = 500              // 每次获取歌曲详情的数量
+	maxCoverBytes              = 10 * 1024 * 1024 // 封面图片大小上限
+)
+
+// 已下载的文件可能使用的扩展名（再次下载同一目录时跳过）
+var downloadExtensions = []string{"mp3", "flac", "m4a", "ogg"}
+
+// DownloadItem 下载任务中的一首歌曲
+type DownloadItem struct {
+	Song       SongInfo `json:"song"`
+	TrackNo    int      `json:"trackNo,omitempty"`
+	DiscNo     string   `json:"discNo,omitempty"`
+	State      string   `json:"state"`
+	Path       string   `json:"path,omitempty"` // 下载完成的文件
+	Downloaded int64    `json:"downloaded"`
+	Size       int64    `json:"size"`
+	Error      string   `json:"error,omitempty"`
+
+	base string // 开始下载时确定的文件路径（不含扩展名），清理临时文件时使用
+}
+
+// DownloadJob 下载任务：把一组歌曲按指定音质下载到同一个目录并写入标签
+// 任务列表保存在 dataDir/downloads.json，未下载完的歌曲保留 .part 文件，继续时断点续传
+type DownloadJob struct {
+	ID      int64           `json:"id"`
+	Name    string          `json:"name"`
+	Dir     string          `json:"dir"`
+	Quality string          `json:"quality"`
+	State   string          `json:"state"`
+	Items   []*DownloadItem `json:"items"`
+
+	session *Session // 创建任务的会话，重启后加载的任务使用默认会话
+	ctx     context.Context
+	cancel  context.CancelFunc // 暂停或删除任务时取消进行中的下载
+	removed bool
+}
+
+// DownloadJobSummary 返回给 C# 的任务进度
+type DownloadJobSummary struct {
+	ID         int64   `json:"id"`
+	Name       string  `json:"name"`
+	Dir        string  `json:"dir"`
+	Quality    string  `json:"quality"`
+	State      string  `json:"state"`
+	Total      int     `json:"total"`
+	Done       int     `json:"done"`
+	Failed     int     `json:"failed"`
+	Downloaded int64   `json:"downloaded"` // 正在下载的歌曲已下载的字节数
+	Progress   float64 `json:"progress"`   // 百分比
+}
+
+// DownloadJobInfo 任务进度和每首歌曲的状态
+type DownloadJobInfo struct {
+	DownloadJobSummary
+	Items []DownloadItem `json:"items"`
+}
+
+var (
+	downloadsMutex      sync.Mutex
+	downloadJobs        []*DownloadJob // 按创建顺序，先创建的任务先下载
+	nextDownloadJobId   int64          = 1
+	downloadConcurrency                = defaultDownloadConcurrency
+	activeDownloads     int
+	downloadsPath       string // 任务列表文件
+	defaultDownloadDir  string
+)
+
+// initDownloadManager 加载保存的下载任务
+func initDownloadManager(dataDir string) {
+	downloadsMutex.Lock()
+	defer downloadsMutex.Unlock()
+
+	downloadsPath = filepath.Join(dataDir, "downloads.json")
+	defaultDownloadDir = filepath.Join(dataDir, "downloads")
+
+	data, err := os.ReadFile(downloadsPath)
+	if err != nil {
+		return
+	}
+	var jobs []*DownloadJob
+	if err := json.Unmarshal(data, &jobs); err != nil {
+		return
+	}
+	for _, job := range jobs {
+		if job.State == DownloadJobQueued {
+			job.State = DownloadJobPaused
+		}
+		for _, item := range job.Items {
+			if item.State == DownloadItemDownloading {
+				item.State = DownloadItemPending
+			}
+		}
+		if job.ID >= nextDownloadJobId {
+			nextDownloadJobId = job.ID + 1
+		}
+	}
+	downloadJobs = jobs
+}
+
+// saveDownloadsLocked 保存任务列表（调用方需持有 downloadsMutex）
+func saveDownloadsLocked() {
+	if downloadsPath == "" {
+		return
+	}
+	data, err := json.Marshal(downloadJobs)
+	if err != nil {
+		return
+	}
+	// 先写临时文件再重命名，避免写到一半时崩溃导致任务列表损坏
+	tmpPath := downloadsPath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return
+	}
+	os.Rename(tmpPath, downloadsPath)
+}
+
+// findDownloadJobLocked 根据 ID 查找任务，不存在时返回 nil
+func findDownloadJobLocked(id int64) *DownloadJob {
+	for _, job := range downloadJobs {
+		if job.ID == id {
+			return job
+		}
+	}
+	return nil
+}
+
+// downloadedSongPath 查找歌曲已下载完成的文件（离线播放使用），没有则返回空字符串
+func downloadedSongPath(songId int64) string {
+	downloadsMutex.Lock()
+	defer downloadsMutex.Unlock()
+	for _, job := range downloadJobs {
+		for _, item := range job.Items {
+			if item.Song.ID != songId || item.State != DownloadItemDone || item.Path == "" {
+				continue
+			}
+			if fileSize(item.Path) > 0 {
+				return item.Path
+			}
+		}
+	}
+	return ""
+}
+
+// downloadedSongIds 已下载完成的歌曲 ID（不检查文件是否仍然存在）
+func downloadedSongIds() []int64 {
+	downloadsMutex.Lock()
+	defer downloadsMutex.Unlock()
+	var ids []int64
+	for _, job := range downloadJobs {
+		for _, item := range job.Items {
+			if item.State == DownloadItemDone && item.Path != "" {
+				ids = append(ids, item.Song.ID)
+			}
+		}
+	}
+	return ids
+}
+
+// resolveSongURL 使用任务的会话获取歌曲地址（会话已销毁或重启后加载的任务使用默认会话）
+func (job *DownloadJob) resolveSongURL(songId int64) (*SongURL, error) {
+	downloadsMutex.Lock()
+	session := job.session
+	downloadsMutex.Unlock()
+	if session == nil {
+		session = getDefaultSession()
+	}
+	if session == nil {
+		return nil, newError(ErrNotInitialized, "Not initialized")
+	}
+	return session.resolveSongURL(songId, job.Quality)
+}
+
+// detachDownloadSession 会话销毁时暂停它创建的下载任务，之后继续时使用默认会话
+func detachDownloadSession(session *Session) {
+	downloadsMutex.Lock()
+	defer downloadsMutex.Unlock()
+	changed := false
+	for _, job := range downloadJobs {
+		if job.session != session {
+			continue
+		}
+		job.session = nil
+		if job.State == DownloadJobQueued {
+			job.State = DownloadJobPaused
+			job.cancel()
+			changed = true
+		}
+	}
+	if changed {
+		saveDownloadsLocked()
+	}
+}
+
+// startDownloadJobLocked 开始或继续下载任务（调用方需持有 downloadsMutex）
+func startDownloadJobLocked(job *DownloadJob) {
+	if job.cancel != nil {
+		job.cancel()
+	}
+	job.ctx, job.cancel = context.WithCancel(context.Background())
+	job.State = DownloadJobQueued
+	finishDownloadJobLocked(job)
+	scheduleDownloadsLocked()
+}
+
+// scheduleDownloadsLocked 在并发数以内开始下载等待中的歌曲（调用方需持有 downloadsMutex）
+func scheduleDownloadsLocked() {
+	for activeDownloads < downloadConcurrency {
+		job, item := nextPendingDownloadLocked()
+		if item == nil {
+			return
+		}
+		item.State = DownloadItemDownloading
+		item.Error = ""
+		activeDownloads++
+		go runDownloadItem(job.ctx, job, item)
+	}
+}
+
+// nextPendingDownloadLocked 按任务创建顺序找到下一首等待下载的歌曲
+func nextPendingDownloadLocked() (*DownloadJob, *DownloadItem) {
+	for _, job := range downloadJobs {
+		if job.State != DownloadJobQueued {
+			continue
+		}
+		for _, item := range job.Items {
+			// 其他任务正在把同一首歌下载到同一目录时等它完成，之后直接使用下载好的文件
+			if item.State == DownloadItemPending && !downloadInProgressLocked(job, item) {
+				return job, item
+			}
+		}
+	}
+	return nil, nil
+}
+
+// runDownloadItem 下载一首歌曲并更新任务状态
+// ctx 为开始下载时任务的 context（暂停后继续会创建新的 context）
+func runDownloadItem(ctx context.Context, job *DownloadJob, item *DownloadItem) {
+	path, err := downloadSongFile(ctx, job, item)
+
+	downloadsMutex.Lock()
+	defer downloadsMutex.Unlock()
+	activeDownloads--
+
+	switch {
+	case err == nil:
+		item.State = DownloadItemDone
+		item.Path = path
+	case ctx.Err() != nil:
+		// 暂停或删除：.part 文件保留，继续时断点续传
+		item.State = DownloadItemPending
+		if job.removed {
+			removePartialDownloads(job, item)
+		}
+	default:
+		item.State = DownloadItemFailed
+		item.Error = err.Error()
+	}
+
+	if !job.removed {
+		if item.State != DownloadItemPending {
+			pushEvent(StreamEvent{
+				JobId:    job.ID,
+				Type:     EventDownloadProgress,
+				SongId:   item.Song.ID,
+				Progress: job.summaryLocked().Progress,
+				Message:  item.Error,
+			})
+		}
+		finishDownloadJobLocked(job)
+		saveDownloadsLocked()
+	}
+	scheduleDownloadsLocked()
+}
+
+// finishDownloadJobLocked 所有歌曲都已结束时把任务标记为完成或失败并发送事件
+func finishDownloadJobLocked(job *DownloadJob) {
+	if job.State != DownloadJobQueued {
+		return
+	}
+	failed := 0
+	for _, item := range job.Items {
+		switch item.State {
+		case DownloadItemPending, DownloadItemDownloading:
+			return
+		case DownloadItemFailed:
+			failed++
+		}
+	}
+
+	job.State = DownloadJobCompleted
+	message := ""
+	if failed > 0 {
+		job.State = DownloadJobFailed
+		message = strconv.Itoa(failed) + " song(s) failed"
+	}
+	job.cancel()
+	pushEvent(StreamEvent{JobId: job.ID, Type: EventDownloadComplete, Progress: 100, Message: message})
+}
+
+// summaryLocked 统计任务进度（调用方需持有 downloadsMutex）
+func (job *DownloadJob) summaryLocked() DownloadJobSummary {
+	summary := DownloadJobSummary{
+		ID:      job.ID,
+		Name:    job.Name,
+		Dir:     job.Dir,
+		Quality: job.Quality,
+		State:   job.State,
+		Total:   len(job.Items),
+	}
+	finished := 0.0
+	for _, item := range job.Items {
+		switch item.State {
+		case DownloadItemDone:
+			summary.Done++
+			finished++
+		case DownloadItemFailed:
+			summary.Failed++
+			finished++
+		case DownloadItemDownloading:
+			summary.Downloaded += item.Downloaded
+			if item.Size > 0 {
+				finished += float64(item.Downloaded) / float64(item.Size)
+			}
+		}
+	}
+	if summary.Total > 0 {
+		summary.Progress = finished * 100 / float64(summary.Total)
+	}
+	return summary
+}
+
+// songFileName 下载文件的文件名（不含扩展名）："歌手 - 歌名"
+func songFileName(song SongInfo) string {
+	name := song.Name
+	if name == "" {
+		name = strconv.FormatInt(song.ID, 10)
+	}
+	if len(song.Artists) > 0 {
+		name = strings.Join(song.Artists, ", ") + " - " + name
+	}
+	return sanitizeFileName(name)
+}
+
+// downloadBaseNameLocked 下载文件的路径（不含扩展名），调用方需持有 downloadsMutex
+// 同一目录中有其他歌曲使用同名文件时加上歌曲 ID："歌手 - 歌名 (ID)"
+func (job *DownloadJob) downloadBaseNameLocked(item *DownloadItem) string {
+	base := filepath.Join(job.Dir, songFileName(item.Song))
+	if downloadNameTakenLocked(job, item, base) {
+		base += " (" + strconv.FormatInt(item.Song.ID, 10) + ")"
+	}
+	return base
+}
+
+// downloadNameTakenLocked 检查 base 是否已被其他歌曲占用：
+// 已下载完成的文件、排在前面的同名歌曲，或目录中不属于任何任务的同名文件
+func downloadNameTakenLocked(job *DownloadJob, item *DownloadItem, base string) bool {
+	name := songFileName(item.Song)
+	before := true
+	for _, other := range downloadJobs {
+		for _, o := range other.Items {
+			if o == item {
+				before = false
+				continue
+			}
+			if o.Song.ID == item.Song.ID {
+				continue
+			}
+			if o.State == DownloadItemDone && o.Path != "" {
+				if sameDownloadPath(strings.TrimSuffix(o.Path, filepath.Ext(o.Path)), base) {
+					return true
+				}
+				continue
+			}
+			if before && sameDownloadPath(other.Dir, job.Dir) && strings.EqualFold(songFileName(o.Song), name) {
+				return true
+			}
+		}
+	}
+	for _, ext := range downloadExtensions {
+		path := base + "." + ext
+		if info, err := os.Stat(path); err == nil && !info.IsDir() && !isRecordedDownloadLocked(item.Song.ID, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// isRecordedDownloadLocked 检查 path 是否是任务记录的这首歌曲已下载完成的文件
+func isRecordedDownloadLocked(songId int64, path string) bool {
+	for _, job := range downloadJobs {
+		for _, item := range job.Items {
+			if item.Song.ID == songId && item.State == DownloadItemDone && sameDownloadPath(item.Path, path) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// downloadedInDirLocked 查找任务记录的这首歌曲在 dir 中已下载完成的文件，没有则返回空字符串
+func downloadedInDirLocked(songId int64, dir string) string {
+	for _, job := range downloadJobs {
+		for _, item := range job.Items {
+			if item.Song.ID != songId || item.State != DownloadItemDone || item.Path == "" {
+				continue
+			}
+			if sameDownloadPath(filepath.Dir(item.Path), dir) && fileSize(item.Path) > 0 {
+				return item.Path
+			}
+		}
+	}
+	return ""
+}
+
+// sameDownloadPath 比较两个下载路径（Windows 下不区分大小写）
+func sameDownloadPath(a, b string) bool {
+	return strings.EqualFold(filepath.Clean(a), filepath.Clean(b))
+}
+
+// downloadInProgressLocked 检查同一目录中是否有其他任务正在下载这首歌曲
+func downloadInProgressLocked(job *DownloadJob, item *DownloadItem) bool {
+	for _, other := range downloadJobs {
+		if !sameDownloadPath(other.Dir, job.Dir) {
+			continue
+		}
+		for _, o := range other.Items {
+			if o != item && o.Song.ID == item.Song.ID && o.State == DownloadItemDownloading {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sanitizeFileName 替换文件名中不允许的字符并限制长度
+func sanitizeFileName(name string) string {
+	runes := []rune(strings.Map(func(r rune) rune {
+		if r < 0x20 || strings.ContainsRune(`<>:"/\|?*`, r) {
+			return '_'
+		}
+		return r
+	}, name))
+	if len(runes) > 150 {
+		runes = runes[:150]
+	}
+	name = strings.TrimRight(strings.TrimSpace(string(runes)), ".")
+	if name == "" {
+		name = "_"
+	}
+	return name
+}
+
+// removePartialDownloads 删除歌曲未下载完的临时文件（调用方需持有 downloadsMutex）
+func removePartialDownloads(job *DownloadJob, item *DownloadItem) {
+	base := item.base
+	if base == "" {
+		base = job.downloadBaseNameLocked(item)
+	}
+	// 文件名中可能有 [ ] 等通配符，逐个扩展名删除而不用 filepath.Glob
+	for _, ext := range downloadExtensions {
+		os.Remove(downloadPartPath(base, ext))
+	}
+}
+
+// downloadSongFile 下载一首歌曲并写入标签，返回文件路径（不持有 downloadsMutex 时调用）
+// 本地音频缓存中已有完整文件时直接复制，同一目录中已经下载过这首歌曲时跳过
+func downloadSongFile(ctx context.Context, job *DownloadJob, item *DownloadItem) (string, error) {
+	downloadsMutex.Lock()
+	if path := downloadedInDirLocked(item.Song.ID, job.Dir); path != "" {
+		downloadsMutex.Unlock()
+		return path, nil
+	}
+	base := job.downloadBaseNameLocked(item)
+	item.base = base
+	downloadsMutex.Unlock()
+
+	if err := os.MkdirAll(job.Dir, 0755); err != nil {
+		return "", newError(ErrIO, "Failed to create download directory: "+err.Error())
+	}
+
+	var src, musicType, partPath string
+	if audioCacheManager != nil {
+		if cache := audioCacheManager.Acquire(item.Song.ID, job.Quality); cache != nil {
+			defer cache.Close()
+			// 校验失败（已损坏）的缓存不复制，重新下载
+			if cache.IsComplete() && cache.isTrusted() {
+				src = cache.cachePath
+				musicType = cache.format
+			}
+		}
+	}
+
+	if src == "" {
+		songUrl, err := job.resolveSongURL(item.Song.ID)
+		if err != nil {
+			return "", err
+		}
+
+		progress := func(downloaded, size int64) {
+			downloadsMutex.Lock()
+			item.Downloaded = downloaded
+			item.Size = size
+			downloadsMutex.Unlock()
+		}
+		refresh := func() (*SongURL, error) {
+			return job.resolveSongURL(item.Song.ID)
+		}
+		songUrl, err = fetchSongFile(ctx, base, songUrl, refresh, progress)
+		if err != nil {
+			return "", err
+		}
+		musicType = songUrl.Type
+		partPath = downloadPartPath(base, musicType)
+		src = partPath
+	}
+
+	tags := audioTags{
+		Title:   item.Song.Name,
+		Artists: item.Song.Artists,
+		Album:   item.Song.Album,
+		TrackNo: item.TrackNo,
+		DiscNo:  item.DiscNo,
+	}
+	// 封面获取失败时只写文字标签
+	if cover, err := fetchCover(ctx, item.Song.CoverUrl); err == nil {
+		tags.Cover = cover
+		tags.CoverMime = detectImageMime(cover)
+	}
+
+	finalPath := base + "." + downloadExtension(musicType)
+	tmpPath := finalPath + ".tmp"
+	if err := writeTaggedFile(src, tmpPath, audioFormatFromType(musicType), tags); err != nil {
+		return "", newError(ErrIO, "Failed to write tags: "+err.Error())
+	}
+	if err := os.Rename(tmpPath, finalPath); err != nil {
+		os.Remove(tmpPath)
+		return "", newError(ErrIO, "Failed to save file: "+err.Error())
+	}
+	if partPath != "" {
+		os.Remove(partPath)
+	}
+	return finalPath, nil
+}
+
+// downloadExtension 根据接口返回的类型确定扩展名
+func downloadExtension(musicType string) string {
+	musicType = strings.ToLower(musicType)
+	if musicType == "" {
+		return "mp3"
+	}
+	return musicType
+}
+
+// downloadPartPath 未下载完的临时文件路径
+func downloadPartPath(base, musicType string) string {
+	return base + "." + downloadExtension(musicType) + ".part"
+}
+
+// fetchSongFile 把歌曲下载到 base 对应的 .part 文件，从已有的部分继续；出错后指数退避重试，地址过期时重新获取地址
+// 下载完成后校验接口返回的 MD5，返回最终使用的地址信息（刷新后文件类型可能改变）
+func fetchSongFile(ctx context.Context, base string, songUrl *SongURL, refresh func() (*SongURL, error), progress func(downloaded, size int64)) (*SongURL, error) {
+	transport := newDownloadTransport(defaultDownloadTimeouts)
+	client := &http.Client{Transport: transport}
+	defer transport.CloseIdleConnections()
+
+	path := downloadPartPath(base, songUrl.Type)
+	totalSize := songUrl.Size
+	report := func(downloaded, size int64) {
+		if size > 0 {
+			totalSize = size
+		}
+		progress(downloaded, size)
+	}
+
+	retries, refreshes := 0, 0
+	for {
+		before := fileSize(path)
+		err := fetchSongRange(ctx, client, songUrl.URL, path, report)
+		if err == nil {
+			break
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		de, _ := err.(*downloadError)
+		if de != nil && de.urlExpired && refreshes < maxUrlRefreshes {
+			refreshes++
+			fresh, refreshErr := refresh()
+			if refreshErr == nil {
+				// 新地址不是同一个文件（类型或大小不同）时已下载的数据无法续用，改用新文件的 MD5 和扩展名从头下载
+				if !strings.EqualFold(fresh.Type, songUrl.Type) || (fresh.Size > 0 && totalSize > 0 && fresh.Size != totalSize) {
+					os.Remove(path)
+					path = downloadPartPath(base, fresh.Type)
+					if err := os.Truncate(path, 0); err != nil && !os.IsNotExist(err) {
+						return nil, newError(ErrIO, "Failed to truncate file: "+err.Error())
+					}
+					totalSize = fresh.Size
+				}
+				songUrl = fresh
+				continue
+			}
+			err, de = refreshErr, nil
+		}
+
+		if fileSize(path) > before {
+			retries = 0
+		}
+		retries++
+		if (de != nil && !de.retryable) || retries > maxDownloadRetries {
+			return nil, err
+		}
+		wait := downloadRetryBaseWait << (retries - 1)
+		if wait > downloadRetryMaxWait {
+			wait = downloadRetryMaxWait
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+
+	if songUrl.MD5 != "" {
+		sum, err := fileMD5(path)
+		if err != nil {
+			return nil, newError(ErrIO, "Failed to read downloaded file: "+err.Error())
+		}
+		if !strings.EqualFold(sum, songUrl.MD5) {
+			// 损坏的文件不能续传，下次从头下载
+			os.Remove(path)
+			return nil, newError(ErrNetwork, "MD5 mismatch: expected "+songUrl.MD5+", got "+sum)
+		}
+	}
+	return songUrl, nil
+}
+
+// fetchSongRange 请求 path 已有部分之后的数据并追加写入
+func fetchSongRange(ctx context.Context, client *http.Client, url, path string, progress func(downloaded, size int64)) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return &downloadError{msg: "Failed to open file: " + err.Error()}
+	}
+	defer file.Close()
+
+	start, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return &downloadError{msg: "Failed to open file: " + err.Error()}
+	}
+
+	reqCtx, reqCancel := context.WithCancel(ctx)
+	defer reqCancel()
+	req, err := http.NewRequestWithContext(reqCtx, "GET", url, nil)
+	if err != nil {
+		return &downloadError{msg: "Failed to create request: " + err.Error()}
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0")
+	if start > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", start))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return &downloadError{msg: "Request failed: " + err.Error(), retryable: true}
+	}
+	defer resp.Body.Close()
+
+	var size int64
+	switch {
+	case resp.StatusCode == http.StatusPartialContent:
+		_, size = parseContentRange(resp.Header.Get("Content-Range"))
+	case resp.StatusCode == http.StatusOK:
+		// 服务器不支持 Range，从头下载
+		if err := file.Truncate(0); err != nil {
+			return &downloadError{msg: "Failed to truncate file: " + err.Error()}
+		}
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return &downloadError{msg: "Failed to truncate file: " + err.Error()}
+		}
+		start = 0
+		size = resp.ContentLength
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && start > 0:
+		// 上次已经下载完
+		return nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return &downloadError{msg: "Server returned " + resp.Status, retryable: true}
+	case resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return &downloadError{msg: "Server returned " + resp.Status, urlExpired: true}
+	default:
+		return &downloadError{msg: "Server returned " + resp.Status}
+	}
+
+	// 长时间收不到数据时断开连接，由重试逻辑重新请求
+	var stalled int32
+	readTimer := time.AfterFunc(defaultDownloadTimeouts.read, func() {
+		atomic.StoreInt32(&stalled, 1)
+		reqCancel()
+	})
+	defer readTimer.Stop()
+
+	written := start
+	progress(written, size)
+	buffer := make([]byte, 32*1024)
+	for {
+		n, err := resp.Body.Read(buffer)
+		if n > 0 {
+			readTimer.Reset(defaultDownloadTimeouts.read)
+			if _, werr := file.Write(buffer[:n]); werr != nil {
+				return &downloadError{msg: "Failed to write file: " + werr.Error()}
+			}
+			written += int64(n)
+			progress(written, size)
+		}
+		if err == io.EOF {
+			if size > 0 && written < size {
+				return &downloadError{msg: "Connection closed before download finished", retryable: true}
+			}
+			return nil
+		}
+		if err != nil {
+			if atomic.LoadInt32(&stalled) != 0 {
+				return &downloadError{msg: "No data received for " + defaultDownloadTimeouts.read.String(), retryable: true}
+			}
+			return &downloadError{msg: "Read failed: " + err.Error(), retryable: true}
+		}
+	}
+}
+
+// fileSize 文件大小，不存在时返回 0
+func fileSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+// fetchCover 下载专辑封面
+func fetchCover(ctx context.Context, coverUrl string) ([]byte, error) {
+	if coverUrl == "" {
+		return nil, newError(ErrNotFound, "No cover")
+	}
+	if !strings.Contains(coverUrl, "?") {
+		coverUrl += "?param=800y800"
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, defaultDownloadTimeouts.read)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", coverUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, newError(ErrNetwork, "Server returned "+resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxCoverBytes))
+}
+
+// fetchDownloadItems 获取歌曲详情（标题、歌手、专辑、音轨号），作为下载任务的歌曲列表
+// 调用方需持有 lockApi；接口没有返回的歌曲只保留 ID
+func fetchDownloadItems(songIds []int64) ([]*DownloadItem, error) {
+	details := make(map[int64]*DownloadItem, len(songIds))
+	for start := 0; start < len(songIds); start += songDetailBatchSize {
+		end := start + songDetailBatchSize
+		if end > len(songIds) {
+			end = len(songIds)
+		}
+		ids := make([]string, 0, end-start)
+		for _, id := range songIds[start:end] {
+			ids = append(ids, strconv.FormatInt(id, 10))
+		}
+
+		detailService := service.SongDetailService{Ids: strings.Join(ids, ",")}
+		code, resp := detailService.SongDetail()
+		if code != 200 {
+			return nil, newApiError(code, "SongDetail API returned code: "+strconv.FormatFloat(code, 'f', 0, 64))
+		}
+
+		_, _ = jsonparser.ArrayEach(resp, func(value []byte, dataType jsonparser.ValueType, offset int, err error) {
+			item := parseSongDetail(value)
+			if item.Song.ID != 0 {
+				details[item.Song.ID] = item
+			}
+		}, "songs")
+	}
+
+	items := make([]*DownloadItem, 0, len(songIds))
+	for _, id := range songIds {
+		item, ok := details[id]
+		if !ok {
+			item = &DownloadItem{Song: SongInfo{ID: id}}
+		}
+		item.State = DownloadItemPending
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// parseSongDetail 解析 song/detail 接口返回的一首歌曲
+func parseSongDetail(value []byte) *DownloadItem {
+	item := &DownloadItem{}
+	song := &item.Song
+	song.ID, _ = jsonparser.GetInt(value, "id")
+	song.Name, _ = jsonparser.GetString(value, "name")
+	if dt, err := jsonparser.GetInt(value, "dt"); err == nil {
+		song.Duration = float64(dt) / 1000
+	}
+	song.Artists = []string{}
+	_, _ = jsonparser.ArrayEach(value, func(artist []byte, dataType jsonparser.ValueType, offset int, err error) {
+		if name, err := jsonparser.GetString(artist, "name"); err == nil {
+			song.Artists = append(song.Artists, name)
+		}
+	}, "ar")
+	song.AlbumID, _ = jsonparser.GetInt(value, "al", "id")
+	song.Album, _ = jsonparser.GetString(value, "al", "name")
+	song.CoverUrl, _ = jsonparser.GetString(value, "al", "picUrl")
+	if no, err := jsonparser.GetInt(value, "no"); err == nil {
+		item.TrackNo = int(no)
+	}
+	item.DiscNo, _ = jsonparser.GetString(value, "cd")
+	return item
+}
+
+// createDownloadJob 创建下载任务并开始下载，返回任务 ID，失败时返回 -1 并记录错误
+func createDownloadJob(session *Session, name string, songIds []int64, quality, dir string) int64 {
+	if quality == "" {
+		quality = "exhigh"
+	}
+
+	items, err := func() ([]*DownloadItem, error) {
+		defer session.lockApi()()
+		return fetchDownloadItems(songIds)
+	}()
+	if err != nil {
+		setErrorFrom(err, ErrApi)
+		return -1
+	}
+
+	downloadsMutex.Lock()
+	defer downloadsMutex.Unlock()
+
+	if dir == "" {
+		dir = filepath.Join(defaultDownloadDir, sanitizeFileName(name))
+	}
+	job := &DownloadJob{
+		ID:      nextDownloadJobId,
+		Name:    name,
+		Dir:     dir,
+		Quality: quality,
+		Items:   items,
+		session: session,
+	}
+	nextDownloadJobId++
+	downloadJobs = append(downloadJobs, job)
+	startDownloadJobLocked(job)
+	saveDownloadsLocked()
+	return job.ID
+}
+
+//export NeteaseDownloadPlaylist
+func NeteaseDownloadPlaylist(playlistIdC C.longlong, qualityC *C.char, dirC *C.char) C.longlong {
+	return NeteaseSessionDownloadPlaylist(0, playlistIdC, qualityC, dirC)
+}
+
+//export NeteaseSessionDownloadPlaylist
+// NeteaseSessionDownloadPlaylist 下载整个歌单
+// quality: 音质，空字符串表示 exhigh
+// dir: 下载目录，空字符串表示 dataDir/downloads/歌单名
+// 返回: 任务 ID，-1 = 失败
+func NeteaseSessionDownloadPlaylist(sessionC C.longlong, playlistIdC C.longlong, qualityC *C.char, dirC *C.char) C.longlong {
+	session := getSession(int64(sessionC))
+	if session == nil {
+		return -1
+	}
+	playlistId := int64(playlistIdC)
+
+	name := "Playlist " + strconv.FormatInt(playlistId, 10)
+	songIds, err := func() ([]int64, error) {
+		defer session.lockApi()()
+
+		codeType, songs := netease.FetchSongsOfPlaylist(playlistId, true)
+		if codeType != 0 { // Success = 0
+			category := ErrApi
+			switch codeType {
+			case 1: // NetworkError
+				category = ErrNetwork
+			case 2: // NeedLogin
+				category = ErrNotLoggedIn
+			}
+			return nil, newError(category, "FetchSongsOfPlaylist failed with code: "+strconv.Itoa(int(codeType)))
+		}
+
+		detailService := service.PlaylistDetailService{Id: strconv.FormatInt(playlistId, 10)}
+		if code, response := detailService.PlaylistDetail(); code == 200 {
+			if playlistName, err := jsonparser.GetString(response, "playlist", "name"); err == nil && playlistName != "" {
+				name = playlistName
+			}
+		}
+
+		ids := make([]int64, len(songs))
+		for i, song := range songs {
+			ids[i] = song.Id
+		}
+		return ids, nil
+	}()
+	if err != nil {
+		setErrorFrom(err, ErrApi)
+		return -1
+	}
+
+	return C.longlong(createDownloadJob(session, name, songIds, C.GoString(qualityC), C.GoString(dirC)))
+}
+
+//export NeteaseDownloadLikedSongs
+func NeteaseDownloadLikedSongs(qualityC *C.char, dirC *C.char) C.longlong {
+	return NeteaseSessionDownloadLikedSongs(0, qualityC, dirC)
+}
+
+//export NeteaseSessionDownloadLikedSongs
+// NeteaseSessionDownloadLikedSongs 下载所有收藏的歌曲（参数同 NeteaseSessionDownloadPlaylist）
+// 返回: 任务 ID，-1 = 失败
+func NeteaseSessionDownloadLikedSongs(sessionC C.longlong, qualityC *C.char, dirC *C.char) C.longlong {
+	session := getSession(int64(sessionC))
+	if session == nil {
+		return -1
+	}
+	currentUser := session.currentUser()
+	if currentUser == nil {
+		setError(ErrNotLoggedIn, "Not logged in")
+		return -1
+	}
+
+	songIds, err := func() ([]int64, error) {
+		defer session.lockApi()()
+
+		likeListService := service.LikeListService{
+			UID: strconv.FormatInt(currentUser.UserId, 10),
+		}
+		code, resp := likeListService.LikeList()
+		if code != 200 {
+			return nil, newApiError(code, "LikeList API returned code: "+strconv.FormatFloat(code, 'f', 0, 64))
+		}
+		var response struct {
+			Ids []int64 `json:"ids"`
+		}
+		if err := json.Unmarshal(resp, &response); err != nil {
+			return nil, newError(ErrApi, "Failed to parse like list response: "+err.Error())
+		}
+		return response.Ids, nil
+	}()
+	if err != nil {
+		setErrorFrom(err, ErrApi)
+		return -1
+	}
+
+	return C.longlong(createDownloadJob(session, "Liked Songs", songIds, C.GoString(qualityC), C.GoString(dirC)))
+}
+
+//export NeteaseDownloadSongs
+func NeteaseDownloadSongs(songIdsJsonC *C.char, qualityC *C.char, dirC *C.char) C.longlong {
+	return NeteaseSessionDownloadSongs(0, songIdsJsonC, qualityC, dirC)
+}
+
+//export NeteaseSessionDownloadSongs
+// NeteaseSessionDownloadSongs 下载指定的歌曲
+// songIdsJson: 歌曲 ID 的 JSON 数组；dir 为空时下载到 dataDir/downloads/Songs
+// 返回: 任务 ID，-1 = 失败
+func NeteaseSessionDownloadSongs(sessionC C.longlong, songIdsJsonC *C.char, qualityC *C.char, dirC *C.char) C.longlong {
+	session := getSession(int64(sessionC))
+	if session == nil {
+		return -1
+	}
+
+	var songIds []int64
+	if err := json.Unmarshal([]byte(C.GoString(songIdsJsonC)), &songIds); err != nil || len(songIds) == 0 {
+		setError(ErrInvalidArgument, "Invalid song ID list")
+		return -1
+	}
+
+	return C.longlong(createDownloadJob(session, "Songs", songIds, C.GoString(qualityC), C.GoString(dirC)))
+}
+
+//export NeteaseGetDownloadJobs
+// NeteaseGetDownloadJobs 获取所有下载任务的进度
+// 返回: JSON 数组字符串（DownloadJobSummary）
+func NeteaseGetDownloadJobs() *C.char {
+	downloadsMutex.Lock()
+	summaries := make([]DownloadJobSummary, len(downloadJobs))
+	for i, job := range downloadJobs {
+		summaries[i] = job.summaryLocked()
+	}
+	downloadsMutex.Unlock()
+
+	jsonBytes, _ := json.Marshal(summaries)
+	return C.CString(string(jsonBytes))
+}
+
+//export NeteaseGetDownloadJob
+// NeteaseGetDownloadJob 获取下载任务的进度和每首歌曲的状态
+// 返回: JSON 字符串（DownloadJobInfo），任务不存在时返回 NULL
+func NeteaseGetDownloadJob(jobIdC C.longlong) *C.char {
+	downloadsMutex.Lock()
+	job := findDownloadJobLocked(int64(jobIdC))
+	if job == nil {
+		downloadsMutex.Unlock()
+		setError(ErrNotFound, "Download job not found")
+		return nil
+	}
+	info := DownloadJobInfo{
+		DownloadJobSummary: job.summaryLocked(),
+		Items:              make([]DownloadItem, len(job.Items)),
+	}
+	for i, item := range job.Items {
+		info.Items[i] = *item
+	}
+	downloadsMutex.Unlock()
+
+	jsonBytes, _ := json.Marshal(info)
+	return C.CString(string(jsonBytes))
+}
+
+//export NeteasePauseDownloadJob
+// NeteasePauseDownloadJob 暂停下载任务（正在下载的歌曲保留已下载的部分）
+// 返回: 0 = 成功, -1 = 失败
+func NeteasePauseDownloadJob(jobIdC C.longlong) C.int {
+	downloadsMutex.Lock()
+	defer downloadsMutex.Unlock()
+
+	job := findDownloadJobLocked(int64(jobIdC))
+	if job == nil {
+		setError(ErrNotFound, "Download job not found")
+		return -1
+	}
+	if job.State != DownloadJobQueued {
+		return 0
+	}
+	job.State = DownloadJobPaused
+	job.cancel()
+	saveDownloadsLocked()
+	return 0
+}
+
+//export NeteaseResumeDownloadJob
+// NeteaseResumeDownloadJob 继续下载任务，之前失败的歌曲会重新下载
+// 返回: 0 = 成功, -1 = 失败
+func NeteaseResumeDownloadJob(jobIdC C.longlong) C.int {
+	downloadsMutex.Lock()
+	defer downloadsMutex.Unlock()
+
+	job := findDownloadJobLocked(int64(jobIdC))
+	if job == nil {
+		setError(ErrNotFound, "Download job not found")
+		return -1
+	}
+	if job.State == DownloadJobQueued {
+		return 0
+	}
+	for _, item := range job.Items {
+		if item.State == DownloadItemFailed {
+			item.State = DownloadItemPending
+			item.Error = ""
+		}
+	}
+	startDownloadJobLocked(job)
+	saveDownloadsLocked()
+	return 0
+}
+
+//export NeteaseRemoveDownloadJob
+// NeteaseRemoveDownloadJob 停止并删除下载任务（已下载完成的文件保留）
+// 返回: 0 = 成功, -1 = 失败
+func NeteaseRemoveDownloadJob(jobIdC C.longlong) C.int {
+	downloadsMutex.Lock()
+	defer downloadsMutex.Unlock()
+
+	for i, job := range downloadJobs {
+		if job.ID != int64(jobIdC) {
+			continue
+		}
+		job.removed = true
+		if job.cancel != nil {
+			job.cancel()
+		}
+		// 正在下载的歌曲在下载协程退出时清理
+		for _, item := range job.Items {
+			if item.State == DownloadItemPending || item.State == DownloadItemFailed {
+				removePartialDownloads(job, item)
+			}
+		}
+		downloadJobs = append(downloadJobs[:i], downloadJobs[i+1:]...)
+		saveDownloadsLocked()
+		return 0
+	}
+	setError(ErrNotFound, "Download job not found")
+	return -1
+}
+
+//export NeteaseSetDownloadConcurrency
+// NeteaseSetDownloadConcurrency 设置同时下载的歌曲数（1~8，默认 2）
+// 返回: 0 = 成功, -1 = 失败
+func NeteaseSetDownloadConcurrency(countC C.int) C.int {
+	count := int(countC)
+	if count < 1 || count > maxDownloadConcurrency {
+		setError(ErrInvalidArgument, "Concurrency must be between 1 and 8")
+		return -1
+	}
+
+	downloadsMutex.Lock()
+	defer downloadsMutex.Unlock()
+	downloadConcurrency = count
+	scheduleDownloadsLocked()
+	return 0
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestRemovePartialDownloads(t *testing.T) {
+	tests := []struct {
+		name string
+		song SongInfo
+		base bool // 是否已经记录了开始下载时的路径
+	}{
+		{"plain name", SongInfo{ID: 1, Name: "Song", Artists: []string{"Artist"}}, true},
+		{"brackets in name", SongInfo{ID: 2, Name: "Song [Live]", Artists: []string{"Artist"}}, true},
+		{"brackets without recorded base", SongInfo{ID: 3, Name: "[Intro] Song", Artists: []string{"A[1]"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			job := &DownloadJob{Dir: dir}
+			item := &DownloadItem{Song: tt.song}
+			name := songFileName(tt.song)
+			if tt.base {
+				item.base = filepath.Join(dir, name)
+			}
+
+			// 每种格式的临时文件都要删除；已下载的文件和其他歌曲的临时文件保留
+			for _, ext := range downloadExtensions {
+				writeTestFile(t, filepath.Join(dir, name+"."+ext+".part"))
+			}
+			keep := []string{name + " (99).mp3.part", "Other.flac.part"}
+			if tt.base {
+				keep = append(keep, name+".mp3")
+			}
+			for _, file := range keep {
+				writeTestFile(t, filepath.Join(dir, file))
+			}
+
+			downloadsMutex.Lock()
+			removePartialDownloads(job, item)
+			downloadsMutex.Unlock()
+
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, e := range entries {
+				got = append(got, e.Name())
+			}
+			sort.Strings(keep)
+			if !reflect.DeepEqual(got, keep) {
+				t.Fatalf("files left = %q, want %q", got, keep)
+			}
+		})
+	}
+}
+
+func writeTestFile(t *testing.T, path string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
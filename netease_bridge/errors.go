@@ -0,0 +1,215 @@
+package main
+
+/*
+#ifdef _WIN32
+#include <windows.h>
+static inline unsigned long long bridgeThreadId(void) { return (unsigned long long)GetCurrentThreadId(); }
+#else
+#include <pthread.h>
+static inline unsigned long long bridgeThreadId(void) { return (unsigned long long)pthread_self(); }
+#endif
+*/
+import "C"
+import (
+	"errors"
+	"sync"
+)
+
+// ErrorCategory 错误分类，数值即 BridgeError.Code，C# 端据此分支
+type ErrorCategory int
+
+const (
+	ErrNone            ErrorCategory = iota // 没有错误
+	ErrInvalidArgument                      // 参数错误
+	ErrNotInitialized                       // 未调用 NeteaseInit
+	ErrNotLoggedIn                          // 未登录或登录已过期
+	ErrVipRequired                          // 需要会员或单独购买
+	ErrRateLimited                          // 请求过于频繁或触发风控，稍后重试
+	ErrNetwork                              // 网络请求失败
+	ErrApi                                  // 接口返回了其他错误
+	ErrNotFound                             // 歌曲、流、混音器等不存在
+	ErrUnavailable                          // 歌曲无版权或已下架
+	ErrIO                                   // 读写本地文件失败
+	ErrDecode                               // 音频解码失败
+	ErrInternal                             // 其他内部错误
+)
+
+var errorCategoryNames = [...]string{
+	ErrNone:            "none",
+	ErrInvalidArgument: "invalid_argument",
+	ErrNotInitialized:  "not_initialized",
+	ErrNotLoggedIn:     "not_logged_in",
+	ErrVipRequired:     "vip_required",
+	ErrRateLimited:     "rate_limited",
+	ErrNetwork:         "network",
+	ErrApi:             "api",
+	ErrNotFound:        "not_found",
+	ErrUnavailable:     "unavailable",
+	ErrIO:              "io",
+	ErrDecode:          "decode",
+	ErrInternal:        "internal",
+}
+
+func (c ErrorCategory) String() string {
+	if c < 0 || int(c) >= len(errorCategoryNames) {
+		return errorCategoryNames[ErrInternal]
+	}
+	return errorCategoryNames[c]
+}
+
+// BridgeError 结构化错误（NeteaseGetLastErrorJson 返回的 JSON）
+type BridgeError struct {
+	Category  string `json:"category"`
+	Code      int    `json:"code"`              // ErrorCategory 的数值
+	ApiCode   int    `json:"apiCode,omitempty"` // 网易云接口返回的 code（有时）
+	Message   string `json:"message"`
+	Retryable bool   `json:"retryable"` // 稍后重试可能成功
+}
+
+func (e *BridgeError) Error() string {
+	return e.Message
+}
+
+// newError 创建指定分类的错误
+func newError(category ErrorCategory, message string) *BridgeError {
+	return &BridgeError{
+		Category:  category.String(),
+		Code:      int(category),
+		Message:   message,
+		Retryable: category == ErrNetwork || category == ErrRateLimited,
+	}
+}
+
+// newApiError 根据网易云接口返回的 code 创建错误
+func newApiError(apiCode float64, message string) *BridgeError {
+	code := int(apiCode)
+	category := ErrApi
+	switch code {
+	case 301, 302:
+		category = ErrNotLoggedIn
+	case 405, -460, -462:
+		// 405 操作频繁，-460/-462 触发风控（需要稍后或验证后重试）
+		category = ErrRateLimited
+	case 400:
+		category = ErrInvalidArgument
+	case 404:
+		category = ErrNotFound
+	}
+
+	err := newError(category, message)
+	err.ApiCode = code
+	if code >= 500 && code < 600 {
+		err.Retryable = true
+	}
+	return err
+}
+
+// asBridgeError 保留 err 中已有的分类，否则归为 fallback
+func asBridgeError(err error, fallback ErrorCategory) *BridgeError {
+	var bridgeErr *BridgeError
+	if errors.As(err, &bridgeErr) {
+		if bridgeErr.Message == err.Error() {
+			return bridgeErr
+		}
+		// 外层添加了说明，保留分类并使用完整的错误信息
+		wrapped := *bridgeErr
+		wrapped.Message = err.Error()
+		return &wrapped
+	}
+	return newError(fallback, err.Error())
+}
+
+// 每个调用线程各自的最近一次错误
+// C# 端从多个线程调用导出函数时互不覆盖；导出函数在调用方的线程上执行，因此可以按线程 ID 区分
+var (
+	lastErrorsMutex sync.Mutex
+	lastErrors      = make(map[uint64]*lastError)
+	lastErrorsClock uint64 // 每次记录或读取错误时递增
+)
+
+// lastError 线程最近一次的错误和最后一次记录或读取的时间（lastErrorsClock）
+type lastError struct {
+	err  *BridgeError
+	used uint64
+}
+
+// 线程数超过该值时淘汰最久没有记录或读取错误的线程（退出的线程留下的记录不会再被读取）
+const maxLastErrors = 256
+
+func currentThreadId() uint64 {
+	return uint64(C.bridgeThreadId())
+}
+
+// storeError 记录当前线程的错误
+func storeError(err *BridgeError) {
+	storeThreadError(currentThreadId(), err)
+}
+
+// storeThreadError 记录线程 id 的错误
+func storeThreadError(id uint64, err *BridgeError) {
+	lastErrorsMutex.Lock()
+	defer lastErrorsMutex.Unlock()
+	lastErrorsClock++
+	if entry, exists := lastErrors[id]; exists {
+		entry.err = err
+		entry.used = lastErrorsClock
+		return
+	}
+	if len(lastErrors) >= maxLastErrors {
+		evictLastErrorLocked()
+	}
+	lastErrors[id] = &lastError{err: err, used: lastErrorsClock}
+}
+
+// evictLastErrorLocked 删除最久没有使用的一条记录（调用方需持有 lastErrorsMutex）
+func evictLastErrorLocked() {
+	var oldestId uint64
+	var oldest *lastError
+	for id, entry := range lastErrors {
+		if oldest == nil || entry.used < oldest.used {
+			oldestId, oldest = id, entry
+		}
+	}
+	delete(lastErrors, oldestId)
+}
+
+// setError 记录当前线程的错误
+func setError(category ErrorCategory, message string) {
+	storeError(newError(category, message))
+}
+
+// setApiError 记录网易云接口返回的错误 code
+func setApiError(apiCode float64, message string) {
+	storeError(newApiError(apiCode, message))
+}
+
+// setErrorFrom 记录 err（已分类的错误保留原分类，否则归为 fallback）
+func setErrorFrom(err error, fallback ErrorCategory) {
+	storeError(asBridgeError(err, fallback))
+}
+
+// getLastError 获取当前线程的最近一次错误，没有时返回 nil
+func getLastError() *BridgeError {
+	return threadLastError(currentThreadId())
+}
+
+// threadLastError 获取线程 id 的最近一次错误
+func threadLastError(id uint64) *BridgeError {
+	lastErrorsMutex.Lock()
+	defer lastErrorsMutex.Unlock()
+	entry, ok := lastErrors[id]
+	if !ok {
+		return nil
+	}
+	lastErrorsClock++
+	entry.used = lastErrorsClock
+	return entry.err
+}
+
+// clearLastError 清除当前线程的错误
+func clearLastError() {
+	id := currentThreadId()
+	lastErrorsMutex.Lock()
+	defer lastErrorsMutex.Unlock()
+	delete(lastErrors, id)
+}
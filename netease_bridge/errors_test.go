@@ -0,0 +1,47 @@
+package main
+
+import "testing"
+
+func TestLastErrorsEvictLeastRecentlyUsed(t *testing.T) {
+	lastErrorsMutex.Lock()
+	saved := lastErrors
+	lastErrors = make(map[uint64]*lastError)
+	lastErrorsMutex.Unlock()
+	t.Cleanup(func() {
+		lastErrorsMutex.Lock()
+		lastErrors = saved
+		lastErrorsMutex.Unlock()
+	})
+
+	for id := uint64(1); id <= maxLastErrors; id++ {
+		storeThreadError(id, newError(ErrNetwork, "thread error"))
+	}
+	// 读取过的线程（1）和再次出错的线程（2）不会被淘汰
+	if threadLastError(1) == nil {
+		t.Fatal("thread 1 error missing")
+	}
+	storeThreadError(2, newError(ErrApi, "again"))
+
+	storeThreadError(1000, newError(ErrIO, "new thread"))
+	storeThreadError(1001, newError(ErrIO, "new thread"))
+
+	lastErrorsMutex.Lock()
+	count := len(lastErrors)
+	lastErrorsMutex.Unlock()
+	if count != maxLastErrors {
+		t.Fatalf("%d errors stored, want %d", count, maxLastErrors)
+	}
+	for _, id := range []uint64{3, 4} {
+		if threadLastError(id) != nil {
+			t.Fatalf("thread %d error not evicted", id)
+		}
+	}
+	for _, id := range []uint64{1, 2, 5, maxLastErrors, 1000, 1001} {
+		if threadLastError(id) == nil {
+			t.Fatalf("thread %d error evicted", id)
+		}
+	}
+	if err := threadLastError(2); err.Code != int(ErrApi) {
+		t.Fatalf("thread 2 error = %+v, want the latest one", err)
+	}
+}
@@ -17,20 +17,11 @@ import (
 
 	"github.com/buger/jsonparser"
 	"github.com/go-musicfox/go-musicfox/internal/storage"
-	"github.com/go-musicfox/go-musicfox/internal/structs"
 	"github.com/go-musicfox/go-musicfox/internal/netease"
 	"github.com/go-musicfox/netease-music/service"
-	"github.com/go-musicfox/netease-music/util"
-	"github.com/telanflow/cookiejar"
 )
 
-var (
-	initialized  bool
-	initMutex    sync.Mutex
-	currentUser  *structs.User
-	lastError    string
-	dataDir      string
-)
+var initMutex sync.Mutex
 
 // SongInfo 导出给 C# 的歌曲信息结构
 type SongInfo struct {
@@ -41,6 +32,10 @@ type SongInfo struct {
 	Album    string   `json:"album"`
 	AlbumID  int64    `json:"albumId"`
 	CoverUrl string   `json:"coverUrl"` // 封面 URL
+
+	// 离线时从本地歌曲库返回的列表中 Offline 为 true，Available 表示本地有可播放的文件
+	Offline   bool `json:"offline,omitempty"`
+	Available bool `json:"available,omitempty"`
 }
 
 // UserInfo 用户信息
@@ -55,7 +50,8 @@ type SongURL struct {
 	ID   int64  `json:"id"`
 	URL  string `json:"url"`
 	Size int64  `json:"size"`
-	Type string `json:"type"` // mp3, flac, etc.
+	Type string `json:"type"`          // mp3, flac, etc.
+	MD5  string `json:"md5,omitempty"` // 文件 MD5，下载完成后用于校验
 }
 
 //export NeteaseInit
@@ -63,16 +59,16 @@ func NeteaseInit(dataDirC *C.char) C.int {
 	initMutex.Lock()
 	defer initMutex.Unlock()
 
-	if initialized {
+	if getDefaultSession() != nil {
 		return 1 // 已初始化
 	}
 
-	dataDir = C.GoString(dataDirC)
+	dataDir := C.GoString(dataDirC)
 	if dataDir == "" {
 		// 使用默认路径
 		homeDir, err := os.UserHomeDir()
 		if err != nil {
-			lastError = "Failed to get home directory: " + err.Error()
+			setError(ErrIO, "Failed to get home directory: "+err.Error())
 			return 0
 		}
 		dataDir = filepath.Join(homeDir, "AppData", "Local", "go-musicfox")
@@ -80,46 +76,66 @@ func NeteaseInit(dataDirC *C.char) C.int {
 
 	// 确保目录存在
 	if err := os.MkdirAll(dataDir, 0755); err != nil {
-		lastError = "Failed to create data directory: " + err.Error()
+		setError(ErrIO, "Failed to create data directory: "+err.Error())
+		return 0
+	}
+
+	// 初始化持久化音频缓存
+	if err := initAudioCacheManager(dataDir); err != nil {
+		setError(ErrIO, "Failed to initialize audio cache: "+err.Error())
 		return 0
 	}
 
+	// 加载响度测量数据
+	initLoudnessStore(dataDir)
+
+	// 加载离线下载任务（未完成的任务处于暂停状态）
+	initDownloadManager(dataDir)
+
+	// 加载离线时使用的本地歌曲库
+	initOfflineLibrary(dataDir)
+
 	// 初始化数据库管理器
 	storage.DBManager = &storage.LocalDBManager{}
 
-	// 加载 Cookie
-	cookiePath := filepath.Join(dataDir, "cookie")
-	jar, err := cookiejar.NewFileJar(cookiePath, nil)
-	if err != nil {
-		lastError = "Failed to load cookie jar: " + err.Error()
+	// 创建默认会话（加载 Cookie 和用户信息）
+	if _, err := newSession(dataDir, true); err != nil {
+		setErrorFrom(err, ErrIO)
 		return 0
 	}
-	util.SetGlobalCookieJar(jar)
 
-	// 尝试加载用户信息
-	table := storage.NewTable()
-	if jsonStr, err := table.GetByKVModel(storage.User{}); err == nil {
-		if user, err := structs.NewUserFromLocalJson(jsonStr); err == nil {
-			currentUser = &user
-		}
-	}
-
-	initialized = true
 	return 1
 }
 
 //export NeteaseIsLoggedIn
 func NeteaseIsLoggedIn() C.int {
-	if currentUser != nil && currentUser.UserId > 0 {
-		return 1
+	return NeteaseSessionIsLoggedIn(0)
+}
+
+//export NeteaseSessionIsLoggedIn
+// NeteaseSessionIsLoggedIn 会话是否已登录（sessionHandle 为 0 表示默认会话，下同）
+func NeteaseSessionIsLoggedIn(sessionC C.longlong) C.int {
+	session := getSession(int64(sessionC))
+	if session == nil || session.currentUser() == nil {
+		return 0
 	}
-	return 0
+	return 1
 }
 
 //export NeteaseGetUserInfo
 func NeteaseGetUserInfo() *C.char {
+	return NeteaseSessionGetUserInfo(0)
+}
+
+//export NeteaseSessionGetUserInfo
+func NeteaseSessionGetUserInfo(sessionC C.longlong) *C.char {
+	session := getSession(int64(sessionC))
+	if session == nil {
+		return nil
+	}
+	currentUser := session.currentUser()
 	if currentUser == nil {
-		lastError = "Not logged in"
+		setError(ErrNotLoggedIn, "Not logged in")
 		return nil
 	}
 
@@ -131,7 +147,7 @@ func NeteaseGetUserInfo() *C.char {
 
 	jsonBytes, err := json.Marshal(info)
 	if err != nil {
-		lastError = "Failed to marshal user info: " + err.Error()
+		setError(ErrInternal, "Failed to marshal user info: "+err.Error())
 		return nil
 	}
 
@@ -140,48 +156,60 @@ func NeteaseGetUserInfo() *C.char {
 
 //export NeteaseRefreshLogin
 func NeteaseRefreshLogin() C.int {
-	if !initialized {
-		lastError = "Not initialized"
-		return 0
-	}
-
-	// 刷新登录状态
-	refreshService := service.LoginRefreshService{}
-	refreshService.LoginRefresh()
+	return NeteaseSessionRefreshLogin(0)
+}
 
-	// 获取账户信息
-	code, resp := (&service.UserAccountService{}).AccountInfo()
-	if code != 200 {
-		lastError = "Failed to get account info, code: " + strconv.FormatFloat(code, 'f', 0, 64)
+//export NeteaseSessionRefreshLogin
+func NeteaseSessionRefreshLogin(sessionC C.longlong) C.int {
+	session := getSession(int64(sessionC))
+	if session == nil {
 		return 0
 	}
+	defer session.lockApi()()
 
-	user, err := structs.NewUserFromJsonForLogin(resp)
-	if err != nil {
-		lastError = "Failed to parse user info: " + err.Error()
+	if err := session.refreshLogin(); err != nil {
+		setErrorFrom(err, ErrApi)
 		return 0
 	}
-	currentUser = &user
-
-	// 保存用户信息
-	table := storage.NewTable()
-	_ = table.SetByKVModel(storage.User{}, user)
-
 	return 1
 }
 
 //export NeteaseGetLikeSongs
 func NeteaseGetLikeSongs(getAll C.int) *C.char {
-	if currentUser == nil || currentUser.UserId == 0 {
-		lastError = "Not logged in"
+	return NeteaseSessionGetLikeSongs(0, getAll)
+}
+
+//export NeteaseSessionGetLikeSongs
+func NeteaseSessionGetLikeSongs(sessionC C.longlong, getAll C.int) *C.char {
+	session := getSession(int64(sessionC))
+	if session == nil {
 		return nil
 	}
+	currentUser := session.currentUser()
+	if currentUser == nil {
+		setError(ErrNotLoggedIn, "Not logged in")
+		return nil
+	}
+	userId := currentUser.UserId
+	offlineLikeSongs := func() (interface{}, bool) {
+		ids, ok := libraryLikeIds(userId)
+		return librarySongs(ids), ok
+	}
+	if offlineForced() {
+		return serveOffline(nil, offlineLikeSongs)
+	}
+	defer session.lockApi()()
 
-	songs, err := netease.FetchLikeSongs(currentUser.UserId, getAll != 0)
+	songs, err := netease.FetchLikeSongs(userId, getAll != 0)
 	if err != nil {
-		lastError = "Failed to fetch like songs: " + err.Error()
+		bridgeErr := newError(ErrNetwork, "Failed to fetch like songs: "+err.Error())
+		if markNetworkFailure(bridgeErr) {
+			return serveOffline(bridgeErr, offlineLikeSongs)
+		}
+		storeError(bridgeErr)
 		return nil
 	}
+	markNetworkOK()
 
 	// 转换为导出格式
 	result := make([]SongInfo, len(songs))
@@ -208,9 +236,16 @@ func NeteaseGetLikeSongs(getAll C.int) *C.char {
 		}
 	}
 
+	// 只有完整列表才替换本地记录的收藏
+	if getAll != 0 {
+		recordLikeSongs(userId, result)
+	} else {
+		recordSongs(result)
+	}
+
 	jsonBytes, err := json.Marshal(result)
 	if err != nil {
-		lastError = "Failed to marshal songs: " + err.Error()
+		setError(ErrInternal, "Failed to marshal songs: "+err.Error())
 		return nil
 	}
 
@@ -219,26 +254,50 @@ func NeteaseGetLikeSongs(getAll C.int) *C.char {
 
 //export NeteaseGetSongURL
 func NeteaseGetSongURL(songId C.longlong, quality *C.char) *C.char {
-	if !initialized {
-		lastError = "Not initialized"
+	return NeteaseSessionGetSongURL(0, songId, quality)
+}
+
+//export NeteaseSessionGetSongURL
+func NeteaseSessionGetSongURL(sessionC C.longlong, songId C.longlong, quality *C.char) *C.char {
+	session := getSession(int64(sessionC))
+	if session == nil {
 		return nil
 	}
 
-	qualityStr := C.GoString(quality)
+	result, err := session.resolveSongURL(int64(songId), C.GoString(quality))
+	if err != nil {
+		setErrorFrom(err, ErrNetwork)
+		return nil
+	}
+
+	jsonBytes, err := json.Marshal(result)
+	if err != nil {
+		setError(ErrInternal, "Failed to marshal URL: "+err.Error())
+		return nil
+	}
+
+	return C.CString(string(jsonBytes))
+}
+
+// resolveSongURL 获取歌曲播放地址（V1 接口优先，试听或失败时回退到旧接口）
+func (s *Session) resolveSongURL(songId int64, qualityStr string) (*SongURL, error) {
 	if qualityStr == "" {
 		qualityStr = "exhigh" // 默认极高音质
 	}
+	if s.isClosed() {
+		return nil, newError(ErrNotFound, "Session has been destroyed")
+	}
+	defer s.lockApi()()
 
 	// 首先尝试新 API (SongUrlV1Service) - 支持高品质
 	urlService := service.SongUrlV1Service{
-		ID:    strconv.FormatInt(int64(songId), 10),
+		ID:    strconv.FormatInt(songId, 10),
 		Level: service.SongQualityLevel(qualityStr),
 	}
 
 	code, resp, err := urlService.SongUrl()
 	if err != nil {
-		lastError = "Failed to get song URL: " + err.Error()
-		return nil
+		return nil, newError(ErrNetwork, "Failed to get song URL: "+err.Error())
 	}
 
 	// 解析响应并检查是否需要回退
@@ -248,6 +307,7 @@ func NeteaseGetSongURL(songId C.longlong, quality *C.char) *C.char {
 			URL           string      `json:"url"`
 			Size          int64       `json:"size"`
 			Type          string      `json:"type"`
+			MD5           string      `json:"md5"`
 			FreeTrialInfo interface{} `json:"freeTrialInfo"`
 		} `json:"data"`
 	}
@@ -256,6 +316,8 @@ func NeteaseGetSongURL(songId C.longlong, quality *C.char) *C.char {
 	var url string
 	var size int64
 	var musicType string
+	var md5 string
+	var unavailableCode, fee int // 回退接口返回的单曲 code 和收费类型
 
 	if code == 200 && err == nil {
 		if err := json.Unmarshal(resp, &v1Response); err == nil {
@@ -263,6 +325,7 @@ func NeteaseGetSongURL(songId C.longlong, quality *C.char) *C.char {
 				url = v1Response.Data[0].URL
 				size = v1Response.Data[0].Size
 				musicType = v1Response.Data[0].Type
+				md5 = v1Response.Data[0].MD5
 				// 检查是否是试听歌曲（需要会员）
 				if url == "" || v1Response.Data[0].FreeTrialInfo != nil {
 					needFallback = true
@@ -293,14 +356,13 @@ func NeteaseGetSongURL(songId C.longlong, quality *C.char) *C.char {
 		}
 
 		fallbackService := service.SongUrlService{
-			ID: strconv.FormatInt(int64(songId), 10),
+			ID: strconv.FormatInt(songId, 10),
 			Br: br,
 		}
 
 		code, resp = fallbackService.SongUrl()
 		if code != 200 {
-			lastError = "Fallback API returned code: " + strconv.FormatFloat(code, 'f', 0, 64)
-			return nil
+			return nil, newApiError(code, "Fallback API returned code: "+strconv.FormatFloat(code, 'f', 0, 64))
 		}
 
 		var fallbackResponse struct {
@@ -309,24 +371,36 @@ func NeteaseGetSongURL(songId C.longlong, quality *C.char) *C.char {
 				URL  string `json:"url"`
 				Size int64  `json:"size"`
 				Type string `json:"type"`
+				MD5  string `json:"md5"`
+				Code int    `json:"code"`
+				Fee  int    `json:"fee"`
 			} `json:"data"`
 		}
 
 		if err := json.Unmarshal(resp, &fallbackResponse); err != nil {
-			lastError = "Failed to parse fallback response: " + err.Error()
-			return nil
+			return nil, newError(ErrApi, "Failed to parse fallback response: "+err.Error())
 		}
 
 		if len(fallbackResponse.Data) > 0 {
 			url = fallbackResponse.Data[0].URL
 			size = fallbackResponse.Data[0].Size
 			musicType = fallbackResponse.Data[0].Type
+			md5 = fallbackResponse.Data[0].MD5
+			unavailableCode = fallbackResponse.Data[0].Code
+			fee = fallbackResponse.Data[0].Fee
 		}
 	}
 
 	if url == "" {
-		lastError = "No URL available for this song (tried both APIs)"
-		return nil
+		// fee: 1 = 会员歌曲, 4 = 需要购买专辑；其他情况一般是无版权
+		if fee == 1 || fee == 4 {
+			err := newError(ErrVipRequired, "No URL available for this song (VIP or purchase required)")
+			err.ApiCode = unavailableCode
+			return nil, err
+		}
+		err := newError(ErrUnavailable, "No URL available for this song (tried both APIs)")
+		err.ApiCode = unavailableCode
+		return nil, err
 	}
 
 	// 确保类型不为空
@@ -334,28 +408,42 @@ func NeteaseGetSongURL(songId C.longlong, quality *C.char) *C.char {
 		musicType = "mp3"
 	}
 
-	result := SongURL{
-		ID:   int64(songId),
+	return &SongURL{
+		ID:   songId,
 		URL:  url,
 		Size: size,
 		Type: musicType,
-	}
+		MD5:  md5,
+	}, nil
+}
 
-	jsonBytes, err := json.Marshal(result)
-	if err != nil {
-		lastError = "Failed to marshal URL: " + err.Error()
+//export NeteaseGetLastError
+// NeteaseGetLastError 获取当前线程最近一次错误的信息，没有错误时返回 NULL
+func NeteaseGetLastError() *C.char {
+	err := getLastError()
+	if err == nil {
 		return nil
 	}
-
-	return C.CString(string(jsonBytes))
+	return C.CString(err.Message)
 }
 
-//export NeteaseGetLastError
-func NeteaseGetLastError() *C.char {
-	if lastError == "" {
+//export NeteaseGetLastErrorJson
+// NeteaseGetLastErrorJson 获取当前线程最近一次错误的详细信息
+// 每个线程的错误单独保存，多个线程同时调用导出函数不会互相覆盖
+// 返回: JSON 字符串（BridgeError），没有错误时返回 NULL
+func NeteaseGetLastErrorJson() *C.char {
+	err := getLastError()
+	if err == nil {
 		return nil
 	}
-	return C.CString(lastError)
+	jsonBytes, _ := json.Marshal(err)
+	return C.CString(string(jsonBytes))
+}
+
+//export NeteaseClearLastError
+// NeteaseClearLastError 清除当前线程的错误（调用前清除可以区分本次调用的错误和之前遗留的错误）
+func NeteaseClearLastError() {
+	clearLastError()
 }
 
 //export NeteaseFreeString
@@ -367,22 +455,24 @@ func NeteaseFreeString(ptr *C.char) {
 
 //export NeteaseSetCookie
 func NeteaseSetCookie(cookieStr *C.char) C.int {
-	if !initialized {
-		lastError = "Not initialized"
+	return NeteaseSessionSetCookie(0, cookieStr)
+}
+
+//export NeteaseSessionSetCookie
+func NeteaseSessionSetCookie(sessionC C.longlong, cookieStr *C.char) C.int {
+	session := getSession(int64(sessionC))
+	if session == nil {
 		return 0
 	}
 
 	cookies, err := http.ParseCookie(C.GoString(cookieStr))
 	if err != nil {
-		lastError = "Failed to parse cookies: " + err.Error()
+		setError(ErrInvalidArgument, "Failed to parse cookies: "+err.Error())
 		return 0
 	}
 
-	jar := util.GetGlobalCookieJar()
-	if fileJar, ok := jar.(*cookiejar.Jar); ok {
-		u, _ := url.Parse("https://music.163.com")
-		fileJar.SetCookies(u, cookies)
-	}
+	u, _ := url.Parse("https://music.163.com")
+	session.jar.SetCookies(u, cookies)
 
 	return 1
 }
@@ -393,10 +483,16 @@ func NeteaseSetCookie(cookieStr *C.char) C.int {
 // like: 1 = 收藏, 0 = 取消收藏
 // 返回: 1 = 成功, 0 = 失败
 func NeteaseLikeSong(songId C.longlong, like C.int) C.int {
-	if !initialized {
-		lastError = "Not initialized"
+	return NeteaseSessionLikeSong(0, songId, like)
+}
+
+//export NeteaseSessionLikeSong
+func NeteaseSessionLikeSong(sessionC C.longlong, songId C.longlong, like C.int) C.int {
+	session := getSession(int64(sessionC))
+	if session == nil {
 		return 0
 	}
+	defer session.lockApi()()
 
 	likeStr := "true"
 	if like == 0 {
@@ -410,7 +506,7 @@ func NeteaseLikeSong(songId C.longlong, like C.int) C.int {
 
 	code, resp := likeService.Like()
 	if code != 200 {
-		lastError = "Like API returned code: " + strconv.FormatFloat(code, 'f', 0, 64)
+		setApiError(code, "Like API returned code: "+strconv.FormatFloat(code, 'f', 0, 64))
 		return 0
 	}
 
@@ -419,12 +515,12 @@ func NeteaseLikeSong(songId C.longlong, like C.int) C.int {
 		Code int64 `json:"code"`
 	}
 	if err := json.Unmarshal(resp, &response); err != nil {
-		lastError = "Failed to parse like response: " + err.Error()
+		setError(ErrApi, "Failed to parse like response: "+err.Error())
 		return 0
 	}
 
 	if response.Code != 200 {
-		lastError = "Like operation failed with code: " + strconv.FormatInt(response.Code, 10)
+		setApiError(float64(response.Code), "Like operation failed with code: "+strconv.FormatInt(response.Code, 10))
 		return 0
 	}
 
@@ -435,20 +531,43 @@ func NeteaseLikeSong(songId C.longlong, like C.int) C.int {
 // NeteaseGetLikeList 获取用户收藏的歌曲 ID 列表
 // 返回: JSON 数组字符串，包含收藏歌曲的 ID 列表
 func NeteaseGetLikeList() *C.char {
-	if currentUser == nil || currentUser.UserId == 0 {
-		lastError = "Not logged in"
+	return NeteaseSessionGetLikeList(0)
+}
+
+//export NeteaseSessionGetLikeList
+func NeteaseSessionGetLikeList(sessionC C.longlong) *C.char {
+	session := getSession(int64(sessionC))
+	if session == nil {
 		return nil
 	}
+	currentUser := session.currentUser()
+	if currentUser == nil {
+		setError(ErrNotLoggedIn, "Not logged in")
+		return nil
+	}
+	userId := currentUser.UserId
+	offlineLikeList := func() (interface{}, bool) {
+		return libraryLikeIds(userId)
+	}
+	if offlineForced() {
+		return serveOffline(nil, offlineLikeList)
+	}
+	defer session.lockApi()()
 
 	likeListService := service.LikeListService{
-		UID: strconv.FormatInt(currentUser.UserId, 10),
+		UID: strconv.FormatInt(userId, 10),
 	}
 
 	code, resp := likeListService.LikeList()
 	if code != 200 {
-		lastError = "LikeList API returned code: " + strconv.FormatFloat(code, 'f', 0, 64)
+		apiErr := newApiError(code, "LikeList API returned code: "+strconv.FormatFloat(code, 'f', 0, 64))
+		if markNetworkFailure(apiErr) {
+			return serveOffline(apiErr, offlineLikeList)
+		}
+		storeError(apiErr)
 		return nil
 	}
+	markNetworkOK()
 
 	// 解析响应获取 ids 数组
 	var response struct {
@@ -456,18 +575,20 @@ func NeteaseGetLikeList() *C.char {
 		Ids  []int64 `json:"ids"`
 	}
 	if err := json.Unmarshal(resp, &response); err != nil {
-		lastError = "Failed to parse like list response: " + err.Error()
+		setError(ErrApi, "Failed to parse like list response: "+err.Error())
 		return nil
 	}
 
 	if response.Code != 200 {
-		lastError = "LikeList operation failed with code: " + strconv.FormatInt(response.Code, 10)
+		setApiError(float64(response.Code), "LikeList operation failed with code: "+strconv.FormatInt(response.Code, 10))
 		return nil
 	}
 
+	recordLikeList(userId, response.Ids)
+
 	jsonBytes, err := json.Marshal(response.Ids)
 	if err != nil {
-		lastError = "Failed to marshal like list: " + err.Error()
+		setError(ErrInternal, "Failed to marshal like list: "+err.Error())
 		return nil
 	}
 
@@ -478,18 +599,36 @@ func NeteaseGetLikeList() *C.char {
 // NeteaseGetPersonalFM 获取个人 FM 推荐歌曲
 // 返回: JSON 数组字符串，包含推荐歌曲信息
 func NeteaseGetPersonalFM() *C.char {
-	if !initialized {
-		lastError = "Not initialized"
+	return NeteaseSessionGetPersonalFM(0)
+}
+
+//export NeteaseSessionGetPersonalFM
+func NeteaseSessionGetPersonalFM(sessionC C.longlong) *C.char {
+	session := getSession(int64(sessionC))
+	if session == nil {
 		return nil
 	}
+	// 离线时从推荐过的歌曲中选出本地可以播放的
+	offlineFM := func() (interface{}, bool) {
+		return libraryFM()
+	}
+	if offlineForced() {
+		return serveOffline(nil, offlineFM)
+	}
+	defer session.lockApi()()
 
 	fmService := service.PersonalFmService{}
 	code, resp := fmService.PersonalFm()
 
 	if code != 200 {
-		lastError = "PersonalFM API returned code: " + strconv.FormatFloat(code, 'f', 0, 64)
+		apiErr := newApiError(code, "PersonalFM API returned code: "+strconv.FormatFloat(code, 'f', 0, 64))
+		if markNetworkFailure(apiErr) {
+			return serveOffline(apiErr, offlineFM)
+		}
+		storeError(apiErr)
 		return nil
 	}
+	markNetworkOK()
 
 	// 解析响应
 	var response struct {
@@ -511,12 +650,12 @@ func NeteaseGetPersonalFM() *C.char {
 	}
 
 	if err := json.Unmarshal(resp, &response); err != nil {
-		lastError = "Failed to parse FM response: " + err.Error()
+		setError(ErrApi, "Failed to parse FM response: "+err.Error())
 		return nil
 	}
 
 	if response.Code != 200 {
-		lastError = "PersonalFM operation failed with code: " + strconv.FormatInt(response.Code, 10)
+		setApiError(float64(response.Code), "PersonalFM operation failed with code: "+strconv.FormatInt(response.Code, 10))
 		return nil
 	}
 
@@ -544,9 +683,11 @@ func NeteaseGetPersonalFM() *C.char {
 		}
 	}
 
+	recordFM(result)
+
 	jsonBytes, err := json.Marshal(result)
 	if err != nil {
-		lastError = "Failed to marshal FM songs: " + err.Error()
+		setError(ErrInternal, "Failed to marshal FM songs: "+err.Error())
 		return nil
 	}
 
@@ -558,10 +699,16 @@ func NeteaseGetPersonalFM() *C.char {
 // songId: 歌曲 ID
 // 返回: 1 = 成功, 0 = 失败
 func NeteaseFMTrash(songId C.longlong) C.int {
-	if !initialized {
-		lastError = "Not initialized"
+	return NeteaseSessionFMTrash(0, songId)
+}
+
+//export NeteaseSessionFMTrash
+func NeteaseSessionFMTrash(sessionC C.longlong, songId C.longlong) C.int {
+	session := getSession(int64(sessionC))
+	if session == nil {
 		return 0
 	}
+	defer session.lockApi()()
 
 	trashService := service.FmTrashService{
 		SongID: strconv.FormatInt(int64(songId), 10),
@@ -569,7 +716,7 @@ func NeteaseFMTrash(songId C.longlong) C.int {
 
 	code, resp := trashService.FmTrash()
 	if code != 200 {
-		lastError = "FMTrash API returned code: " + strconv.FormatFloat(code, 'f', 0, 64)
+		setApiError(code, "FMTrash API returned code: "+strconv.FormatFloat(code, 'f', 0, 64))
 		return 0
 	}
 
@@ -578,12 +725,12 @@ func NeteaseFMTrash(songId C.longlong) C.int {
 		Code int64 `json:"code"`
 	}
 	if err := json.Unmarshal(resp, &response); err != nil {
-		lastError = "Failed to parse FM trash response: " + err.Error()
+		setError(ErrApi, "Failed to parse FM trash response: "+err.Error())
 		return 0
 	}
 
 	if response.Code != 200 {
-		lastError = "FMTrash operation failed with code: " + strconv.FormatInt(response.Code, 10)
+		setApiError(float64(response.Code), "FMTrash operation failed with code: "+strconv.FormatInt(response.Code, 10))
 		return 0
 	}
 
@@ -605,44 +752,45 @@ type QRLoginState struct {
 	StatusMsg  string `json:"statusMsg"`  // 状态消息
 }
 
-var (
-	currentQRState *QRLoginState
-	qrMutex        sync.Mutex
-)
-
 //export NeteaseQRGetKey
 // NeteaseQRGetKey 获取二维码登录的 key 和 URL
 // 返回: JSON 字符串 {"uniKey": "xxx", "qrcodeUrl": "xxx"}
 func NeteaseQRGetKey() *C.char {
-	if !initialized {
-		lastError = "Not initialized"
+	return NeteaseSessionQRGetKey(0)
+}
+
+//export NeteaseSessionQRGetKey
+func NeteaseSessionQRGetKey(sessionC C.longlong) *C.char {
+	session := getSession(int64(sessionC))
+	if session == nil {
 		return nil
 	}
-
-	qrMutex.Lock()
-	defer qrMutex.Unlock()
+	defer session.lockApi()()
 
 	qrService := service.LoginQRService{}
 	code, _, qrcodeUrl, err := qrService.GetKey()
 	if err != nil {
-		lastError = "Failed to get QR key: " + err.Error()
+		setError(ErrNetwork, "Failed to get QR key: "+err.Error())
 		return nil
 	}
 	if code != 200 || qrcodeUrl == "" {
-		lastError = "Failed to get QR key, code: " + strconv.FormatFloat(code, 'f', 0, 64)
+		setApiError(code, "Failed to get QR key, code: "+strconv.FormatFloat(code, 'f', 0, 64))
 		return nil
 	}
 
-	currentQRState = &QRLoginState{
+	qrState := &QRLoginState{
 		UniKey:     qrService.UniKey,
 		QRCodeURL:  qrcodeUrl,
 		StatusCode: 801, // 等待扫码
 		StatusMsg:  "等待扫码",
 	}
+	session.mutex.Lock()
+	session.qrState = qrState
+	session.mutex.Unlock()
 
-	jsonBytes, err := json.Marshal(currentQRState)
+	jsonBytes, err := json.Marshal(qrState)
 	if err != nil {
-		lastError = "Failed to marshal QR state: " + err.Error()
+		setError(ErrInternal, "Failed to marshal QR state: "+err.Error())
 		return nil
 	}
 
@@ -654,23 +802,30 @@ func NeteaseQRGetKey() *C.char {
 // 返回: JSON 字符串 {"statusCode": xxx, "statusMsg": "xxx"}
 // statusCode: 800=失效, 801=等待扫码, 802=待确认, 803=成功
 func NeteaseQRCheckStatus() *C.char {
-	if !initialized {
-		lastError = "Not initialized"
+	return NeteaseSessionQRCheckStatus(0)
+}
+
+//export NeteaseSessionQRCheckStatus
+func NeteaseSessionQRCheckStatus(sessionC C.longlong) *C.char {
+	session := getSession(int64(sessionC))
+	if session == nil {
 		return nil
 	}
+	defer session.lockApi()()
 
-	qrMutex.Lock()
-	defer qrMutex.Unlock()
+	session.mutex.Lock()
+	qrState := session.qrState
+	session.mutex.Unlock()
 
-	if currentQRState == nil || currentQRState.UniKey == "" {
-		lastError = "QR key not initialized"
+	if qrState == nil || qrState.UniKey == "" {
+		setError(ErrInvalidArgument, "QR key not initialized")
 		return nil
 	}
 
-	qrService := service.LoginQRService{UniKey: currentQRState.UniKey}
+	qrService := service.LoginQRService{UniKey: qrState.UniKey}
 	code, _, err := qrService.CheckQR()
 	if err != nil {
-		lastError = "Failed to check QR status: " + err.Error()
+		setError(ErrNetwork, "Failed to check QR status: "+err.Error())
 		return nil
 	}
 
@@ -679,7 +834,7 @@ func NeteaseQRCheckStatus() *C.char {
 	switch statusCode {
 	case 800:
 		statusMsg = "二维码已失效"
-		currentQRState = nil // 清除状态
+		session.clearQRState(qrState)
 	case 801:
 		statusMsg = "等待扫码"
 	case 802:
@@ -687,12 +842,13 @@ func NeteaseQRCheckStatus() *C.char {
 	case 803:
 		statusMsg = "登录成功"
 		// 登录成功后获取用户信息
-		if NeteaseRefreshLogin() == 1 {
+		if err := session.refreshLogin(); err == nil {
 			statusMsg = "登录成功"
 		} else {
+			setErrorFrom(err, ErrApi)
 			statusMsg = "登录成功，但获取用户信息失败"
 		}
-		currentQRState = nil // 清除状态
+		session.clearQRState(qrState)
 	default:
 		statusMsg = "未知状态: " + strconv.Itoa(statusCode)
 	}
@@ -704,7 +860,7 @@ func NeteaseQRCheckStatus() *C.char {
 
 	jsonBytes, err := json.Marshal(result)
 	if err != nil {
-		lastError = "Failed to marshal QR status: " + err.Error()
+		setError(ErrInternal, "Failed to marshal QR status: "+err.Error())
 		return nil
 	}
 
@@ -714,9 +870,16 @@ func NeteaseQRCheckStatus() *C.char {
 //export NeteaseQRCancelLogin
 // NeteaseQRCancelLogin 取消二维码登录
 func NeteaseQRCancelLogin() {
-	qrMutex.Lock()
-	defer qrMutex.Unlock()
-	currentQRState = nil
+	NeteaseSessionQRCancelLogin(0)
+}
+
+//export NeteaseSessionQRCancelLogin
+func NeteaseSessionQRCancelLogin(sessionC C.longlong) {
+	if session := getSession(int64(sessionC)); session != nil {
+		session.mutex.Lock()
+		session.qrState = nil
+		session.mutex.Unlock()
+	}
 }
 
 // PlaylistInfo 歌单信息
@@ -728,34 +891,71 @@ type PlaylistInfo struct {
 	CreatorId int64  `json:"creatorId"`
 }
 
+// PlaylistPage 用户歌单列表的一页
+type PlaylistPage struct {
+	Playlists []PlaylistInfo `json:"playlists"`
+	HasMore   bool           `json:"hasMore"`
+	Offline   bool           `json:"offline,omitempty"` // 从本地歌曲库返回
+}
+
+// PlaylistDetail 歌单信息和歌曲
+type PlaylistDetail struct {
+	PlaylistInfo
+	Songs   []SongInfo `json:"songs"`
+	Offline bool       `json:"offline,omitempty"` // 从本地歌曲库返回
+}
+
 //export NeteaseGetUserPlaylists
 // NeteaseGetUserPlaylists 获取用户歌单列表
 // limit: 每页数量 (0 使用默认值 30)
 // offset: 偏移量
 // 返回: JSON 数组字符串，包含歌单信息和是否有更多 {"playlists": [...], "hasMore": bool}
 func NeteaseGetUserPlaylists(limit C.int, offset C.int) *C.char {
-	if currentUser == nil || currentUser.UserId == 0 {
-		lastError = "Not logged in"
+	return NeteaseSessionGetUserPlaylists(0, limit, offset)
+}
+
+//export NeteaseSessionGetUserPlaylists
+func NeteaseSessionGetUserPlaylists(sessionC C.longlong, limit C.int, offset C.int) *C.char {
+	session := getSession(int64(sessionC))
+	if session == nil {
+		return nil
+	}
+	currentUser := session.currentUser()
+	if currentUser == nil {
+		setError(ErrNotLoggedIn, "Not logged in")
 		return nil
 	}
-
 	limitVal := int(limit)
 	if limitVal <= 0 {
 		limitVal = 30
 	}
 	offsetVal := int(offset)
 
+	userId := currentUser.UserId
+	offlinePlaylists := func() (interface{}, bool) {
+		return libraryUserPlaylists(userId, limitVal, offsetVal)
+	}
+	if offlineForced() {
+		return serveOffline(nil, offlinePlaylists)
+	}
+	defer session.lockApi()()
+
 	// 直接使用 service API 获取更完整的歌单信息
 	userPlaylists := service.UserPlaylistService{
-		Uid:    strconv.FormatInt(currentUser.UserId, 10),
+		Uid:    strconv.FormatInt(userId, 10),
 		Limit:  strconv.Itoa(limitVal),
 		Offset: strconv.Itoa(offsetVal),
 	}
 	code, response := userPlaylists.UserPlaylist()
 	if code != 200 {
-		lastError = "UserPlaylist API returned code: " + strconv.FormatFloat(code, 'f', 0, 64)
+		apiErr := newApiError(code, "UserPlaylist API returned code: "+strconv.FormatFloat(code, 'f', 0, 64))
+		if markNetworkFailure(apiErr) {
+			return serveOffline(apiErr, offlinePlaylists)
+		}
+		storeError(apiErr)
 		return nil
 	}
+	markNetworkOK()
 
 	// 解析歌单数组
 	var playlists []PlaylistInfo
@@ -782,17 +982,16 @@ func NeteaseGetUserPlaylists(limit C.int, offset C.int) *C.char {
 	// 获取是否有更多
 	hasMore, _ := jsonparser.GetBoolean(response, "more")
 
-	result := struct {
-		Playlists []PlaylistInfo `json:"playlists"`
-		HasMore   bool           `json:"hasMore"`
-	}{
+	recordUserPlaylists(userId, offsetVal, playlists, hasMore)
+
+	result := PlaylistPage{
 		Playlists: playlists,
 		HasMore:   hasMore,
 	}
 
 	jsonBytes, err := json.Marshal(result)
 	if err != nil {
-		lastError = "Failed to marshal playlists: " + err.Error()
+		setError(ErrInternal, "Failed to marshal playlists: "+err.Error())
 		return nil
 	}
 
@@ -804,10 +1003,23 @@ func NeteaseGetUserPlaylists(limit C.int, offset C.int) *C.char {
 // playlistId: 歌单 ID
 // 返回: JSON 字符串，包含歌单信息 {"id", "name", "songCount", "coverUrl", "creatorId", "songs": [...]}
 func NeteaseGetPlaylistDetail(playlistId C.longlong) *C.char {
-	if !initialized {
-		lastError = "Not initialized"
+	return NeteaseSessionGetPlaylistDetail(0, playlistId)
+}
+
+//export NeteaseSessionGetPlaylistDetail
+func NeteaseSessionGetPlaylistDetail(sessionC C.longlong, playlistId C.longlong) *C.char {
+	session := getSession(int64(sessionC))
+	if session == nil {
 		return nil
 	}
+	offlineDetail := func() (interface{}, bool) {
+		info, songs, ok := libraryPlaylist(int64(playlistId))
+		return PlaylistDetail{PlaylistInfo: info, Songs: songs, Offline: true}, ok
+	}
+	if offlineForced() {
+		return serveOffline(nil, offlineDetail)
+	}
+	defer session.lockApi()()
 
 	// 调用歌单详情 API
 	playlistDetail := service.PlaylistDetailService{
@@ -815,19 +1027,17 @@ func NeteaseGetPlaylistDetail(playlistId C.longlong) *C.char {
 	}
 	code, response := playlistDetail.PlaylistDetail()
 	if code != 200 {
-		lastError = "PlaylistDetail API returned code: " + strconv.FormatFloat(code, 'f', 0, 64)
+		apiErr := newApiError(code, "PlaylistDetail API returned code: "+strconv.FormatFloat(code, 'f', 0, 64))
+		if markNetworkFailure(apiErr) {
+			return serveOffline(apiErr, offlineDetail)
+		}
+		storeError(apiErr)
 		return nil
 	}
+	markNetworkOK()
 
 	// 解析歌单基本信息
-	var result struct {
-		ID        int64      `json:"id"`
-		Name      string     `json:"name"`
-		SongCount int        `json:"songCount"`
-		CoverUrl  string     `json:"coverUrl"`
-		CreatorId int64      `json:"creatorId"`
-		Songs     []SongInfo `json:"songs"`
-	}
+	var result PlaylistDetail
 
 	if id, err := jsonparser.GetInt(response, "playlist", "id"); err == nil {
 		result.ID = id
@@ -879,9 +1089,12 @@ func NeteaseGetPlaylistDetail(playlistId C.longlong) *C.char {
 		result.Songs = append(result.Songs, song)
 	}, "playlist", "tracks")
 
+	// 详情接口只返回部分歌曲时不替换本地记录的歌曲列表
+	recordPlaylist(&result.PlaylistInfo, result.ID, result.Songs, len(result.Songs) >= result.SongCount)
+
 	jsonBytes, err := json.Marshal(result)
 	if err != nil {
-		lastError = "Failed to marshal playlist detail: " + err.Error()
+		setError(ErrInternal, "Failed to marshal playlist detail: "+err.Error())
 		return nil
 	}
 
@@ -894,16 +1107,41 @@ func NeteaseGetPlaylistDetail(playlistId C.longlong) *C.char {
 // getAll: 1 = 获取全部歌曲, 0 = 只获取第一页
 // 返回: JSON 数组字符串，包含歌曲信息
 func NeteaseGetPlaylistSongs(playlistId C.longlong, getAll C.int) *C.char {
-	if !initialized {
-		lastError = "Not initialized"
+	return NeteaseSessionGetPlaylistSongs(0, playlistId, getAll)
+}
+
+//export NeteaseSessionGetPlaylistSongs
+func NeteaseSessionGetPlaylistSongs(sessionC C.longlong, playlistId C.longlong, getAll C.int) *C.char {
+	session := getSession(int64(sessionC))
+	if session == nil {
 		return nil
 	}
+	offlineSongs := func() (interface{}, bool) {
+		_, songs, ok := libraryPlaylist(int64(playlistId))
+		return songs, ok
+	}
+	if offlineForced() {
+		return serveOffline(nil, offlineSongs)
+	}
+	defer session.lockApi()()
 
 	codeType, songs := netease.FetchSongsOfPlaylist(int64(playlistId), getAll == 1)
 	if codeType != 0 { // Success = 0
-		lastError = "FetchSongsOfPlaylist failed with code: " + strconv.Itoa(int(codeType))
+		category := ErrApi
+		switch codeType {
+		case 1: // NetworkError
+			category = ErrNetwork
+		case 2: // NeedLogin
+			category = ErrNotLoggedIn
+		}
+		bridgeErr := newError(category, "FetchSongsOfPlaylist failed with code: "+strconv.Itoa(int(codeType)))
+		if markNetworkFailure(bridgeErr) {
+			return serveOffline(bridgeErr, offlineSongs)
+		}
+		storeError(bridgeErr)
 		return nil
 	}
+	markNetworkOK()
 
 	// 转换为 SongInfo 格式
 	result := make([]SongInfo, len(songs))
@@ -929,9 +1167,11 @@ func NeteaseGetPlaylistSongs(playlistId C.longlong, getAll C.int) *C.char {
 		}
 	}
 
+	recordPlaylist(nil, int64(playlistId), result, getAll == 1)
+
 	jsonBytes, err := json.Marshal(result)
 	if err != nil {
-		lastError = "Failed to marshal playlist songs: " + err.Error()
+		setError(ErrInternal, "Failed to marshal playlist songs: "+err.Error())
 		return nil
 	}
 
@@ -943,14 +1183,24 @@ func NeteaseGetPlaylistSongs(playlistId C.longlong, getAll C.int) *C.char {
 // keyword: 搜索关键词 (支持 | 分隔多个关键词)
 // 返回: JSON 数组字符串，包含匹配的歌单信息
 func NeteaseSearchPlaylistsByKeyword(keywordC *C.char) *C.char {
-	if currentUser == nil || currentUser.UserId == 0 {
-		lastError = "Not logged in"
+	return NeteaseSessionSearchPlaylistsByKeyword(0, keywordC)
+}
+
+//export NeteaseSessionSearchPlaylistsByKeyword
+func NeteaseSessionSearchPlaylistsByKeyword(sessionC C.longlong, keywordC *C.char) *C.char {
+	session := getSession(int64(sessionC))
+	if session == nil {
+		return nil
+	}
+	currentUser := session.currentUser()
+	if currentUser == nil {
+		setError(ErrNotLoggedIn, "Not logged in")
 		return nil
 	}
 
 	keyword := C.GoString(keywordC)
 	if keyword == "" {
-		lastError = "Keyword is empty"
+		setError(ErrInvalidArgument, "Keyword is empty")
 		return nil
 	}
 
@@ -963,11 +1213,12 @@ func NeteaseSearchPlaylistsByKeyword(keywordC *C.char) *C.char {
 	}
 
 	if len(keywords) == 0 {
-		lastError = "No valid keywords"
+		setError(ErrInvalidArgument, "No valid keywords")
 		return nil
 	}
 
 	// 获取所有歌单并匹配 - 直接使用 API
+	defer session.lockApi()()
 	var matchedPlaylists []PlaylistInfo
 	offset := 0
 	for {
@@ -1016,7 +1267,7 @@ func NeteaseSearchPlaylistsByKeyword(keywordC *C.char) *C.char {
 
 	jsonBytes, err := json.Marshal(matchedPlaylists)
 	if err != nil {
-		lastError = "Failed to marshal matched playlists: " + err.Error()
+		setError(ErrInternal, "Failed to marshal matched playlists: "+err.Error())
 		return nil
 	}
 
@@ -0,0 +1,507 @@
+package main
+
+/*
+#include <stdlib.h>
+*/
+import "C"
+import (
+	"encoding/json"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 离线模式（NeteaseSetOfflineMode）
+const (
+	OfflineModeAuto   = 0 // 正常联网，网络请求失败时使用本地数据（默认）
+	OfflineModeAlways = 1 // 始终离线，不请求网络
+)
+
+const (
+	maxFMHistory     = 500             // 本地歌曲库最多记录的 FM 推荐歌曲数量
+	offlineFMBatch   = 3               // 离线时每次返回的 FM 歌曲数量（与接口相同）
+	librarySaveDelay = 2 * time.Second // 歌曲库修改后延迟保存，合并短时间内的多次修改
+)
+
+// offlinePlaylist 本地记录的歌单
+type offlinePlaylist struct {
+	Info    PlaylistInfo `json:"info"`
+	SongIds []int64      `json:"songIds,omitempty"` // 只在获取到完整歌曲列表后记录
+}
+
+// offlineLibrary 联网时记录的歌曲信息、收藏、歌单和 FM 推荐，离线时用来返回列表
+// 保存在 dataDir/library.json
+type offlineLibrary struct {
+	Songs         map[int64]SongInfo         `json:"songs"`
+	Likes         map[int64][]int64          `json:"likes"`         // 用户 ID -> 收藏的歌曲（与接口返回的顺序相同）
+	UserPlaylists map[int64][]PlaylistInfo   `json:"userPlaylists"` // 用户 ID -> 歌单列表
+	Playlists     map[int64]*offlinePlaylist `json:"playlists"`
+	FMHistory     []int64                    `json:"fmHistory"` // 最新的在前
+}
+
+// OfflineStatus 返回给 C# 的离线状态
+type OfflineStatus struct {
+	Mode             int    `json:"mode"`
+	Offline          bool   `json:"offline"` // 强制离线，或最近一次网络请求失败
+	LastNetworkError string `json:"lastNetworkError,omitempty"`
+	LibrarySongs     int    `json:"librarySongs"` // 本地歌曲库中的歌曲数量
+}
+
+var (
+	offlineMutex     sync.Mutex
+	offlineMode      = OfflineModeAuto
+	networkDown      bool // 最近一次网络请求失败（下一次请求成功时恢复）
+	lastNetworkError string
+	library          = newOfflineLibrary()
+	libraryPath      string
+	libraryDirty     bool        // 有未保存的修改
+	librarySaveTimer *time.Timer // 等待中的延迟保存
+	libraryFileMutex sync.Mutex  // 保证写文件的顺序（写文件时不持有 offlineMutex）
+)
+
+func newOfflineLibrary() *offlineLibrary {
+	return &offlineLibrary{
+		Songs:         make(map[int64]SongInfo),
+		Likes:         make(map[int64][]int64),
+		UserPlaylists: make(map[int64][]PlaylistInfo),
+		Playlists:     make(map[int64]*offlinePlaylist),
+	}
+}
+
+// initOfflineLibrary 加载本地歌曲库
+func initOfflineLibrary(dataDir string) {
+	offlineMutex.Lock()
+	defer offlineMutex.Unlock()
+
+	libraryPath = filepath.Join(dataDir, "library.json")
+	data, err := os.ReadFile(libraryPath)
+	if err != nil {
+		return
+	}
+	loaded := newOfflineLibrary()
+	if err := json.Unmarshal(data, loaded); err != nil {
+		return
+	}
+	library = newOfflineLibrary()
+	for id, song := range loaded.Songs {
+		library.Songs[id] = song
+	}
+	for id, ids := range loaded.Likes {
+		library.Likes[id] = ids
+	}
+	for id, playlists := range loaded.UserPlaylists {
+		library.UserPlaylists[id] = playlists
+	}
+	for id, playlist := range loaded.Playlists {
+		if playlist != nil {
+			library.Playlists[id] = playlist
+		}
+	}
+	library.FMHistory = loaded.FMHistory
+}
+
+// saveLibraryLocked 标记本地歌曲库已修改，由后台在 librarySaveDelay 之后保存（调用方需持有 offlineMutex）
+// 完整的收藏和歌单列表在释放 offlineMutex 后调用 flushLibrary 立即保存，避免退出时丢失
+func saveLibraryLocked() {
+	if libraryPath == "" {
+		return
+	}
+	libraryDirty = true
+	if librarySaveTimer == nil {
+		librarySaveTimer = time.AfterFunc(librarySaveDelay, flushLibrary)
+	}
+}
+
+// flushLibrary 清理没有被引用的歌曲并保存本地歌曲库
+func flushLibrary() {
+	libraryFileMutex.Lock()
+	defer libraryFileMutex.Unlock()
+
+	offlineMutex.Lock()
+	if librarySaveTimer != nil {
+		librarySaveTimer.Stop()
+		librarySaveTimer = nil
+	}
+	if !libraryDirty {
+		offlineMutex.Unlock()
+		return
+	}
+	libraryDirty = false
+	pruneLibraryLocked()
+	data, err := json.Marshal(library)
+	path := libraryPath
+	offlineMutex.Unlock()
+	if err != nil {
+		return
+	}
+
+	// 先写临时文件再重命名，避免写到一半时崩溃导致歌曲库损坏
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return
+	}
+	os.Rename(tmpPath, path)
+}
+
+// pruneLibraryLocked 删除没有被歌单、收藏或 FM 记录引用的歌曲（调用方需持有 offlineMutex）
+func pruneLibraryLocked() {
+	referenced := make(map[int64]bool, len(library.Songs))
+	for _, ids := range library.Likes {
+		for _, id := range ids {
+			referenced[id] = true
+		}
+	}
+	for _, playlist := range library.Playlists {
+		for _, id := range playlist.SongIds {
+			referenced[id] = true
+		}
+	}
+	for _, id := range library.FMHistory {
+		referenced[id] = true
+	}
+	for id := range library.Songs {
+		if !referenced[id] {
+			delete(library.Songs, id)
+		}
+	}
+}
+
+// offlineForced 是否处于强制离线模式
+func offlineForced() bool {
+	offlineMutex.Lock()
+	defer offlineMutex.Unlock()
+	return offlineMode == OfflineModeAlways
+}
+
+// networkFailure 错误是否由网络不可用引起（请求失败，或接口库在请求失败时返回的 5xx）
+func networkFailure(err *BridgeError) bool {
+	if err == nil {
+		return false
+	}
+	return err.Code == int(ErrNetwork) || (err.ApiCode >= 500 && err.ApiCode < 600)
+}
+
+// markNetworkFailure 网络请求失败时调用，返回 true 表示应该使用本地数据
+func markNetworkFailure(err *BridgeError) bool {
+	if !networkFailure(err) {
+		return false
+	}
+	offlineMutex.Lock()
+	networkDown = true
+	lastNetworkError = err.Message
+	offlineMutex.Unlock()
+	return true
+}
+
+// markNetworkOK 网络请求成功时调用
+func markNetworkOK() {
+	offlineMutex.Lock()
+	networkDown = false
+	lastNetworkError = ""
+	offlineMutex.Unlock()
+}
+
+// offlineSongSet 本地有可播放文件（缓存或离线下载）的歌曲
+func offlineSongSet() map[int64]bool {
+	available := make(map[int64]bool)
+	if audioCacheManager != nil {
+		for _, id := range audioCacheManager.SongIds() {
+			available[id] = true
+		}
+	}
+	for _, id := range downloadedSongIds() {
+		available[id] = true
+	}
+	return available
+}
+
+// acquireOfflineAudio 网络不可用时查找歌曲的本地文件：先找缓存中的其他音质，再找离线下载的文件
+// 请求的音质已经由调用方查找过，没有则返回 nil
+func acquireOfflineAudio(songId int64) *AudioCache {
+	if audioCacheManager != nil {
+		if cache := audioCacheManager.AcquireAnyQuality(songId); cache != nil {
+			return cache
+		}
+	}
+
+	path := downloadedSongPath(songId)
+	if path == "" {
+		return nil
+	}
+	format := strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	if !aacDecodingAvailable && audioFormatFromType(format) == FormatAAC {
+		// 下载的 m4a 文件在没有 AAC 解码器的构建中无法播放
+		return nil
+	}
+	cache := newCompleteAudioCache(path, fileSize(path))
+	cache.songId = songId
+	cache.format = format
+	cache.external = true
+	return cache
+}
+
+// recordSongsLocked 记录歌曲信息（调用方需持有 offlineMutex）
+func recordSongsLocked(songs []SongInfo) []int64 {
+	ids := make([]int64, len(songs))
+	for i, song := range songs {
+		song.Offline = false
+		song.Available = false
+		library.Songs[song.ID] = song
+		ids[i] = song.ID
+	}
+	return ids
+}
+
+// recordSongs 记录歌曲信息
+func recordSongs(songs []SongInfo) {
+	offlineMutex.Lock()
+	defer offlineMutex.Unlock()
+	recordSongsLocked(songs)
+	saveLibraryLocked()
+}
+
+// recordLikeSongs 记录用户完整的收藏歌曲
+func recordLikeSongs(userId int64, songs []SongInfo) {
+	offlineMutex.Lock()
+	library.Likes[userId] = recordSongsLocked(songs)
+	saveLibraryLocked()
+	offlineMutex.Unlock()
+	flushLibrary()
+}
+
+// recordLikeList 记录用户收藏的歌曲 ID
+func recordLikeList(userId int64, ids []int64) {
+	offlineMutex.Lock()
+	defer offlineMutex.Unlock()
+	library.Likes[userId] = append([]int64(nil), ids...)
+	saveLibraryLocked()
+}
+
+// recordUserPlaylists 记录用户歌单列表的一页（与已记录的列表不连续时跳过）
+func recordUserPlaylists(userId int64, offset int, playlists []PlaylistInfo, hasMore bool) {
+	offlineMutex.Lock()
+	defer offlineMutex.Unlock()
+
+	stored := library.UserPlaylists[userId]
+	if offset > len(stored) {
+		return
+	}
+	merged := append([]PlaylistInfo(nil), stored[:offset]...)
+	merged = append(merged, playlists...)
+	if hasMore && offset+len(playlists) < len(stored) {
+		merged = append(merged, stored[offset+len(playlists):]...)
+	}
+	library.UserPlaylists[userId] = merged
+	for _, info := range playlists {
+		if playlist, ok := library.Playlists[info.ID]; ok {
+			playlist.Info = info
+		} else {
+			library.Playlists[info.ID] = &offlinePlaylist{Info: info}
+		}
+	}
+	saveLibraryLocked()
+}
+
+// recordPlaylist 记录歌单信息和歌曲，complete 为 false 时只记录歌曲信息，不替换已记录的歌曲列表
+func recordPlaylist(info *PlaylistInfo, playlistId int64, songs []SongInfo, complete bool) {
+	offlineMutex.Lock()
+	ids := recordSongsLocked(songs)
+	playlist, ok := library.Playlists[playlistId]
+	if !ok {
+		playlist = &offlinePlaylist{Info: PlaylistInfo{ID: playlistId}}
+		library.Playlists[playlistId] = playlist
+	}
+	if info != nil {
+		playlist.Info = *info
+	}
+	if complete {
+		playlist.SongIds = ids
+	}
+	saveLibraryLocked()
+	offlineMutex.Unlock()
+
+	if complete {
+		flushLibrary()
+	}
+}
+
+// recordFM 记录 FM 推荐的歌曲
+func recordFM(songs []SongInfo) {
+	offlineMutex.Lock()
+	defer offlineMutex.Unlock()
+
+	ids := recordSongsLocked(songs)
+	history := append([]int64(nil), ids...)
+	seen := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		seen[id] = true
+	}
+	for _, id := range library.FMHistory {
+		if !seen[id] && len(history) < maxFMHistory {
+			seen[id] = true
+			history = append(history, id)
+		}
+	}
+	library.FMHistory = history
+	saveLibraryLocked()
+}
+
+// librarySongs 按 ID 取出本地记录的歌曲并标记为离线（跳过没有记录的歌曲）
+func librarySongs(ids []int64) []SongInfo {
+	offlineMutex.Lock()
+	songs := make([]SongInfo, 0, len(ids))
+	for _, id := range ids {
+		if song, ok := library.Songs[id]; ok {
+			songs = append(songs, song)
+		}
+	}
+	offlineMutex.Unlock()
+
+	available := offlineSongSet()
+	for i := range songs {
+		songs[i].Offline = true
+		songs[i].Available = available[songs[i].ID]
+	}
+	return songs
+}
+
+// libraryLikeIds 本地记录的用户收藏歌曲 ID
+func libraryLikeIds(userId int64) ([]int64, bool) {
+	offlineMutex.Lock()
+	defer offlineMutex.Unlock()
+	ids, ok := library.Likes[userId]
+	return append([]int64{}, ids...), ok
+}
+
+// libraryPlaylist 本地记录的歌单信息和歌曲
+func libraryPlaylist(playlistId int64) (PlaylistInfo, []SongInfo, bool) {
+	offlineMutex.Lock()
+	playlist, ok := library.Playlists[playlistId]
+	if !ok || playlist.SongIds == nil {
+		offlineMutex.Unlock()
+		return PlaylistInfo{}, nil, false
+	}
+	info := playlist.Info
+	ids := append([]int64(nil), playlist.SongIds...)
+	offlineMutex.Unlock()
+
+	return info, librarySongs(ids), true
+}
+
+// libraryUserPlaylists 本地记录的用户歌单列表的一页
+func libraryUserPlaylists(userId int64, limit, offset int) (PlaylistPage, bool) {
+	offlineMutex.Lock()
+	defer offlineMutex.Unlock()
+
+	stored, ok := library.UserPlaylists[userId]
+	if !ok {
+		return PlaylistPage{}, false
+	}
+	page := PlaylistPage{Playlists: []PlaylistInfo{}, Offline: true}
+	if offset < len(stored) {
+		end := offset + limit
+		if end > len(stored) {
+			end = len(stored)
+		}
+		page.Playlists = append(page.Playlists, stored[offset:end]...)
+		page.HasMore = end < len(stored)
+	}
+	return page, true
+}
+
+// libraryFM 从 FM 历史中随机选出本地可以播放的歌曲
+func libraryFM() ([]SongInfo, bool) {
+	offlineMutex.Lock()
+	history := append([]int64(nil), library.FMHistory...)
+	offlineMutex.Unlock()
+
+	available := offlineSongSet()
+	var ids []int64
+	for _, id := range history {
+		if available[id] {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, false
+	}
+	rand.Shuffle(len(ids), func(i, j int) { ids[i], ids[j] = ids[j], ids[i] })
+	if len(ids) > offlineFMBatch {
+		ids = ids[:offlineFMBatch]
+	}
+	return librarySongs(ids), true
+}
+
+// serveOffline 强制离线或网络不可用时返回本地数据的 JSON
+// err 为网络请求的错误（强制离线时为 nil）；本地没有数据时记录 err 并返回 nil
+func serveOffline(err *BridgeError, local func() (interface{}, bool)) *C.char {
+	if err == nil {
+		err = newError(ErrNetwork, "Not available offline")
+	}
+	value, ok := local()
+	if !ok {
+		storeError(err)
+		return nil
+	}
+	jsonBytes, marshalErr := json.Marshal(value)
+	if marshalErr != nil {
+		setError(ErrInternal, "Failed to marshal offline data: "+marshalErr.Error())
+		return nil
+	}
+	return C.CString(string(jsonBytes))
+}
+
+//export NeteaseSetOfflineMode
+// NeteaseSetOfflineMode 设置离线模式
+// mode: 0 = 自动（网络请求失败时使用本地数据）, 1 = 始终离线
+// 返回: 0 = 成功, -1 = 参数错误
+func NeteaseSetOfflineMode(modeC C.int) C.int {
+	mode := int(modeC)
+	if mode != OfflineModeAuto && mode != OfflineModeAlways {
+		setError(ErrInvalidArgument, "Invalid offline mode")
+		return -1
+	}
+	offlineMutex.Lock()
+	offlineMode = mode
+	if mode == OfflineModeAuto {
+		// 重新联网后由下一次请求判断网络是否可用
+		networkDown = false
+		lastNetworkError = ""
+	}
+	offlineMutex.Unlock()
+	return 0
+}
+
+//export NeteaseGetOfflineStatus
+// NeteaseGetOfflineStatus 获取离线状态
+// 返回: JSON 字符串（OfflineStatus）
+func NeteaseGetOfflineStatus() *C.char {
+	offlineMutex.Lock()
+	status := OfflineStatus{
+		Mode:             offlineMode,
+		Offline:          offlineMode == OfflineModeAlways || networkDown,
+		LastNetworkError: lastNetworkError,
+		LibrarySongs:     len(library.Songs),
+	}
+	offlineMutex.Unlock()
+
+	jsonBytes, _ := json.Marshal(status)
+	return C.CString(string(jsonBytes))
+}
+
+//export NeteaseGetOfflineSongIds
+// NeteaseGetOfflineSongIds 获取本地有可播放文件（缓存或离线下载）的歌曲 ID
+// 返回: JSON 数组字符串
+func NeteaseGetOfflineSongIds() *C.char {
+	ids := []int64{}
+	for id := range offlineSongSet() {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	jsonBytes, _ := json.Marshal(ids)
+	return C.CString(string(jsonBytes))
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// useTestLibrary 使用临时目录中的空歌曲库，测试结束后恢复
+func useTestLibrary(t *testing.T) string {
+	t.Helper()
+	offlineMutex.Lock()
+	savedLibrary, savedPath := library, libraryPath
+	library = newOfflineLibrary()
+	libraryPath = filepath.Join(t.TempDir(), "library.json")
+	path := libraryPath
+	offlineMutex.Unlock()
+
+	t.Cleanup(func() {
+		offlineMutex.Lock()
+		if librarySaveTimer != nil {
+			librarySaveTimer.Stop()
+			librarySaveTimer = nil
+		}
+		libraryDirty = false
+		library, libraryPath = savedLibrary, savedPath
+		offlineMutex.Unlock()
+	})
+	return path
+}
+
+func readTestLibrary(t *testing.T, path string) *offlineLibrary {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("library not saved: %v", err)
+	}
+	loaded := newOfflineLibrary()
+	if err := json.Unmarshal(data, loaded); err != nil {
+		t.Fatal(err)
+	}
+	return loaded
+}
+
+func TestFullListsAreSavedImmediately(t *testing.T) {
+	path := useTestLibrary(t)
+	songs := []SongInfo{{ID: 1, Name: "One"}, {ID: 2, Name: "Two"}}
+
+	recordLikeSongs(7, songs)
+	if loaded := readTestLibrary(t, path); len(loaded.Likes[7]) != 2 || len(loaded.Songs) != 2 {
+		t.Fatalf("likes = %v, songs = %d after recordLikeSongs", loaded.Likes[7], len(loaded.Songs))
+	}
+
+	recordPlaylist(&PlaylistInfo{ID: 9, Name: "List"}, 9, songs[:1], true)
+	loaded := readTestLibrary(t, path)
+	if playlist := loaded.Playlists[9]; playlist == nil || len(playlist.SongIds) != 1 {
+		t.Fatalf("playlist = %+v after recordPlaylist", playlist)
+	}
+}
+
+func TestPartialRecordsAreDebounced(t *testing.T) {
+	path := useTestLibrary(t)
+
+	recordPlaylist(nil, 9, []SongInfo{{ID: 1, Name: "One"}}, false)
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("library written before the save delay: %v", err)
+	}
+
+	// 延迟保存时写入，未被引用的歌曲被清理
+	flushLibrary()
+	loaded := readTestLibrary(t, path)
+	if len(loaded.Songs) != 0 || loaded.Playlists[9] == nil {
+		t.Fatalf("songs = %d, playlist = %v after flush", len(loaded.Songs), loaded.Playlists[9])
+	}
+}
@@ -0,0 +1,13 @@
+package main
+
+// aacFrameDecoder 解码原始 AAC 帧（MP4 中的 sample）
+// 具体实现依赖 fdk-aac，见 pcm_aac_fdkaac.go；未启用时见 pcm_aac_disabled.go
+type aacFrameDecoder interface {
+	// decode 解码一帧，返回交错存放的 PCM（解码器延迟期间可能为空）
+	decode(frame []byte) ([]float32, error)
+	// format 返回输出的采样率和声道数，解码出第一帧之前为 0
+	format() (sampleRate, channels int)
+	// reset 清空解码器状态（Seek 后调用）
+	reset()
+	close()
+}
@@ -0,0 +1,13 @@
+//go:build !fdkaac
+
+package main
+
+import "errors"
+
+// 默认构建不包含 AAC 解码器（fdk-aac 需要额外的 C 库），使用 -tags fdkaac 构建以启用
+// 播放时 m4a 地址会换成其他音质的 flac/mp3 地址（见 resolvePlayableSongURL）
+const aacDecodingAvailable = false
+
+func newAacFrameDecoder(asc []byte) (aacFrameDecoder, error) {
+	return nil, errors.New("AAC decoding is not available in this build (rebuild with -tags fdkaac)")
+}
@@ -0,0 +1,80 @@
+//go:build fdkaac
+
+package main
+
+import (
+	"errors"
+
+	"github.com/winlinvip/go-fdkaac/fdkaac"
+)
+
+const aacDecodingAvailable = true
+
+// fdkAacDecoder 使用 fdk-aac 解码 AAC-LC / HE-AAC
+type fdkAacDecoder struct {
+	asc        []byte
+	decoder    *fdkaac.AacDecoder
+	sampleRate int
+	channels   int
+	err        error // 重新创建解码器失败时的错误
+}
+
+func newAacFrameDecoder(asc []byte) (aacFrameDecoder, error) {
+	d := &fdkAacDecoder{asc: asc}
+	if err := d.open(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (d *fdkAacDecoder) open() error {
+	decoder := fdkaac.NewAacDecoder()
+	if err := decoder.InitRaw(d.asc); err != nil {
+		decoder.Close()
+		return errors.New("Failed to initialize AAC decoder: " + err.Error())
+	}
+	d.decoder = decoder
+	return nil
+}
+
+func (d *fdkAacDecoder) decode(frame []byte) ([]float32, error) {
+	if d.err != nil {
+		return nil, d.err
+	}
+	pcm, err := d.decoder.Decode(frame)
+	if err != nil {
+		return nil, errors.New("AAC decode error: " + err.Error())
+	}
+	if len(pcm) == 0 {
+		return nil, nil
+	}
+	if d.sampleRate == 0 {
+		d.sampleRate = d.decoder.SampleRate()
+		d.channels = d.decoder.NumChannels()
+	}
+
+	// fdk-aac 输出 16 位交错 PCM
+	samples := make([]float32, len(pcm)/2)
+	for i := range samples {
+		sample := int16(pcm[i*2]) | int16(pcm[i*2+1])<<8
+		samples[i] = float32(sample) / 32768.0
+	}
+	return samples, nil
+}
+
+func (d *fdkAacDecoder) format() (sampleRate, channels int) {
+	return d.sampleRate, d.channels
+}
+
+func (d *fdkAacDecoder) reset() {
+	// fdk-aac 没有单独的清空接口，重新创建解码器
+	d.decoder.Close()
+	d.decoder = nil
+	d.err = d.open()
+}
+
+func (d *fdkAacDecoder) close() {
+	if d.decoder != nil {
+		d.decoder.Close()
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import "time"
+
+// 缓冲状态（PcmStreamInfo.BufferState）
+const (
+	BufferStateBuffering = "buffering" // 等待数据（开始播放前、欠载后、Seek 后）
+	BufferStatePlaying   = "playing"   // 正常输出
+	BufferStateStalled   = "stalled"   // 等待数据且下载没有进展（网络慢或正在重试）
+)
+
+// 等待数据时下载超过该时长没有进展认为停滞
+const bufferStallTimeout = 3 * time.Second
+
+// 缓冲区容量小于重新缓冲阈值时，缓冲到容量的该比例即继续输出
+const rebufferCapacityRatio = 0.9
+
+// streamBufferState 流的缓冲状态（受流锁保护）
+type streamBufferState struct {
+	state       string
+	underruns   int
+	rebuffering bool      // 欠载后等待缓冲到阈值再继续输出
+	lastSize    int64     // 上次检查时已下载的字节数
+	lastGrowth  time.Time // 已下载字节数上次增长的时间
+}
+
+func newStreamBufferState() streamBufferState {
+	return streamBufferState{state: BufferStateBuffering, lastGrowth: time.Now()}
+}
+
+// decoderBuffer 获取当前解码器已缓冲的帧数（音源采样率）、缓冲区容量和是否已解码到结尾（调用方需持有锁）
+// 下载完成后使用的可 Seek 解码器直接读文件，视为已全部缓冲
+func (s *PcmStream) decoderBuffer() (frames, capacity int, finished bool) {
+	switch {
+	case s.format.usesPacketDecoder():
+		if s.packetDec != nil {
+			return s.packetDec.Buffered()
+		}
+	case s.useSeekable:
+		return 0, 0, true
+	case s.format == FormatFLAC:
+		if s.flacStreamingDec != nil {
+			return s.flacStreamingDec.Buffered()
+		}
+	default:
+		if s.streamingDec != nil {
+			return s.streamingDec.Buffered()
+		}
+	}
+	return 0, 0, false
+}
+
+// bufferedSeconds 解码器中已缓冲的时长（调用方需持有锁）
+func (s *PcmStream) bufferedSeconds() float64 {
+	frames, _, _ := s.decoderBuffer()
+	rate, _ := s.sourceFormat()
+	if rate <= 0 {
+		return 0
+	}
+	return float64(frames) / float64(rate)
+}
+
+// holdForRebuffer 欠载后是否还要继续等待缓冲（调用方需持有锁）
+// 缓冲到 rebufferSeconds、缓冲区将满或解码结束时恢复输出并发送 ready 事件
+func (s *PcmStream) holdForRebuffer() bool {
+	if !s.buffering.rebuffering {
+		return false
+	}
+
+	frames, capacity, finished := s.decoderBuffer()
+	rate, _ := s.sourceFormat()
+	target := int(s.options.RebufferSeconds * float64(rate))
+	if limit := int(float64(capacity) * rebufferCapacityRatio); capacity > 0 && target > limit {
+		target = limit
+	}
+	if !finished && (rate <= 0 || frames < target) {
+		return true
+	}
+
+	s.buffering.rebuffering = false
+	s.emitEvent(StreamEvent{Type: EventReady, Position: s.currentPosition()})
+	return false
+}
+
+// updateBufferState 根据读取结果更新缓冲状态（调用方需持有锁）
+// underrun: 本次读取是否是开始输出后的第一次欠载
+func (s *PcmStream) updateBufferState(result int, underrun bool) {
+	switch {
+	case s.isPaused:
+		// 等待延迟执行的 Seek 时输出的是静音
+		if s.buffering.state == BufferStatePlaying {
+			s.buffering.state = BufferStateBuffering
+		}
+	case result > 0:
+		s.buffering.state = BufferStatePlaying
+	case underrun:
+		s.buffering.underruns++
+		s.buffering.state = BufferStateBuffering
+		s.buffering.lastGrowth = time.Now()
+		if s.options.RebufferSeconds > 0 {
+			s.buffering.rebuffering = true
+		}
+	}
+}
+
+// checkStall 等待数据时检查下载是否停滞（调用方需持有锁）
+func (s *PcmStream) checkStall() {
+	if s.buffering.state == BufferStatePlaying || s.cache == nil {
+		return
+	}
+
+	now := time.Now()
+	if size := s.cache.GetSize(); size != s.buffering.lastSize {
+		s.buffering.lastSize = size
+		s.buffering.lastGrowth = now
+	}
+	downloadState, _, _ := s.cache.GetState()
+
+	stalled := false
+	if !s.cache.IsComplete() {
+		stalled = downloadState == DownloadRetrying || now.Sub(s.buffering.lastGrowth) >= bufferStallTimeout
+	}
+
+	switch {
+	case stalled && s.buffering.state == BufferStateBuffering:
+		s.buffering.state = BufferStateStalled
+		s.emitEvent(StreamEvent{Type: EventStalled, Position: s.currentPosition()})
+	case !stalled && s.buffering.state == BufferStateStalled:
+		s.buffering.state = BufferStateBuffering
+		s.emitEvent(StreamEvent{Type: EventBuffering, Position: s.currentPosition()})
+	}
+}
@@ -2,41 +2,149 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"os"
-	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// DownloadState 缓存下载状态
+type DownloadState int
+
+const (
+	DownloadIdle     DownloadState = iota
+	DownloadRunning                // 下载中
+	DownloadRetrying               // 出错后等待重试
+	DownloadComplete               // 已完成
+	DownloadFailed                 // 重试耗尽或不可恢复的错误
+)
+
+func (s DownloadState) String() string {
+	switch s {
+	case DownloadRunning:
+		return "downloading"
+	case DownloadRetrying:
+		return "retrying"
+	case DownloadComplete:
+		return "complete"
+	case DownloadFailed:
+		return "failed"
+	default:
+		return "idle"
+	}
+}
+
+const (
+	maxDownloadRetries    = 5                      // 连续失败的最大重试次数
+	downloadRetryBaseWait = 500 * time.Millisecond // 首次重试等待时间，之后指数增长
+	downloadRetryMaxWait  = 8 * time.Second
+	maxUrlRefreshes       = 3 // 没有下载到数据时连续刷新下载地址的最大次数
+)
+
+// downloadTimeouts 下载请求的超时设置
+type downloadTimeouts struct {
+	connect        time.Duration // 建立连接（包括 TLS 握手）
+	responseHeader time.Duration // 发出请求后等待响应头
+	read           time.Duration // 下载过程中没有收到数据的最长时间，超时后断开重试
+}
+
+var defaultDownloadTimeouts = downloadTimeouts{
+	connect:        15 * time.Second,
+	responseHeader: 30 * time.Second,
+	read:           30 * time.Second,
+}
+
+// newDownloadTransport 创建使用指定连接和响应超时的 Transport（下载过程中的超时由调用方处理）
+func newDownloadTransport(timeouts downloadTimeouts) *http.Transport {
+	dialer := &net.Dialer{Timeout: timeouts.connect, KeepAlive: 30 * time.Second}
+	return &http.Transport{
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   timeouts.connect,
+		ResponseHeaderTimeout: timeouts.responseHeader,
+		IdleConnTimeout:       90 * time.Second,
+	}
+}
+
+// downloadOptions 创建下载缓存时的参数
+type downloadOptions struct {
+	timeouts        downloadTimeouts
+	md5             string // 接口返回的文件 MD5，下载完成后校验，空字符串表示不校验
+	verifyFlacAudio bool   // 下载完成后解码整个 FLAC 文件，校验 STREAMINFO 中的音频 MD5
+}
+
 // AudioCache 管理音频文件的下载缓存
+// 缓存文件由 AudioCacheManager 统一管理，下载完成后会持久化保存
 type AudioCache struct {
-	url         string
-	cacheFile   *os.File
-	cachePath   string
-	downloaded  int64
-	totalSize   int64
-	isComplete  bool
-	mutex       sync.RWMutex
-	ctx         context.Context
-	cancel      context.CancelFunc
-	onComplete  func() // 下载完成回调
-}
-
-// NewAudioCache 创建新的音频缓存
-func NewAudioCache(url string, songId int64) (*AudioCache, error) {
-	// 创建缓存目录
-	cacheDir := filepath.Join(os.TempDir(), "chillpatcher_audio_cache")
-	if err := os.MkdirAll(cacheDir, 0755); err != nil {
-		return nil, err
-	}
+	url          string
+	songId       int64
+	quality      string
+	format       string // 音频类型 (mp3, flac, ...)
+	cacheFile    *os.File
+	cachePath    string
+	ranges       []byteRange // 已下载的区间（有序、不重叠）
+	downloaded   int64       // 已下载的总字节数
+	totalSize    int64
+	sizeHint     int64 // 获取 URL 时接口返回的文件大小（响应到达前估算时长用）
+	isComplete   bool
+	fetchPos     int64              // 下一次请求的起始位置（Seek 时会被重定向）
+	writePos     int64              // 当前请求的写入位置，-1 表示没有进行中的请求
+	reqCancel    context.CancelFunc // 取消当前请求（用于重定向到新的区间）
+	state        DownloadState
+	timeouts     downloadTimeouts
+	md5          string // 期望的文件 MD5
+	verifyFlac   bool
+	integrity    IntegrityState
+	badReason    string // 最近一次校验失败的原因
+	redownload   int    // 校验失败后重新下载的次数
+	retries      int    // 当前连续重试次数
+	lastError    string // 最近一次下载错误
+	mutex        sync.RWMutex
+	dataCond     *sync.Cond // 有新数据、下载结束或关闭时广播
+	ctx          context.Context
+	cancel       context.CancelFunc
+	onComplete   []func()                         // 下载完成回调
+	onFailed     []func(err string)               // 下载失败回调
+	onRedownload []func()                         // 校验失败、丢弃数据重新下载时的回调
+	urlRefresh   func(*Session) (*SongURL, error) // 下载地址过期时用 urlSession 重新获取地址
+	urlSession   *Session                         // 获取地址的会话（会话销毁后改为默认会话）
+	refreshes    int                              // 连续刷新下载地址的次数（下载到数据后清零）
+	refCount     int                              // 引用计数（由 AudioCacheManager 维护）
+	external     bool                             // 离线下载的文件（不由 AudioCacheManager 管理，关闭时不删除）
+}
+
+// 请求位置在当前下载位置之后多远以内时不切换请求（顺序下载很快就会到达）
+const rangeRedirectSlack = 256 * 1024
 
-	// 缓存文件路径
-	cachePath := filepath.Join(cacheDir, formatCacheFileName(songId))
+// errRangeRedirect 当前请求被取消并重定向到新的区间（不算作错误）
+var errRangeRedirect = errors.New("download redirected")
+
+// byteRange 已下载的字节区间 [start, end)
+type byteRange struct {
+	start int64
+	end   int64
+}
 
-	// 创建或打开缓存文件
+// downloadError 下载错误，retryable 为 false 时不再重试
+type downloadError struct {
+	msg        string
+	retryable  bool
+	urlExpired bool // 服务器拒绝了下载地址（签名过期），刷新地址后可以继续
+}
+
+func (e *downloadError) Error() string {
+	return e.msg
+}
+
+// NewAudioCache 创建新的音频缓存，下载内容写入 cachePath
+func NewAudioCache(url string, cachePath string, options downloadOptions) (*AudioCache, error) {
+	// 创建缓存文件（未完成的缓存总是从头下载）
 	file, err := os.OpenFile(cachePath, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0644)
 	if err != nil {
 		return nil, err
@@ -44,79 +152,472 @@ func NewAudioCache(url string, songId int64) (*AudioCache, error) {
 
 	ctx, cancel := context.WithCancel(context.Background())
 
-	return &AudioCache{
-		url:       url,
-		cacheFile: file,
-		cachePath: cachePath,
-		ctx:       ctx,
-		cancel:    cancel,
-	}, nil
+	c := &AudioCache{
+		url:        url,
+		cacheFile:  file,
+		cachePath:  cachePath,
+		writePos:   -1,
+		timeouts:   options.timeouts,
+		md5:        options.md5,
+		verifyFlac: options.verifyFlacAudio,
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+	c.dataCond = sync.NewCond(&c.mutex)
+	return c, nil
 }
 
-func formatCacheFileName(songId int64) string {
-	return fmt.Sprintf("netease_%d.audio", songId)
+// newCompleteAudioCache 打开一个已经完整下载的缓存文件（不会访问网络）
+func newCompleteAudioCache(cachePath string, size int64) *AudioCache {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &AudioCache{
+		cachePath:  cachePath,
+		ranges:     []byteRange{{0, size}},
+		downloaded: size,
+		totalSize:  size,
+		writePos:   -1,
+		isComplete: true,
+		state:      DownloadComplete,
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+	c.dataCond = sync.NewCond(&c.mutex)
+	return c
 }
 
 // StartDownload 开始后台下载
 func (c *AudioCache) StartDownload() {
+	c.mutex.Lock()
+	if c.state == DownloadRunning || c.state == DownloadRetrying || c.isComplete {
+		c.mutex.Unlock()
+		return
+	}
+	c.state = DownloadRunning
+	c.retries = 0
+	c.mutex.Unlock()
+
 	go c.downloadInBackground()
 }
 
+// downloadInBackground 下载状态机：出错后指数退避重试，每次重试从已下载位置断点续传
+// 文件按区间下载：Seek 到未下载的位置时会优先下载该位置，之后再补齐跳过的部分
 func (c *AudioCache) downloadInBackground() {
-	req, err := http.NewRequestWithContext(c.ctx, "GET", c.url, nil)
+	transport := newDownloadTransport(c.timeouts)
+	client := &http.Client{Transport: transport}
+	defer transport.CloseIdleConnections()
+
+	for {
+		if c.isFullyDownloaded() {
+			// 校验失败时丢弃数据重新下载
+			if !c.verifyDownload() {
+				continue
+			}
+			if c.ctx.Err() != nil {
+				return
+			}
+			c.finish()
+			return
+		}
+
+		before := c.GetSize()
+		err := c.downloadOnce(client)
+
+		// 缓存已关闭
+		if c.ctx.Err() != nil {
+			return
+		}
+
+		if err == errRangeRedirect {
+			continue
+		}
+		if err == nil {
+			if c.GetSize() > before {
+				continue
+			}
+			err = &downloadError{msg: "Server returned no data", retryable: true}
+		}
+		if de, ok := err.(*downloadError); ok && de.urlExpired {
+			refreshed, refreshErr := c.refreshExpiredURL()
+			if refreshed {
+				// 用新地址从当前位置继续下载，不算作重试
+				continue
+			}
+			if refreshErr != nil {
+				err = refreshErr
+			}
+		}
+
+		c.mutex.Lock()
+		c.lastError = err.Error()
+		// 本次有进展则重新计算重试次数
+		if c.downloaded > before {
+			c.retries = 0
+		}
+		c.retries++
+		retryable := true
+		if de, ok := err.(*downloadError); ok {
+			retryable = de.retryable
+		}
+		if !retryable || c.retries > maxDownloadRetries {
+			c.mutex.Unlock()
+			c.fail(err.Error())
+			return
+		}
+		c.state = DownloadRetrying
+		wait := downloadRetryBaseWait << (c.retries - 1)
+		if wait > downloadRetryMaxWait {
+			wait = downloadRetryMaxWait
+		}
+		c.mutex.Unlock()
+
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+
+		c.mutex.Lock()
+		c.state = DownloadRunning
+		c.mutex.Unlock()
+	}
+}
+
+// downloadOnce 请求下一个未下载的区间并写入缓存文件
+// 返回 nil 表示该区间已下载完（不一定是整个文件），errRangeRedirect 表示请求被重定向
+func (c *AudioCache) downloadOnce(client *http.Client) error {
+	c.mutex.Lock()
+	start, end := c.nextGapLocked(c.fetchPos)
+	reqCtx, reqCancel := context.WithCancel(c.ctx)
+	c.reqCancel = reqCancel
+	c.writePos = start
+	c.mutex.Unlock()
+
+	defer func() {
+		reqCancel()
+		c.mutex.Lock()
+		c.writePos = -1
+		c.reqCancel = nil
+		c.mutex.Unlock()
+	}()
+
+	req, err := http.NewRequestWithContext(reqCtx, "GET", c.GetURL(), nil)
 	if err != nil {
-		return
+		return &downloadError{msg: "Failed to create request: " + err.Error()}
 	}
 	req.Header.Set("User-Agent", "Mozilla/5.0")
-
-	transport := &http.Transport{
-		ResponseHeaderTimeout: 30 * time.Second,
-		IdleConnTimeout:       90 * time.Second,
+	if end > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end-1))
+	} else {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", start))
 	}
-	client := &http.Client{Transport: transport}
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return
+		return c.requestError(reqCtx, "Request failed: "+err.Error())
 	}
 	defer resp.Body.Close()
 
+	writePos := start
+	var totalSize int64
+	rangeSupported := false
+	switch {
+	case resp.StatusCode == http.StatusPartialContent:
+		// 从 Content-Range 获取实际起始位置和文件总大小
+		rangeStart, total := parseContentRange(resp.Header.Get("Content-Range"))
+		if rangeStart >= 0 {
+			writePos = rangeStart
+		}
+		totalSize = total
+		rangeSupported = true
+	case resp.StatusCode == http.StatusOK:
+		// 服务器不支持 Range，从头开始写（覆盖的内容相同）
+		writePos = 0
+		totalSize = resp.ContentLength
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return &downloadError{msg: "Server returned " + resp.Status, retryable: true}
+	case resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		// CDN 地址带有签名，过期后返回 403/404/410
+		return &downloadError{msg: "Server returned " + resp.Status, urlExpired: true}
+	default:
+		return &downloadError{msg: "Server returned " + resp.Status}
+	}
+
 	c.mutex.Lock()
-	c.totalSize = resp.ContentLength
+	if totalSize > 0 {
+		c.totalSize = totalSize
+	}
+	c.writePos = writePos
 	c.mutex.Unlock()
 
+	// 长时间收不到数据时断开连接，由重试逻辑重新请求
+	var stalled int32
+	readTimer := time.AfterFunc(c.timeouts.read, func() {
+		atomic.StoreInt32(&stalled, 1)
+		reqCancel()
+	})
+	defer readTimer.Stop()
+
 	buffer := make([]byte, 32*1024) // 32KB buffer
 	for {
-		select {
-		case <-c.ctx.Done():
-			return
-		default:
-		}
-
 		n, err := resp.Body.Read(buffer)
 		if n > 0 {
+			readTimer.Reset(c.timeouts.read)
 			c.mutex.Lock()
-			c.cacheFile.Write(buffer[:n])
-			c.downloaded += int64(n)
+			if c.cacheFile == nil {
+				// 缓存已关闭
+				c.mutex.Unlock()
+				return context.Canceled
+			}
+			if _, werr := c.cacheFile.WriteAt(buffer[:n], writePos); werr != nil {
+				c.mutex.Unlock()
+				return &downloadError{msg: "Failed to write cache: " + werr.Error()}
+			}
+			c.addRangeLocked(writePos, writePos+int64(n))
+			c.refreshes = 0
+			writePos += int64(n)
+			c.writePos = writePos
+			c.fetchPos = writePos
+			c.dataCond.Broadcast()
+
+			// 区间已下载完，或者已经追上之前下载过的数据
+			// （服务器不支持 Range 时只能一直读到结尾）
+			caughtUp := rangeSupported && ((end > 0 && writePos >= end) || c.contiguousEndLocked(writePos) > writePos)
 			c.mutex.Unlock()
+			if caughtUp {
+				return nil
+			}
 		}
 
 		if err == io.EOF {
 			c.mutex.Lock()
-			c.isComplete = true
+			expectedEnd := end
+			if expectedEnd <= 0 {
+				expectedEnd = c.totalSize
+			}
+			if expectedEnd <= 0 {
+				// 服务器没有返回文件大小，以实际读到的长度为准
+				c.totalSize = writePos
+			}
 			c.mutex.Unlock()
-			
-			// 调用完成回调
-			if c.onComplete != nil {
-				c.onComplete()
+			if expectedEnd > 0 && writePos < expectedEnd {
+				// 连接提前断开
+				return &downloadError{msg: "Connection closed before download finished", retryable: true}
 			}
-			return
+			return nil
 		}
 
 		if err != nil {
-			return
+			if atomic.LoadInt32(&stalled) != 0 {
+				return &downloadError{msg: "No data received for " + c.timeouts.read.String(), retryable: true}
+			}
+			return c.requestError(reqCtx, "Read failed: "+err.Error())
+		}
+	}
+}
+
+// refreshExpiredURL 下载地址过期后重新获取地址（已下载的数据保留，之后从当前位置继续下载）
+// 返回 false 时按原来的错误处理；获取地址失败时返回可重试的错误，下次重试会再次刷新
+func (c *AudioCache) refreshExpiredURL() (bool, error) {
+	c.mutex.Lock()
+	refresh, session := c.urlRefresh, c.urlSession
+	if refresh == nil || c.refreshes >= maxUrlRefreshes {
+		c.mutex.Unlock()
+		return false, nil
+	}
+	c.refreshes++
+	c.mutex.Unlock()
+
+	songUrl, err := refresh(session)
+	if err != nil {
+		return false, &downloadError{msg: "Failed to refresh song URL: " + err.Error(), retryable: true}
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	// 新地址必须是同一个文件，否则已下载的数据无法续用
+	if c.format != "" && !strings.EqualFold(songUrl.Type, c.format) {
+		return false, &downloadError{msg: "Refreshed song URL has a different format: " + songUrl.Type}
+	}
+	if songUrl.Size > 0 && c.totalSize > 0 && songUrl.Size != c.totalSize {
+		return false, &downloadError{msg: "Refreshed song URL has a different size"}
+	}
+	c.url = songUrl.URL
+	return true, nil
+}
+
+// requestError 区分请求被重定向取消和真正的网络错误
+func (c *AudioCache) requestError(reqCtx context.Context, msg string) error {
+	if reqCtx.Err() != nil && c.ctx.Err() == nil {
+		return errRangeRedirect
+	}
+	return &downloadError{msg: msg, retryable: true}
+}
+
+// RequestRange 请求优先下载 offset 处的数据（Seek 到未下载位置时调用）
+func (c *AudioCache) RequestRange(offset int64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.requestRangeLocked(offset)
+}
+
+// requestRangeLocked 见 RequestRange（调用方需持有锁）
+func (c *AudioCache) requestRangeLocked(offset int64) {
+	if c.isComplete || c.contiguousEndLocked(offset) > offset {
+		return
+	}
+	if c.totalSize > 0 && offset >= c.totalSize {
+		return
+	}
+	// 当前请求马上就会下载到该位置，不需要切换
+	if c.writePos >= 0 && offset >= c.writePos && offset-c.writePos < rangeRedirectSlack {
+		return
+	}
+	if c.fetchPos == offset && c.writePos < 0 {
+		return
+	}
+	c.fetchPos = offset
+	if c.reqCancel != nil {
+		c.reqCancel()
+	}
+}
+
+// addRangeLocked 记录已下载的区间并合并相邻区间（调用方需持有锁）
+func (c *AudioCache) addRangeLocked(start, end int64) {
+	ranges := make([]byteRange, 0, len(c.ranges)+1)
+	inserted := false
+	for _, r := range c.ranges {
+		if r.end < start {
+			ranges = append(ranges, r)
+			continue
+		}
+		if r.start > end {
+			if !inserted {
+				ranges = append(ranges, byteRange{start, end})
+				inserted = true
+			}
+			ranges = append(ranges, r)
+			continue
+		}
+		// 重叠或相邻，合并
+		if r.start < start {
+			start = r.start
+		}
+		if r.end > end {
+			end = r.end
+		}
+	}
+	if !inserted {
+		ranges = append(ranges, byteRange{start, end})
+	}
+	c.ranges = ranges
+
+	c.downloaded = 0
+	for _, r := range c.ranges {
+		c.downloaded += r.end - r.start
+	}
+}
+
+// contiguousEndLocked 返回从 pos 开始连续已下载数据的末尾位置，pos 未下载时返回 pos
+func (c *AudioCache) contiguousEndLocked(pos int64) int64 {
+	for _, r := range c.ranges {
+		if pos >= r.start && pos < r.end {
+			return r.end
+		}
+	}
+	return pos
+}
+
+// nextGapLocked 返回 from 之后第一个未下载的区间 [start, end)，end 为 -1 表示到文件末尾
+// from 之后已全部下载时从文件开头查找
+func (c *AudioCache) nextGapLocked(from int64) (start, end int64) {
+	if c.totalSize > 0 && from >= c.totalSize {
+		from = 0
+	}
+	for pass := 0; pass < 2; pass++ {
+		pos := from
+		for _, r := range c.ranges {
+			if r.end <= pos {
+				continue
+			}
+			if r.start > pos {
+				return pos, r.start
+			}
+			pos = r.end
+		}
+		if c.totalSize <= 0 || pos < c.totalSize {
+			return pos, -1
+		}
+		from = 0
+	}
+	return 0, -1
+}
+
+// isFullyDownloaded 检查整个文件是否都已下载
+func (c *AudioCache) isFullyDownloaded() bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.totalSize > 0 && c.downloaded >= c.totalSize
+}
+
+// finish 标记下载完成并触发完成回调
+func (c *AudioCache) finish() {
+	c.mutex.Lock()
+	c.isComplete = true
+	c.state = DownloadComplete
+	c.lastError = ""
+	if c.totalSize <= 0 {
+		c.totalSize = c.downloaded
+	}
+	// 写入完成，关闭写句柄（后续只读）
+	if c.cacheFile != nil {
+		c.cacheFile.Close()
+		c.cacheFile = nil
+	}
+	callbacks := c.onComplete
+	c.onComplete = nil
+	c.onFailed = nil
+	c.onRedownload = nil
+	c.dataCond.Broadcast()
+	c.mutex.Unlock()
+
+	// 调用完成回调
+	for _, callback := range callbacks {
+		callback()
+	}
+}
+
+// fail 标记下载失败并触发失败回调
+func (c *AudioCache) fail(errMsg string) {
+	c.mutex.Lock()
+	c.state = DownloadFailed
+	c.lastError = errMsg
+	callbacks := c.onFailed
+	c.onFailed = nil
+	c.dataCond.Broadcast()
+	c.mutex.Unlock()
+
+	for _, callback := range callbacks {
+		callback(errMsg)
+	}
+}
+
+// parseContentRange 解析 "bytes 100-199/1234" 中的起始位置和总大小，未知的部分返回 -1
+func parseContentRange(contentRange string) (start, total int64) {
+	start, total = -1, -1
+	contentRange = strings.TrimSpace(strings.TrimPrefix(contentRange, "bytes"))
+	slash := strings.LastIndex(contentRange, "/")
+	if slash < 0 {
+		return
+	}
+	if v, err := strconv.ParseInt(strings.TrimSpace(contentRange[slash+1:]), 10, 64); err == nil {
+		total = v
+	}
+	if dash := strings.Index(contentRange[:slash], "-"); dash > 0 {
+		if v, err := strconv.ParseInt(strings.TrimSpace(contentRange[:dash]), 10, 64); err == nil {
+			start = v
 		}
 	}
+	return
 }
 
 // IsComplete 检查下载是否完成
@@ -126,11 +627,108 @@ func (c *AudioCache) IsComplete() bool {
 	return c.isComplete
 }
 
+// GetState 获取下载状态和最近一次错误
+func (c *AudioCache) GetState() (state DownloadState, retries int, errMsg string) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.state, c.retries, c.lastError
+}
+
+// IsFailed 下载是否已失败（不会再有新数据）
+func (c *AudioCache) IsFailed() bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.state == DownloadFailed
+}
+
 // GetCachePath 获取缓存文件路径
 func (c *AudioCache) GetCachePath() string {
 	return c.cachePath
 }
 
+// GetSize 获取已下载的字节数
+func (c *AudioCache) GetSize() int64 {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.downloaded
+}
+
+// GetTotalSize 获取文件总大小，未知时返回 0 或 -1
+func (c *AudioCache) GetTotalSize() int64 {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.totalSize
+}
+
+// GetURL 获取当前的下载地址（过期后会被刷新）
+func (c *AudioCache) GetURL() string {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.url
+}
+
+// SetURLRefresher 设置下载地址过期时重新获取地址的函数（使用 session 获取）
+func (c *AudioCache) SetURLRefresher(session *Session, refresh func(*Session) (*SongURL, error)) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.urlSession = session
+	c.urlRefresh = refresh
+}
+
+// rebindURLSession 获取地址的会话是 from 时改为 to
+func (c *AudioCache) rebindURLSession(from, to *Session) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.urlSession == from {
+		c.urlSession = to
+	}
+}
+
+// urlSessionIs 是否使用 session 获取地址
+func (c *AudioCache) urlSessionIs(session *Session) bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.urlSession == session
+}
+
+// SetSizeHint 设置接口返回的文件大小
+func (c *AudioCache) SetSizeHint(size int64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.sizeHint = size
+}
+
+// GetExpectedSize 获取文件大小，响应到达前返回接口给出的大小，都未知时返回 0
+func (c *AudioCache) GetExpectedSize() int64 {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	if c.totalSize > 0 {
+		return c.totalSize
+	}
+	if c.sizeHint > 0 {
+		return c.sizeHint
+	}
+	return 0
+}
+
+// ReadAvailableAt 读取 [off, off+len(p)) 的数据，仅当这段数据已下载时才读取（不阻塞）
+func (c *AudioCache) ReadAvailableAt(p []byte, off int64) bool {
+	c.mutex.RLock()
+	available := c.contiguousEndLocked(off)-off >= int64(len(p))
+	c.mutex.RUnlock()
+	if !available {
+		return false
+	}
+
+	file, err := os.Open(c.cachePath)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	_, err = file.ReadAt(p, off)
+	return err == nil
+}
+
 // GetProgress 获取下载进度 (0-100)
 func (c *AudioCache) GetProgress() float64 {
 	c.mutex.RLock()
@@ -141,19 +739,72 @@ func (c *AudioCache) GetProgress() float64 {
 	return float64(c.downloaded) / float64(c.totalSize) * 100
 }
 
-// SetOnComplete 设置下载完成回调
-func (c *AudioCache) SetOnComplete(callback func()) {
-	c.onComplete = callback
+// AddOnComplete 添加下载完成回调
+// 如果下载已经完成，回调会被立即调用
+func (c *AudioCache) AddOnComplete(callback func()) {
+	c.mutex.Lock()
+	if !c.isComplete {
+		c.onComplete = append(c.onComplete, callback)
+		c.mutex.Unlock()
+		return
+	}
+	c.mutex.Unlock()
+	callback()
 }
 
-// Close 关闭缓存并删除缓存文件
+// AddOnFailed 添加下载失败回调
+// 如果下载已经失败，回调会被立即调用
+func (c *AudioCache) AddOnFailed(callback func(err string)) {
+	c.mutex.Lock()
+	if c.state != DownloadFailed {
+		if !c.isComplete {
+			c.onFailed = append(c.onFailed, callback)
+		}
+		c.mutex.Unlock()
+		return
+	}
+	errMsg := c.lastError
+	c.mutex.Unlock()
+	callback(errMsg)
+}
+
+// AddOnRedownload 添加重新下载回调（下载完成前校验失败，已下载的数据被丢弃时调用）
+func (c *AudioCache) AddOnRedownload(callback func()) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if !c.isComplete {
+		c.onRedownload = append(c.onRedownload, callback)
+	}
+}
+
+// Close 释放对缓存的引用
+// 最后一个引用释放时：完整的缓存保留在磁盘上，未完成的缓存会被删除
 func (c *AudioCache) Close() {
+	if c.external {
+		c.shutdown(false)
+		return
+	}
+	if audioCacheManager != nil {
+		audioCacheManager.Release(c)
+		return
+	}
+	c.shutdown(true)
+}
+
+// shutdown 停止下载并关闭文件，removeFile 为 true 时删除缓存文件
+func (c *AudioCache) shutdown(removeFile bool) {
 	c.cancel()
+	c.mutex.Lock()
 	if c.cacheFile != nil {
 		c.cacheFile.Close()
+		c.cacheFile = nil
 	}
-	// 删除缓存文件
-	if c.cachePath != "" {
+	c.onComplete = nil
+	c.onFailed = nil
+	c.onRedownload = nil
+	c.dataCond.Broadcast()
+	c.mutex.Unlock()
+	if removeFile && c.cachePath != "" {
 		os.Remove(c.cachePath)
 	}
 }
@@ -0,0 +1,414 @@
+package main
+
+/*
+#include <stdlib.h>
+*/
+import "C"
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 默认缓存上限 1GB
+const defaultAudioCacheMaxBytes int64 = 1024 * 1024 * 1024
+
+// AudioCacheEntry 持久化缓存清单中的一条记录（只记录完整下载的文件）
+type AudioCacheEntry struct {
+	SongID     int64  `json:"songId"`
+	Quality    string `json:"quality"`
+	Type       string `json:"type"`          // mp3, flac, ...
+	FileName   string `json:"fileName"`      // 相对缓存目录的文件名
+	Size       int64  `json:"size"`          // 文件大小（字节）
+	MD5        string `json:"md5,omitempty"` // 下载完成时校验通过的文件 MD5
+	LastAccess int64  `json:"lastAccess"`    // 最后访问时间（Unix 秒），用于 LRU 淘汰
+}
+
+// AudioCacheManager 管理持久化的音频缓存
+// 缓存按 歌曲 ID + 音质 索引，清单保存在 dataDir 中，超出容量时按 LRU 淘汰
+type AudioCacheManager struct {
+	cacheDir     string
+	manifestPath string
+	maxBytes     int64
+	mutex        sync.Mutex
+	entries      map[string]*AudioCacheEntry // 已完整下载的缓存
+	active       map[string]*AudioCache      // 正在使用中的缓存
+}
+
+// AudioCacheStats 返回给 C# 的缓存统计信息
+type AudioCacheStats struct {
+	Entries    int    `json:"entries"`
+	TotalBytes int64  `json:"totalBytes"`
+	MaxBytes   int64  `json:"maxBytes"`
+	CacheDir   string `json:"cacheDir"`
+}
+
+var audioCacheManager *AudioCacheManager
+
+// initAudioCacheManager 初始化缓存管理器，加载清单并清理残留文件
+func initAudioCacheManager(dataDir string) error {
+	m := &AudioCacheManager{
+		cacheDir:     filepath.Join(dataDir, "audio_cache"),
+		manifestPath: filepath.Join(dataDir, "audio_cache.json"),
+		maxBytes:     defaultAudioCacheMaxBytes,
+		entries:      make(map[string]*AudioCacheEntry),
+		active:       make(map[string]*AudioCache),
+	}
+
+	if err := os.MkdirAll(m.cacheDir, 0755); err != nil {
+		return err
+	}
+
+	m.loadManifest()
+	audioCacheManager = m
+	return nil
+}
+
+func audioCacheKey(songId int64, quality string) string {
+	return fmt.Sprintf("%d_%s", songId, quality)
+}
+
+func formatCacheFileName(songId int64, quality string) string {
+	return fmt.Sprintf("netease_%d_%s.audio", songId, quality)
+}
+
+// loadManifest 读取清单，丢弃文件已丢失或大小不符的记录，并删除清单外的残留文件
+func (m *AudioCacheManager) loadManifest() {
+	data, err := os.ReadFile(m.manifestPath)
+	if err == nil {
+		var entries []*AudioCacheEntry
+		if json.Unmarshal(data, &entries) == nil {
+			for _, entry := range entries {
+				info, err := os.Stat(filepath.Join(m.cacheDir, entry.FileName))
+				if err != nil || info.Size() != entry.Size {
+					continue
+				}
+				m.entries[audioCacheKey(entry.SongID, entry.Quality)] = entry
+			}
+		}
+	}
+
+	// 删除未完成的残留文件（例如进程异常退出时留下的）
+	known := make(map[string]bool, len(m.entries))
+	for _, entry := range m.entries {
+		known[entry.FileName] = true
+	}
+	if files, err := os.ReadDir(m.cacheDir); err == nil {
+		for _, f := range files {
+			if !f.IsDir() && !known[f.Name()] {
+				os.Remove(filepath.Join(m.cacheDir, f.Name()))
+			}
+		}
+	}
+
+	m.saveManifestLocked()
+}
+
+// saveManifestLocked 保存清单（调用方需持有锁）
+func (m *AudioCacheManager) saveManifestLocked() {
+	entries := make([]*AudioCacheEntry, 0, len(m.entries))
+	for _, entry := range m.entries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].LastAccess > entries[j].LastAccess
+	})
+
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return
+	}
+
+	// 先写临时文件再重命名，避免写到一半时崩溃导致清单损坏
+	tmpPath := m.manifestPath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return
+	}
+	os.Rename(tmpPath, m.manifestPath)
+}
+
+// Acquire 获取歌曲的缓存（正在使用中的或已完整下载的），没有则返回 nil
+func (m *AudioCacheManager) Acquire(songId int64, quality string) *AudioCache {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	key := audioCacheKey(songId, quality)
+	if cache, ok := m.active[key]; ok {
+		cache.refCount++
+		if cache.IsFailed() {
+			// 之前的下载已失败，从已下载位置重新开始
+			cache.StartDownload()
+		}
+		return cache
+	}
+
+	entry, ok := m.entries[key]
+	if !ok {
+		return nil
+	}
+
+	path := filepath.Join(m.cacheDir, entry.FileName)
+	if info, err := os.Stat(path); err != nil || info.Size() != entry.Size {
+		// 文件被外部删除或修改
+		delete(m.entries, key)
+		m.saveManifestLocked()
+		return nil
+	}
+
+	entry.LastAccess = time.Now().Unix()
+	m.saveManifestLocked()
+
+	cache := newCompleteAudioCache(path, entry.Size)
+	cache.songId = songId
+	cache.quality = quality
+	cache.format = entry.Type
+	if entry.MD5 != "" {
+		cache.md5 = entry.MD5
+		cache.integrity = IntegrityVerified
+	}
+	cache.refCount = 1
+	m.active[key] = cache
+	return cache
+}
+
+// AcquireAnyQuality 获取歌曲任意音质的完整缓存（离线时使用），有多个时使用文件最大的，没有则返回 nil
+func (m *AudioCacheManager) AcquireAnyQuality(songId int64) *AudioCache {
+	m.mutex.Lock()
+	for _, cache := range m.active {
+		if cache.songId == songId && cache.IsComplete() {
+			cache.refCount++
+			m.mutex.Unlock()
+			return cache
+		}
+	}
+	var best *AudioCacheEntry
+	for _, entry := range m.entries {
+		if entry.SongID == songId && (best == nil || entry.Size > best.Size) {
+			best = entry
+		}
+	}
+	m.mutex.Unlock()
+
+	if best == nil {
+		return nil
+	}
+	return m.Acquire(songId, best.Quality)
+}
+
+// rebindSession 使用中的缓存改用 to 刷新下载地址（from 会话销毁时调用）
+func (m *AudioCacheManager) rebindSession(from, to *Session) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for _, cache := range m.active {
+		cache.rebindURLSession(from, to)
+	}
+}
+
+// SongIds 有完整缓存的歌曲 ID（任意音质）
+func (m *AudioCacheManager) SongIds() []int64 {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	ids := make([]int64, 0, len(m.entries))
+	for _, entry := range m.entries {
+		ids = append(ids, entry.SongID)
+	}
+	return ids
+}
+
+// Create 为歌曲创建新的下载缓存并开始后台下载（已有进行中的下载时直接使用，options 不生效）
+func (m *AudioCacheManager) Create(songId int64, quality, url, format string, options downloadOptions) (*AudioCache, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	key := audioCacheKey(songId, quality)
+	if cache, ok := m.active[key]; ok {
+		cache.refCount++
+		return cache, nil
+	}
+
+	cache, err := NewAudioCache(url, filepath.Join(m.cacheDir, formatCacheFileName(songId, quality)), options)
+	if err != nil {
+		return nil, err
+	}
+	cache.songId = songId
+	cache.quality = quality
+	cache.format = format
+	cache.refCount = 1
+	m.active[key] = cache
+
+	// 下载完成后写入清单
+	cache.AddOnComplete(func() {
+		m.commit(cache)
+	})
+	cache.StartDownload()
+
+	return cache, nil
+}
+
+// commit 将下载完成的缓存写入清单
+func (m *AudioCacheManager) commit(cache *AudioCache) {
+	// 多次重新下载仍然校验失败的文件不保存，最后一个引用释放时删除
+	integrity, _ := cache.GetIntegrity()
+	if integrity == IntegrityCorrupted {
+		return
+	}
+	md5 := ""
+	if integrity == IntegrityVerified {
+		md5 = cache.md5
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.entries[audioCacheKey(cache.songId, cache.quality)] = &AudioCacheEntry{
+		SongID:     cache.songId,
+		Quality:    cache.quality,
+		Type:       cache.format,
+		FileName:   filepath.Base(cache.cachePath),
+		Size:       cache.GetSize(),
+		MD5:        md5,
+		LastAccess: time.Now().Unix(),
+	}
+	m.evictLocked()
+	m.saveManifestLocked()
+}
+
+// Release 释放缓存引用，最后一个引用释放时关闭缓存
+func (m *AudioCacheManager) Release(cache *AudioCache) {
+	m.mutex.Lock()
+	cache.refCount--
+	if cache.refCount > 0 {
+		m.mutex.Unlock()
+		return
+	}
+
+	key := audioCacheKey(cache.songId, cache.quality)
+	if m.active[key] == cache {
+		delete(m.active, key)
+	}
+	_, persisted := m.entries[key]
+	m.evictLocked()
+	m.saveManifestLocked()
+	m.mutex.Unlock()
+
+	// 未完成的下载不保留
+	cache.shutdown(!persisted || !cache.IsComplete())
+}
+
+// evictLocked 按 LRU 淘汰缓存直到总大小不超过上限（跳过正在使用的缓存）
+func (m *AudioCacheManager) evictLocked() {
+	var total int64
+	entries := make([]*AudioCacheEntry, 0, len(m.entries))
+	for _, entry := range m.entries {
+		total += entry.Size
+		entries = append(entries, entry)
+	}
+	if total <= m.maxBytes {
+		return
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].LastAccess < entries[j].LastAccess
+	})
+
+	for _, entry := range entries {
+		if total <= m.maxBytes {
+			break
+		}
+		key := audioCacheKey(entry.SongID, entry.Quality)
+		if _, inUse := m.active[key]; inUse {
+			continue
+		}
+		os.Remove(filepath.Join(m.cacheDir, entry.FileName))
+		delete(m.entries, key)
+		total -= entry.Size
+	}
+}
+
+// SetMaxBytes 设置缓存容量上限
+func (m *AudioCacheManager) SetMaxBytes(maxBytes int64) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.maxBytes = maxBytes
+	m.evictLocked()
+	m.saveManifestLocked()
+}
+
+// Clear 删除所有未在使用中的缓存
+func (m *AudioCacheManager) Clear() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for key, entry := range m.entries {
+		if _, inUse := m.active[key]; inUse {
+			continue
+		}
+		os.Remove(filepath.Join(m.cacheDir, entry.FileName))
+		delete(m.entries, key)
+	}
+	m.saveManifestLocked()
+}
+
+// Stats 获取缓存统计信息
+func (m *AudioCacheManager) Stats() AudioCacheStats {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	stats := AudioCacheStats{
+		Entries:  len(m.entries),
+		MaxBytes: m.maxBytes,
+		CacheDir: m.cacheDir,
+	}
+	for _, entry := range m.entries {
+		stats.TotalBytes += entry.Size
+	}
+	return stats
+}
+
+//export NeteaseSetAudioCacheLimit
+// NeteaseSetAudioCacheLimit 设置持久化音频缓存的容量上限
+// maxMB: 上限（MB），超出时按最近最少使用淘汰
+// 返回: 1 = 成功, 0 = 失败
+func NeteaseSetAudioCacheLimit(maxMB C.longlong) C.int {
+	if audioCacheManager == nil {
+		setError(ErrNotInitialized, "Not initialized")
+		return 0
+	}
+	if maxMB < 0 {
+		setError(ErrInvalidArgument, "Invalid cache limit")
+		return 0
+	}
+	audioCacheManager.SetMaxBytes(int64(maxMB) * 1024 * 1024)
+	return 1
+}
+
+//export NeteaseClearAudioCache
+// NeteaseClearAudioCache 清空持久化音频缓存（正在播放的歌曲除外）
+func NeteaseClearAudioCache() C.int {
+	if audioCacheManager == nil {
+		setError(ErrNotInitialized, "Not initialized")
+		return 0
+	}
+	audioCacheManager.Clear()
+	return 1
+}
+
+//export NeteaseGetAudioCacheStats
+// NeteaseGetAudioCacheStats 获取缓存统计信息
+// 返回: JSON 字符串 {"entries", "totalBytes", "maxBytes", "cacheDir"}
+func NeteaseGetAudioCacheStats() *C.char {
+	if audioCacheManager == nil {
+		setError(ErrNotInitialized, "Not initialized")
+		return nil
+	}
+
+	jsonBytes, err := json.Marshal(audioCacheManager.Stats())
+	if err != nil {
+		setError(ErrInternal, "Failed to marshal cache stats: "+err.Error())
+		return nil
+	}
+
+	return C.CString(string(jsonBytes))
+}
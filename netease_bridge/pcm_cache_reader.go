@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+)
+
+var errCacheReaderClosed = errors.New("cache reader closed")
+
+// CacheReader 从缓存文件中读取数据，可以在下载过程中使用
+// 读到未下载的位置时会阻塞（并请求优先下载该位置），直到有新数据、下载结束或读取器被关闭
+// 这样解码器和缓存共用同一个下载，不需要再单独请求一次网络
+type CacheReader struct {
+	cache  *AudioCache
+	file   *os.File
+	pos    int64
+	closed bool // 受 cache.mutex 保护
+}
+
+// NewReader 创建从缓存文件开头读取的读取器
+func (c *AudioCache) NewReader() (*CacheReader, error) {
+	return c.NewReaderAt(0)
+}
+
+// NewReaderAt 创建从 offset 处开始读取的读取器，offset 未下载时会请求优先下载
+func (c *AudioCache) NewReaderAt(offset int64) (*CacheReader, error) {
+	file, err := os.Open(c.cachePath)
+	if err != nil {
+		return nil, err
+	}
+	c.RequestRange(offset)
+	return &CacheReader{
+		cache: c,
+		file:  file,
+		pos:   offset,
+	}, nil
+}
+
+// Read 实现 io.Reader
+func (r *CacheReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	c := r.cache
+	c.mutex.Lock()
+	var available int64
+	for {
+		if r.closed {
+			c.mutex.Unlock()
+			return 0, errCacheReaderClosed
+		}
+		available = c.contiguousEndLocked(r.pos) - r.pos
+		if available > 0 {
+			break
+		}
+		if c.isComplete || (c.totalSize > 0 && r.pos >= c.totalSize) {
+			c.mutex.Unlock()
+			return 0, io.EOF
+		}
+		if c.state == DownloadFailed {
+			downloadErr := c.lastError
+			c.mutex.Unlock()
+			return 0, errors.New("download failed: " + downloadErr)
+		}
+		if c.ctx.Err() != nil {
+			// 缓存已关闭
+			c.mutex.Unlock()
+			return 0, errCacheReaderClosed
+		}
+		// 等待新数据（必要时让下载跳转到当前位置）
+		c.requestRangeLocked(r.pos)
+		c.dataCond.Wait()
+	}
+	c.mutex.Unlock()
+
+	if int64(len(p)) > available {
+		p = p[:available]
+	}
+	n, err := r.file.ReadAt(p, r.pos)
+	r.pos += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+// Seek 实现 io.Seeker，不会阻塞（数据在读取时才等待）
+func (r *CacheReader) Seek(offset int64, whence int) (int64, error) {
+	var pos int64
+	switch whence {
+	case io.SeekStart:
+		pos = offset
+	case io.SeekCurrent:
+		pos = r.pos + offset
+	case io.SeekEnd:
+		size := r.cache.GetTotalSize()
+		if size <= 0 {
+			return 0, errors.New("seek from end: size unknown")
+		}
+		pos = size + offset
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if pos < 0 {
+		return 0, errors.New("negative position")
+	}
+	r.pos = pos
+	return pos, nil
+}
+
+// Close 关闭读取器，正在阻塞的 Read 会立即返回
+func (r *CacheReader) Close() error {
+	c := r.cache
+	c.mutex.Lock()
+	if r.closed {
+		c.mutex.Unlock()
+		return nil
+	}
+	r.closed = true
+	c.dataCond.Broadcast()
+	c.mutex.Unlock()
+	return r.file.Close()
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/mewkiz/flac"
+)
+
+// IntegrityState 缓存文件的完整性校验状态
+type IntegrityState int
+
+const (
+	IntegrityUnverified    IntegrityState = iota // 下载中，或没有可用的校验信息
+	IntegrityVerifying                           // 下载完成，正在校验
+	IntegrityVerified                            // 校验通过
+	IntegrityRedownloading                       // 校验失败，正在重新下载
+	IntegrityCorrupted                           // 重新下载后仍然校验失败（文件不会保存到缓存中）
+)
+
+func (s IntegrityState) String() string {
+	switch s {
+	case IntegrityVerifying:
+		return "verifying"
+	case IntegrityVerified:
+		return "verified"
+	case IntegrityRedownloading:
+		return "redownloading"
+	case IntegrityCorrupted:
+		return "corrupted"
+	default:
+		return "unverified"
+	}
+}
+
+// 校验失败后最多重新下载的次数
+const maxIntegrityRedownloads = 2
+
+// verifyDownload 下载完成后校验文件（在下载协程中调用）
+// 返回 false 表示校验失败，已丢弃下载的数据，需要从头重新下载
+// 重新下载次数用完时标记为损坏并返回 true，文件仍然可以播放，但不会写入缓存清单
+func (c *AudioCache) verifyDownload() bool {
+	c.mutex.Lock()
+	expected := c.md5
+	verifyFlac := c.verifyFlac && strings.EqualFold(c.format, "flac")
+	if expected == "" && !verifyFlac {
+		c.mutex.Unlock()
+		return true
+	}
+	c.integrity = IntegrityVerifying
+	path := c.cachePath
+	c.mutex.Unlock()
+
+	reason := ""
+	if expected != "" {
+		sum, err := fileMD5(path)
+		if err != nil {
+			reason = "Failed to read cache file: " + err.Error()
+		} else if !strings.EqualFold(sum, expected) {
+			reason = "MD5 mismatch: expected " + expected + ", got " + sum
+		}
+	}
+	if reason == "" && verifyFlac {
+		if err := verifyFlacAudioMD5(path); err != nil {
+			reason = err.Error()
+		}
+	}
+
+	c.mutex.Lock()
+	if reason == "" {
+		c.integrity = IntegrityVerified
+		c.badReason = ""
+		c.mutex.Unlock()
+		return true
+	}
+
+	c.badReason = reason
+	if c.redownload >= maxIntegrityRedownloads {
+		c.integrity = IntegrityCorrupted
+		c.mutex.Unlock()
+		return true
+	}
+	c.redownload++
+	c.integrity = IntegrityRedownloading
+	// 丢弃已下载的数据从头下载，清空文件避免读到上一次的数据
+	c.ranges = nil
+	c.downloaded = 0
+	c.fetchPos = 0
+	c.retries = 0
+	if c.cacheFile != nil {
+		c.cacheFile.Truncate(0)
+	}
+	callbacks := c.onRedownload
+	c.mutex.Unlock()
+
+	// 通知使用者重新创建解码器（已经解码的数据可能来自损坏的文件）
+	for _, callback := range callbacks {
+		callback()
+	}
+	return false
+}
+
+// GetIntegrity 获取完整性校验状态和最近一次校验失败的原因
+func (c *AudioCache) GetIntegrity() (IntegrityState, string) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.integrity, c.badReason
+}
+
+// isTrusted 缓存文件是否可以作为完整的文件使用（复制到下载目录等）
+// 校验通过，或者没有可用的 MD5 无法校验时为 true；校验中、重新下载中或已损坏时为 false
+func (c *AudioCache) isTrusted() bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.integrity == IntegrityVerified || (c.integrity == IntegrityUnverified && c.md5 == "")
+}
+
+// fileMD5 计算文件的 MD5（小写十六进制）
+func fileMD5(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	h := md5.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// verifyFlacAudioMD5 解码整个 FLAC 文件，与 STREAMINFO 中的音频 MD5 比较
+// 编码器没有写入 MD5（全为 0）时视为通过
+func verifyFlacAudioMD5(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	stream, err := flac.New(bufio.NewReaderSize(file, 64*1024))
+	if err != nil {
+		return errors.New("Failed to parse FLAC header: " + err.Error())
+	}
+	defer stream.Close()
+
+	expected := stream.Info.MD5sum
+	if expected == ([16]uint8{}) {
+		return nil
+	}
+
+	h := md5.New()
+	for {
+		f, err := stream.ParseNext()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errors.New("Failed to decode FLAC: " + err.Error())
+		}
+		f.Hash(h)
+	}
+	if !bytes.Equal(h.Sum(nil), expected[:]) {
+		return errors.New("FLAC audio MD5 mismatch")
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package main
+
+// 最多支持 8 声道（FLAC 的上限）
+const maxSourceChannels = 8
+
+// 下混系数（-3dB）
+const downmixCoeff = 0.7071067811865476
+
+// channelLayoutName 返回声道数对应的布局名称（FLAC/WAV 的默认声道顺序）
+func channelLayoutName(channels int) string {
+	switch channels {
+	case 1:
+		return "mono"
+	case 2:
+		return "stereo"
+	case 3:
+		return "3.0" // FL FR C
+	case 4:
+		return "quad" // FL FR BL BR
+	case 5:
+		return "5.0" // FL FR C BL BR
+	case 6:
+		return "5.1" // FL FR C LFE BL BR
+	case 7:
+		return "6.1" // FL FR C LFE BC SL SR
+	case 8:
+		return "7.1" // FL FR C LFE BL BR SL SR
+	}
+	return ""
+}
+
+// stereoDownmixRows 返回从 in 声道下混到立体声的系数（左、右两行）
+// 中置和环绕按 -3dB 混入，LFE 丢弃，多声道时按行归一化避免削波
+func stereoDownmixRows(in int) (left, right []float64) {
+	left = make([]float64, in)
+	right = make([]float64, in)
+
+	switch in {
+	case 1:
+		left[0], right[0] = 1, 1
+		return
+	case 2:
+		left[0], right[1] = 1, 1
+		return
+	case 3: // FL FR C
+		left[0], right[1] = 1, 1
+		left[2], right[2] = downmixCoeff, downmixCoeff
+	case 4: // FL FR BL BR
+		left[0], right[1] = 1, 1
+		left[2], right[3] = downmixCoeff, downmixCoeff
+	case 5: // FL FR C BL BR
+		left[0], right[1] = 1, 1
+		left[2], right[2] = downmixCoeff, downmixCoeff
+		left[3], right[4] = downmixCoeff, downmixCoeff
+	case 6: // FL FR C LFE BL BR
+		left[0], right[1] = 1, 1
+		left[2], right[2] = downmixCoeff, downmixCoeff
+		left[4], right[5] = downmixCoeff, downmixCoeff
+	case 7: // FL FR C LFE BC SL SR
+		left[0], right[1] = 1, 1
+		left[2], right[2] = downmixCoeff, downmixCoeff
+		left[4], right[4] = 0.5, 0.5
+		left[5], right[6] = downmixCoeff, downmixCoeff
+	case 8: // FL FR C LFE BL BR SL SR
+		left[0], right[1] = 1, 1
+		left[2], right[2] = downmixCoeff, downmixCoeff
+		left[4], right[5] = downmixCoeff, downmixCoeff
+		left[6], right[7] = downmixCoeff, downmixCoeff
+	default:
+		// 未知布局：只取前两个声道
+		left[0], right[1] = 1, 1
+		return
+	}
+
+	normalizeRow(left)
+	normalizeRow(right)
+	return
+}
+
+func normalizeRow(row []float64) {
+	var sum float64
+	for _, v := range row {
+		sum += v
+	}
+	if sum > 1 {
+		for i := range row {
+			row[i] /= sum
+		}
+	}
+}
+
+// channelMapper 把 in 声道的交错 PCM 转换为 out 声道
+type channelMapper struct {
+	in     int
+	out    int
+	matrix [][]float32 // [输出声道][输入声道]
+}
+
+func newChannelMapper(in, out int) *channelMapper {
+	m := &channelMapper{in: in, out: out}
+	m.matrix = make([][]float32, out)
+	for o := range m.matrix {
+		m.matrix[o] = make([]float32, in)
+	}
+
+	left, right := stereoDownmixRows(in)
+	switch {
+	case in == out:
+		for c := 0; c < in; c++ {
+			m.matrix[c][c] = 1
+		}
+	case out == 1:
+		// 单声道：先下混到立体声再取平均（单声道输入直接复制）
+		for c := 0; c < in; c++ {
+			if in == 1 {
+				m.matrix[0][c] = 1
+			} else {
+				m.matrix[0][c] = float32((left[c] + right[c]) / 2)
+			}
+		}
+	default:
+		// 立体声及以上：下混结果放在前左/前右，其余声道静音
+		for c := 0; c < in; c++ {
+			m.matrix[0][c] = float32(left[c])
+			m.matrix[1][c] = float32(right[c])
+		}
+	}
+	return m
+}
+
+// process 转换 frames 帧，src 为 in 声道交错数据，dst 为 out 声道交错数据
+func (m *channelMapper) process(dst, src []float32, frames int) {
+	for f := 0; f < frames; f++ {
+		in := src[f*m.in : f*m.in+m.in]
+		out := dst[f*m.out : f*m.out+m.out]
+		for o, row := range m.matrix {
+			var acc float32
+			for c, coeff := range row {
+				if coeff != 0 {
+					acc += in[c] * coeff
+				}
+			}
+			out[o] = acc
+		}
+	}
+}
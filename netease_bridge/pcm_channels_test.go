@@ -0,0 +1,111 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestChannelMapperMatrix(t *testing.T) {
+	const c = downmixCoeff
+	n6 := 1 + 2*c // 5.1 每行系数之和
+	n8 := 1 + 3*c // 7.1 每行系数之和
+	tests := []struct {
+		name   string
+		in     int
+		out    int
+		matrix [][]float64
+	}{
+		{"mono to stereo", 1, 2, [][]float64{{1}, {1}}},
+		{"mono to mono", 1, 1, [][]float64{{1}}},
+		{"stereo passthrough", 2, 2, [][]float64{{1, 0}, {0, 1}}},
+		{"stereo to mono", 2, 1, [][]float64{{0.5, 0.5}}},
+		{"stereo to quad", 2, 4, [][]float64{{1, 0}, {0, 1}, {0, 0}, {0, 0}}},
+		{
+			"3.0 to stereo", 3, 2,
+			[][]float64{{1 / (1 + c), 0, c / (1 + c)}, {0, 1 / (1 + c), c / (1 + c)}},
+		},
+		{
+			"5.1 to stereo", 6, 2,
+			[][]float64{
+				{1 / n6, 0, c / n6, 0, c / n6, 0},
+				{0, 1 / n6, c / n6, 0, 0, c / n6},
+			},
+		},
+		{
+			"5.1 to mono", 6, 1,
+			[][]float64{{0.5 / n6, 0.5 / n6, c / n6, 0, 0.5 * c / n6, 0.5 * c / n6}},
+		},
+		{
+			"7.1 to stereo", 8, 2,
+			[][]float64{
+				{1 / n8, 0, c / n8, 0, c / n8, 0, c / n8, 0},
+				{0, 1 / n8, c / n8, 0, 0, c / n8, 0, c / n8},
+			},
+		},
+		{
+			"5.1 passthrough", 6, 6,
+			[][]float64{
+				{1, 0, 0, 0, 0, 0}, {0, 1, 0, 0, 0, 0}, {0, 0, 1, 0, 0, 0},
+				{0, 0, 0, 1, 0, 0}, {0, 0, 0, 0, 1, 0}, {0, 0, 0, 0, 0, 1},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newChannelMapper(tt.in, tt.out)
+			if len(m.matrix) != len(tt.matrix) {
+				t.Fatalf("matrix has %d rows, want %d", len(m.matrix), len(tt.matrix))
+			}
+			for o, row := range tt.matrix {
+				for i, want := range row {
+					if got := float64(m.matrix[o][i]); math.Abs(got-want) > 1e-6 {
+						t.Fatalf("matrix[%d][%d] = %v, want %v", o, i, got, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestChannelMapperProcess(t *testing.T) {
+	const c = downmixCoeff
+	n6 := float32(1 + 2*c)
+	tests := []struct {
+		name string
+		in   int
+		out  int
+		src  []float32
+		want []float32
+	}{
+		{"mono to stereo", 1, 2, []float32{0.5, -0.25}, []float32{0.5, 0.5, -0.25, -0.25}},
+		{"stereo to mono", 2, 1, []float32{1, 0, 0.5, -0.5}, []float32{0.5, 0}},
+		{
+			"5.1 to stereo", 6, 2,
+			// FL FR C LFE BL BR：LFE 被丢弃
+			[]float32{1, 0, 0, 1, 0, 0, 0, 0, 1, 1, 1, 0},
+			[]float32{1 / n6, 0, (c + c) / n6, c / n6},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newChannelMapper(tt.in, tt.out)
+			frames := len(tt.src) / tt.in
+			dst := make([]float32, frames*tt.out)
+			m.process(dst, tt.src, frames)
+			for i, want := range tt.want {
+				if math.Abs(float64(dst[i]-want)) > 1e-6 {
+					t.Fatalf("dst = %v, want %v", dst, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestChannelLayoutName(t *testing.T) {
+	tests := map[int]string{1: "mono", 2: "stereo", 6: "5.1", 8: "7.1", 9: ""}
+	for channels, want := range tests {
+		if got := channelLayoutName(channels); got != want {
+			t.Errorf("channelLayoutName(%d) = %q, want %q", channels, got, want)
+		}
+	}
+}
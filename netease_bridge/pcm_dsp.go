@@ -0,0 +1,214 @@
+package main
+
+/*
+#include <stdlib.h>
+*/
+import "C"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// DspProcessor 音频处理器，就地处理交错存放的 float32 PCM
+type DspProcessor interface {
+	// Configure 设置采样率和声道数（会清空内部状态），Process 之前调用
+	Configure(sampleRate, channels int)
+	// Process 处理 buffer 中的 frames 帧
+	Process(buffer []float32, frames int)
+	// Reset 清空内部状态（Seek 后调用）
+	Reset()
+}
+
+// DspConfig DSP 配置（JSON）
+type DspConfig struct {
+	Enabled  bool     `json:"enabled"`
+	Preset   string   `json:"preset"`   // 均衡器预设，见 NeteaseGetEqPresets
+	PreampDb float64  `json:"preampDb"` // 前级增益 (dB)，用于给均衡器提升留出余量
+	Bands    []EqBand `json:"bands"`    // 自定义频段，追加在预设之后
+
+	// 软限幅，防止均衡器提升后削波
+	SoftLimiter     bool    `json:"softLimiter"`
+	SoftThresholdDb float64 `json:"softThresholdDb"` // 软限幅起始电平 (dBFS)，0 表示默认 -1dB
+}
+
+// parseDspConfig 解析并校验 DSP 配置，空字符串返回 nil（关闭）
+func parseDspConfig(configJson string) (*DspConfig, error) {
+	if configJson == "" {
+		return nil, nil
+	}
+
+	var config DspConfig
+	if err := json.Unmarshal([]byte(configJson), &config); err != nil {
+		return nil, fmt.Errorf("Invalid DSP config: %w", err)
+	}
+
+	if config.Preset != "" {
+		if _, ok := eqPresets[config.Preset]; !ok {
+			return nil, fmt.Errorf("Invalid DSP config: unknown preset %q", config.Preset)
+		}
+	}
+	if config.PreampDb < -24 || config.PreampDb > 24 {
+		return nil, errors.New("Invalid DSP config: preampDb must be between -24 and 24")
+	}
+	for _, band := range config.Bands {
+		if err := band.validate(); err != nil {
+			return nil, fmt.Errorf("Invalid DSP config: %w", err)
+		}
+	}
+	if config.SoftThresholdDb != 0 && (config.SoftThresholdDb < -20 || config.SoftThresholdDb > -0.1) {
+		return nil, errors.New("Invalid DSP config: softThresholdDb must be between -20 and -0.1")
+	}
+
+	return &config, nil
+}
+
+// dspChain 按顺序执行的处理器链
+type dspChain struct {
+	processors []DspProcessor
+	sampleRate int
+	channels   int
+	version    int64 // 创建时的全局配置版本（使用全局配置时）
+}
+
+// newDspChain 根据配置创建处理器链，配置为空或未启用时返回 nil
+func newDspChain(config *DspConfig, sampleRate, channels int) *dspChain {
+	if config == nil || !config.Enabled {
+		return nil
+	}
+
+	chain := &dspChain{sampleRate: sampleRate, channels: channels}
+
+	var bands []EqBand
+	if config.Preset != "" {
+		bands, _ = presetBands(config.Preset)
+	}
+	bands = append(bands, config.Bands...)
+	if len(bands) > 0 || config.PreampDb != 0 {
+		chain.add(newEqualizer(bands, config.PreampDb))
+	}
+
+	if config.SoftLimiter {
+		thresholdDb := config.SoftThresholdDb
+		if thresholdDb == 0 {
+			thresholdDb = -1
+		}
+		chain.add(newSoftLimiter(thresholdDb))
+	}
+
+	return chain
+}
+
+// add 在链尾添加处理器
+func (c *dspChain) add(p DspProcessor) {
+	p.Configure(c.sampleRate, c.channels)
+	c.processors = append(c.processors, p)
+}
+
+func (c *dspChain) process(buffer []float32, frames int) {
+	for _, p := range c.processors {
+		p.Process(buffer, frames)
+	}
+}
+
+func (c *dspChain) reset() {
+	for _, p := range c.processors {
+		p.Reset()
+	}
+}
+
+var (
+	dspMutex         sync.Mutex
+	globalDspConfig  *DspConfig // 所有未单独设置 DSP 的流使用
+	globalDspVersion int64      // 每次修改全局配置递增，流据此重建处理器链
+)
+
+// getGlobalDsp 获取全局 DSP 配置及其版本
+func getGlobalDsp() (*DspConfig, int64) {
+	dspMutex.Lock()
+	defer dspMutex.Unlock()
+	return globalDspConfig, globalDspVersion
+}
+
+//export NeteaseSetDspConfig
+// NeteaseSetDspConfig 设置全局 DSP（对所有未单独设置的流立即生效）
+// configJson: DspConfig 的 JSON，空字符串关闭
+// 返回: 0 = 成功, -1 = 参数错误
+func NeteaseSetDspConfig(configJsonC *C.char) C.int {
+	config, err := parseDspConfig(C.GoString(configJsonC))
+	if err != nil {
+		setError(ErrInvalidArgument, err.Error())
+		return -1
+	}
+
+	dspMutex.Lock()
+	globalDspConfig = config
+	globalDspVersion++
+	dspMutex.Unlock()
+	return 0
+}
+
+//export NeteaseSetPcmStreamDsp
+// NeteaseSetPcmStreamDsp 为单个流设置 DSP（覆盖全局配置）
+// configJson: DspConfig 的 JSON，空字符串恢复使用全局配置
+// 返回: 0 = 成功, -1 = 失败
+func NeteaseSetPcmStreamDsp(streamIdC C.longlong, configJsonC *C.char) C.int {
+	configJson := C.GoString(configJsonC)
+	config, err := parseDspConfig(configJson)
+	if err != nil {
+		setError(ErrInvalidArgument, err.Error())
+		return -1
+	}
+
+	streamsMutex.Lock()
+	stream, exists := activeStreams[int64(streamIdC)]
+	streamsMutex.Unlock()
+
+	if !exists {
+		setError(ErrNotFound, "Stream not found")
+		return -1
+	}
+
+	stream.mutex.Lock()
+	stream.dspConfig = config
+	stream.dspOverride = configJson != ""
+	stream.dsp = nil // 下次读取时重建
+	stream.mutex.Unlock()
+	return 0
+}
+
+//export NeteaseGetEqPresets
+// NeteaseGetEqPresets 获取均衡器预设
+// 返回: JSON 字符串 {"frequencies": [...], "presets": {"rock": [...], ...}}
+func NeteaseGetEqPresets() *C.char {
+	result := struct {
+		Frequencies []float64            `json:"frequencies"`
+		Presets     map[string][]float64 `json:"presets"`
+	}{eqPresetFreqs, eqPresets}
+
+	jsonBytes, _ := json.Marshal(result)
+	return C.CString(string(jsonBytes))
+}
+
+// applyDsp 对输出的 PCM 应用 DSP（调用方需持有锁）
+func (s *PcmStream) applyDsp(buffer []float32, frames int) {
+	config, version := s.dspConfig, int64(0)
+	if !s.dspOverride {
+		config, version = getGlobalDsp()
+	}
+
+	rate, channels := s.outputSampleRate(), s.outputChannels()
+	if rate <= 0 {
+		return
+	}
+	if s.dsp == nil || s.dsp.version != version || s.dsp.sampleRate != rate || s.dsp.channels != channels {
+		s.dsp = newDspChain(config, rate, channels)
+		if s.dsp == nil {
+			// 记录版本，避免关闭状态下每次都重建
+			s.dsp = &dspChain{sampleRate: rate, channels: channels}
+		}
+		s.dsp.version = version
+	}
+	s.dsp.process(buffer, frames)
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// 均衡器频段类型
+const (
+	EqPeaking   = "peaking"
+	EqLowShelf  = "lowshelf"
+	EqHighShelf = "highshelf"
+	EqLowPass   = "lowpass"
+	EqHighPass  = "highpass"
+)
+
+// EqBand 均衡器的一个频段
+type EqBand struct {
+	Type   string  `json:"type"`   // 默认 "peaking"
+	Freq   float64 `json:"freq"`   // 中心/截止频率 (Hz)
+	GainDb float64 `json:"gainDb"` // 增益 (dB)，高通/低通忽略
+	Q      float64 `json:"q"`      // 品质因数，0 表示默认 (0.7071)
+}
+
+// 预设使用的 10 段图示均衡频率
+var eqPresetFreqs = []float64{31, 62, 125, 250, 500, 1000, 2000, 4000, 8000, 16000}
+
+// eqPresets 预设的各频段增益 (dB)
+var eqPresets = map[string][]float64{
+	"flat":       {0, 0, 0, 0, 0, 0, 0, 0, 0, 0},
+	"bass_boost": {6, 5, 4, 2, 0, 0, 0, 0, 0, 0},
+	"treble":     {0, 0, 0, 0, 0, 0, 2, 4, 5, 6},
+	"vocal":      {-2, -2, -1, 1, 3, 3, 2, 1, 0, -1},
+	"pop":        {-1, 1, 3, 4, 3, 0, -1, -1, 1, 2},
+	"rock":       {4, 3, 2, 0, -1, -1, 1, 3, 4, 4},
+	"jazz":       {3, 2, 1, 2, -1, -1, 0, 1, 2, 3},
+	"classical":  {3, 2, 1, 0, 0, 0, -1, -1, 1, 2},
+	"electronic": {5, 4, 1, 0, -2, 1, 0, 1, 4, 5},
+	"acoustic":   {3, 3, 2, 1, 1, 1, 2, 2, 2, 1},
+}
+
+// presetBands 把预设展开为峰值频段
+func presetBands(name string) ([]EqBand, error) {
+	gains, ok := eqPresets[name]
+	if !ok {
+		return nil, fmt.Errorf("Unknown equalizer preset: %s", name)
+	}
+	bands := make([]EqBand, len(gains))
+	for i, gain := range gains {
+		bands[i] = EqBand{Type: EqPeaking, Freq: eqPresetFreqs[i], GainDb: gain, Q: 1.41}
+	}
+	return bands, nil
+}
+
+// validate 检查频段参数
+func (b EqBand) validate() error {
+	switch b.Type {
+	case "", EqPeaking, EqLowShelf, EqHighShelf, EqLowPass, EqHighPass:
+	default:
+		return fmt.Errorf("Unknown equalizer band type: %s", b.Type)
+	}
+	if b.Freq < 10 || b.Freq > 40000 {
+		return errors.New("Equalizer band frequency must be between 10 and 40000 Hz")
+	}
+	if b.GainDb < -24 || b.GainDb > 24 {
+		return errors.New("Equalizer band gain must be between -24 and 24 dB")
+	}
+	if b.Q < 0 || b.Q > 20 {
+		return errors.New("Equalizer band Q must be between 0 and 20")
+	}
+	return nil
+}
+
+// coefficients 按 RBJ Audio EQ Cookbook 计算滤波器系数
+func (b EqBand) coefficients(sampleRate int) biquad {
+	freq := b.Freq
+	// 频率不能超过奈奎斯特频率
+	if nyquist := float64(sampleRate) * 0.49; freq > nyquist {
+		freq = nyquist
+	}
+	q := b.Q
+	if q == 0 {
+		q = math.Sqrt2 / 2
+	}
+
+	w0 := 2 * math.Pi * freq / float64(sampleRate)
+	cosW, sinW := math.Cos(w0), math.Sin(w0)
+	alpha := sinW / (2 * q)
+	a := math.Pow(10, b.GainDb/40)
+
+	var b0, b1, b2, a0, a1, a2 float64
+	switch b.Type {
+	case EqLowShelf:
+		sq := 2 * math.Sqrt(a) * alpha
+		b0 = a * ((a + 1) - (a-1)*cosW + sq)
+		b1 = 2 * a * ((a - 1) - (a+1)*cosW)
+		b2 = a * ((a + 1) - (a-1)*cosW - sq)
+		a0 = (a + 1) + (a-1)*cosW + sq
+		a1 = -2 * ((a - 1) + (a+1)*cosW)
+		a2 = (a + 1) + (a-1)*cosW - sq
+	case EqHighShelf:
+		sq := 2 * math.Sqrt(a) * alpha
+		b0 = a * ((a + 1) + (a-1)*cosW + sq)
+		b1 = -2 * a * ((a - 1) + (a+1)*cosW)
+		b2 = a * ((a + 1) + (a-1)*cosW - sq)
+		a0 = (a + 1) - (a-1)*cosW + sq
+		a1 = 2 * ((a - 1) - (a+1)*cosW)
+		a2 = (a + 1) - (a-1)*cosW - sq
+	case EqLowPass:
+		b0 = (1 - cosW) / 2
+		b1 = 1 - cosW
+		b2 = (1 - cosW) / 2
+		a0 = 1 + alpha
+		a1 = -2 * cosW
+		a2 = 1 - alpha
+	case EqHighPass:
+		b0 = (1 + cosW) / 2
+		b1 = -(1 + cosW)
+		b2 = (1 + cosW) / 2
+		a0 = 1 + alpha
+		a1 = -2 * cosW
+		a2 = 1 - alpha
+	default: // 峰值
+		b0 = 1 + alpha*a
+		b1 = -2 * cosW
+		b2 = 1 - alpha*a
+		a0 = 1 + alpha/a
+		a1 = -2 * cosW
+		a2 = 1 - alpha/a
+	}
+
+	return biquad{b0: b0 / a0, b1: b1 / a0, b2: b2 / a0, a1: a1 / a0, a2: a2 / a0}
+}
+
+// equalizer 多段参数均衡器（含前级增益）
+type equalizer struct {
+	bands    []EqBand
+	preamp   float32
+	channels int
+	filters  [][]biquad // [频段][声道]
+}
+
+func newEqualizer(bands []EqBand, preampDb float64) *equalizer {
+	return &equalizer{
+		bands:  bands,
+		preamp: float32(math.Pow(10, preampDb/20)),
+	}
+}
+
+func (eq *equalizer) Configure(sampleRate, channels int) {
+	eq.channels = channels
+	eq.filters = make([][]biquad, 0, len(eq.bands))
+	for _, band := range eq.bands {
+		// 增益为 0 的峰值/搁架频段不起作用，跳过
+		if band.GainDb == 0 && band.Type != EqLowPass && band.Type != EqHighPass {
+			continue
+		}
+		coeffs := band.coefficients(sampleRate)
+		perChannel := make([]biquad, channels)
+		for c := range perChannel {
+			perChannel[c] = coeffs
+		}
+		eq.filters = append(eq.filters, perChannel)
+	}
+}
+
+func (eq *equalizer) Process(buffer []float32, frames int) {
+	ch := eq.channels
+	for i := 0; i < frames*ch; i++ {
+		buffer[i] *= eq.preamp
+	}
+	for _, perChannel := range eq.filters {
+		for c := 0; c < ch; c++ {
+			f := &perChannel[c]
+			for i := c; i < frames*ch; i += ch {
+				buffer[i] = float32(f.process(float64(buffer[i])))
+			}
+		}
+	}
+}
+
+func (eq *equalizer) Reset() {
+	for _, perChannel := range eq.filters {
+		for c := range perChannel {
+			perChannel[c].x1, perChannel[c].x2, perChannel[c].y1, perChannel[c].y2 = 0, 0, 0, 0
+		}
+	}
+}
+
+// softLimiter 软限幅：阈值以下保持线性，以上用 tanh 曲线平滑压缩，输出不超过 ±1
+type softLimiter struct {
+	threshold float32
+	channels  int
+}
+
+func newSoftLimiter(thresholdDb float64) *softLimiter {
+	return &softLimiter{threshold: float32(math.Pow(10, thresholdDb/20))}
+}
+
+func (l *softLimiter) Configure(sampleRate, channels int) {
+	l.channels = channels
+}
+
+func (l *softLimiter) Process(buffer []float32, frames int) {
+	t := l.threshold
+	knee := 1 - t
+	for i := 0; i < frames*l.channels; i++ {
+		x := buffer[i]
+		switch {
+		case x > t:
+			buffer[i] = t + knee*float32(math.Tanh(float64((x-t)/knee)))
+		case x < -t:
+			buffer[i] = -t - knee*float32(math.Tanh(float64((-x-t)/knee)))
+		}
+	}
+}
+
+func (l *softLimiter) Reset() {}
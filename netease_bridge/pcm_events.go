@@ -0,0 +1,233 @@
+package main
+
+/*
+#include <stdlib.h>
+*/
+import "C"
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// 流事件类型
+const (
+	EventReady         = "ready"         // 解码器已缓冲足够的数据，可以开始读取（欠载后重新缓冲完成时也会发送）
+	EventBuffering     = "buffering"     // 正在等待数据（Seek 到未下载的位置等）
+	EventUnderrun      = "underrun"      // 读取时没有可用数据（播放中断）
+	EventStalled       = "stalled"       // 等待数据时下载停滞（恢复后发送 buffering）
+	EventCacheProgress = "cacheProgress" // 下载进度变化（progress 为百分比）
+	EventCacheComplete = "cacheComplete" // 下载完成
+	EventSeekCompleted = "seekCompleted" // Seek 完成（包括延迟执行的 Seek）
+	EventTrackChanged  = "trackChanged"  // 已切换到链接的下一首（songId 为新歌曲）
+	EventEOF           = "eof"           // 流已结束
+	EventError         = "error"         // 出错（message 为错误信息）
+
+	// 下载任务事件（streamId 为 0，jobId 为任务 ID）
+	EventDownloadProgress = "downloadProgress" // 一首歌曲下载完成或失败（songId 为该歌曲，progress 为任务进度百分比，失败时 message 为原因）
+	EventDownloadComplete = "downloadComplete" // 任务结束（有歌曲失败时 message 为失败数量）
+)
+
+// 队列上限，超出时丢弃最旧的事件
+const maxQueuedEvents = 1024
+
+// 内部检查就绪状态和下载进度的间隔
+const eventWatchInterval = 50 * time.Millisecond
+
+// StreamEvent 流事件
+type StreamEvent struct {
+	StreamId int64   `json:"streamId"`
+	JobId    int64   `json:"jobId,omitempty"`
+	Type     string  `json:"type"`
+	SongId   int64   `json:"songId,omitempty"`
+	Progress float64 `json:"progress,omitempty"`
+	Position int64   `json:"position,omitempty"`
+	Message  string  `json:"message,omitempty"`
+	Time     int64   `json:"time"` // Unix 毫秒
+}
+
+var (
+	eventsMutex sync.Mutex
+	eventQueue  []StreamEvent
+	eventSignal = make(chan struct{}, 1) // 有新事件时通知等待中的 NeteasePollEvents
+)
+
+// pushEvent 添加事件（可以在持有流锁时调用）
+func pushEvent(event StreamEvent) {
+	event.Time = time.Now().UnixMilli()
+
+	eventsMutex.Lock()
+	// 同一个流未取走的下载进度只保留最新的一条
+	if event.Type == EventCacheProgress {
+		for i := range eventQueue {
+			if eventQueue[i].Type == EventCacheProgress && eventQueue[i].StreamId == event.StreamId {
+				eventQueue[i] = event
+				eventsMutex.Unlock()
+				return
+			}
+		}
+	}
+	if len(eventQueue) >= maxQueuedEvents {
+		eventQueue = eventQueue[1:]
+	}
+	eventQueue = append(eventQueue, event)
+	eventsMutex.Unlock()
+
+	select {
+	case eventSignal <- struct{}{}:
+	default:
+	}
+}
+
+//export NeteasePollEvents
+// NeteasePollEvents 取出所有待处理的流事件
+// timeoutMs: 没有事件时最多等待的毫秒数，0 表示立即返回（可以在后台线程中阻塞等待）
+// 返回: JSON 数组字符串（StreamEvent），没有事件时为 "[]"
+func NeteasePollEvents(timeoutMsC C.int) *C.char {
+	timeout := time.Duration(timeoutMsC) * time.Millisecond
+
+	eventsMutex.Lock()
+	empty := len(eventQueue) == 0
+	eventsMutex.Unlock()
+
+	if empty && timeout > 0 {
+		timer := time.NewTimer(timeout)
+		select {
+		case <-eventSignal:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+
+	eventsMutex.Lock()
+	events := eventQueue
+	eventQueue = nil
+	eventsMutex.Unlock()
+
+	if events == nil {
+		events = []StreamEvent{}
+	}
+	jsonBytes, _ := json.Marshal(events)
+	return C.CString(string(jsonBytes))
+}
+
+// streamEventState 流的事件状态，用于只在状态变化时发送事件（受流锁保护）
+type streamEventState struct {
+	ready        bool
+	progress     int // 已报告的下载进度（整数百分比）
+	hasOutput    bool
+	underrun     bool
+	ended        bool
+	failed       bool
+	stopWatching chan struct{}
+}
+
+// startEventWatcher 在后台检查就绪状态和下载进度的变化
+func (s *PcmStream) startEventWatcher() {
+	s.events.progress = -1
+	s.events.stopWatching = make(chan struct{})
+	go func(stop chan struct{}) {
+		ticker := time.NewTicker(eventWatchInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+
+			s.mutex.Lock()
+			s.checkEvents()
+			s.mutex.Unlock()
+		}
+	}(s.events.stopWatching)
+}
+
+// stopEventWatcher 停止后台检查（调用方需持有锁）
+func (s *PcmStream) stopEventWatcher() {
+	if s.events.stopWatching != nil {
+		close(s.events.stopWatching)
+		s.events.stopWatching = nil
+	}
+}
+
+// checkEvents 检查状态变化并发送事件（调用方需持有锁）
+func (s *PcmStream) checkEvents() {
+	if s.cache == nil {
+		return
+	}
+
+	ready := s.decoderReady() && !s.isPaused
+	if ready != s.events.ready {
+		s.events.ready = ready
+		if ready {
+			s.emitEvent(StreamEvent{Type: EventReady})
+		} else {
+			s.emitEvent(StreamEvent{Type: EventBuffering})
+		}
+	}
+
+	s.checkStall()
+
+	if !s.cache.IsComplete() {
+		if progress := int(s.cache.GetProgress()); progress > s.events.progress {
+			s.events.progress = progress
+			s.emitEvent(StreamEvent{Type: EventCacheProgress, Progress: float64(progress)})
+		}
+	}
+}
+
+// emitEvent 发送本流的事件（调用方需持有锁）
+func (s *PcmStream) emitEvent(event StreamEvent) {
+	event.StreamId = s.id
+	event.SongId = s.songId
+	pushEvent(event)
+}
+
+// trackReadResult 根据读取结果发送欠载、结束和错误事件（调用方需持有锁）
+func (s *PcmStream) trackReadResult(result int) {
+	switch {
+	case result > 0:
+		s.events.hasOutput = true
+		s.events.underrun = false
+		s.updateBufferState(result, false)
+	case result == 0:
+		// 开始输出后读不到数据说明下载或解码跟不上
+		underrun := s.events.hasOutput && !s.events.underrun && !s.isPaused
+		if underrun {
+			s.events.underrun = true
+			s.emitEvent(StreamEvent{Type: EventUnderrun, Position: s.currentPosition()})
+		}
+		s.updateBufferState(result, underrun)
+	case result == -2:
+		// 有链接的下一首时由切换逻辑发送 trackChanged
+		if !s.events.ended && s.next == nil {
+			s.events.ended = true
+			s.emitEvent(StreamEvent{Type: EventEOF})
+		}
+	default:
+		s.emitError(s.lastError)
+	}
+}
+
+// emitError 发送错误事件，每个流只发送一次（调用方需持有锁）
+func (s *PcmStream) emitError(message string) {
+	if s.events.failed {
+		return
+	}
+	s.events.failed = true
+	if message == "" {
+		message = "Decode error"
+	}
+	s.emitEvent(StreamEvent{Type: EventError, Message: message})
+}
+
+// resetPlaybackEvents Seek 后重新开始跟踪欠载和结束（调用方需持有锁）
+func (s *PcmStream) resetPlaybackEvents() {
+	s.events.hasOutput = false
+	s.events.underrun = false
+	s.events.ended = false
+	s.buffering.state = BufferStateBuffering
+	s.buffering.rebuffering = false
+	s.buffering.lastGrowth = time.Now()
+}
@@ -0,0 +1,443 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/mewkiz/flac/frame"
+)
+
+// flacSeekPoint SEEKTABLE 中的一个定位点
+type flacSeekPoint struct {
+	sample uint64 // 目标帧的第一个样本
+	offset int64  // 目标帧相对第一个音频帧的字节偏移
+}
+
+// flacHeaderInfo 从 FLAC 文件头部解析出的信息，用于在下载完成前定位任意样本
+type flacHeaderInfo struct {
+	sampleRate    int
+	channels      int
+	bitsPerSample int
+	totalSamples  uint64
+	minBlockSize  int
+	maxFrameSize  int
+	audioStart    int64 // 第一个音频帧的偏移
+	seekPoints    []flacSeekPoint
+}
+
+// parseFlacHeaderInfo 解析 FLAC 元数据块（STREAMINFO、SEEKTABLE）
+// readAt 读取文件中指定位置的数据，数据不可用时返回 false
+func parseFlacHeaderInfo(readAt func(p []byte, off int64) bool) (*flacHeaderInfo, error) {
+	head := make([]byte, 10)
+	if !readAt(head, 0) {
+		return nil, errors.New("header not available")
+	}
+
+	// 部分文件在 fLaC 标记前带有 ID3v2 标签
+	offset := id3v2Size(head)
+	if offset > 0 && !readAt(head[:4], offset) {
+		return nil, errors.New("header not available")
+	}
+	if string(head[:4]) != "fLaC" {
+		return nil, errors.New("not a FLAC stream")
+	}
+	offset += 4
+
+	info := &flacHeaderInfo{}
+	blockHeader := make([]byte, 4)
+	for {
+		if !readAt(blockHeader, offset) {
+			return nil, errors.New("header not available")
+		}
+		isLast := blockHeader[0]&0x80 != 0
+		blockType := blockHeader[0] & 0x7F
+		length := int64(blockHeader[1])<<16 | int64(blockHeader[2])<<8 | int64(blockHeader[3])
+		offset += 4
+
+		switch blockType {
+		case 0: // STREAMINFO
+			if length < 34 {
+				return nil, errors.New("invalid STREAMINFO")
+			}
+			b := make([]byte, 34)
+			if !readAt(b, offset) {
+				return nil, errors.New("header not available")
+			}
+			info.minBlockSize = int(binary.BigEndian.Uint16(b[0:]))
+			info.maxFrameSize = int(b[7])<<16 | int(b[8])<<8 | int(b[9])
+			info.sampleRate = int(b[10])<<12 | int(b[11])<<4 | int(b[12])>>4
+			info.channels = int((b[12]>>1)&0x07) + 1
+			info.bitsPerSample = int((b[12]&0x01)<<4|b[13]>>4) + 1
+			info.totalSamples = uint64(b[13]&0x0F)<<32 | uint64(binary.BigEndian.Uint32(b[14:]))
+		case 3: // SEEKTABLE
+			b := make([]byte, length)
+			if !readAt(b, offset) {
+				return nil, errors.New("header not available")
+			}
+			for p := 0; p+18 <= len(b); p += 18 {
+				sample := binary.BigEndian.Uint64(b[p:])
+				if sample == 0xFFFFFFFFFFFFFFFF {
+					continue // 占位点
+				}
+				info.seekPoints = append(info.seekPoints, flacSeekPoint{
+					sample: sample,
+					offset: int64(binary.BigEndian.Uint64(b[p+8:])),
+				})
+			}
+		}
+
+		offset += length
+		if isLast {
+			break
+		}
+	}
+
+	if info.sampleRate == 0 || info.bitsPerSample < 4 {
+		return nil, errors.New("missing STREAMINFO")
+	}
+	info.audioStart = offset
+	return info, nil
+}
+
+// FlacStreamingDecoder FLAC 流式解码器，从任意位置开始在后台逐帧解码（边下边播和 Seek 都使用）
+// 数据通过 CacheReader 读取：读到未下载的位置时等待（并请求优先下载），不需要重新打开文件
+// 从中间开始时先通过 SEEKTABLE 或二分查找定位目标样本所在的帧
+type FlacStreamingDecoder struct {
+	cache     *AudioCache
+	header    *flacHeaderInfo // 文件头（创建时未知则在解码协程中读取）
+	target    uint64          // 目标样本位置
+	reader    *CacheReader
+	mutex     sync.Mutex
+	ring      *pcmRingBuffer // 已解码的 PCM 数据（知道文件头后创建）
+	bufferCfg decodeBufferConfig
+	openWait  time.Duration // 等待文件头下载的最长时间
+	isReady   bool
+	isEOF     bool
+	lastError string
+	isClosed  bool
+	stopChan  chan struct{}
+}
+
+const (
+	// 距离目标小于该时长时直接从定位点解码并丢弃多余样本，不再继续二分
+	flacSeekCloseEnoughSeconds = 2
+	// 二分查找时每次读取的窗口大小
+	flacSeekSearchWindow = 64 * 1024
+)
+
+// NewFlacStreamingDecoder 创建从 targetSample 开始输出的 FLAC 解码器
+// header 为 nil 时由解码协程从缓存读取文件头（最多等待 openTimeout）
+// bufferCfg: 缓冲区容量和预缓冲时长
+func NewFlacStreamingDecoder(cache *AudioCache, header *flacHeaderInfo, targetSample uint64, bufferCfg decodeBufferConfig, openTimeout time.Duration) (*FlacStreamingDecoder, error) {
+	reader, err := cache.NewReader()
+	if err != nil {
+		return nil, err
+	}
+
+	d := &FlacStreamingDecoder{
+		cache:     cache,
+		header:    header,
+		target:    targetSample,
+		reader:    reader,
+		bufferCfg: bufferCfg,
+		openWait:  openTimeout,
+		stopChan:  make(chan struct{}),
+	}
+	go d.decodeLoop()
+	return d, nil
+}
+
+func (d *FlacStreamingDecoder) decodeLoop() {
+	h := d.header
+	if h == nil {
+		// 超时后关闭读取器，让等待下载的读取立即返回
+		timer := time.AfterFunc(d.openWait, func() { d.reader.Close() })
+		header, err := parseFlacHeaderInfo(d.readAt)
+		if !timer.Stop() {
+			d.setError(errors.New("Timed out waiting for FLAC header"))
+			return
+		}
+		if err != nil {
+			d.setError(err)
+			return
+		}
+		h = header
+	}
+
+	d.mutex.Lock()
+	d.header = h
+	d.ring = newPcmRingBuffer(h.sampleRate, h.channels, d.bufferCfg.seconds)
+	if d.isClosed {
+		d.ring.Close()
+	}
+	ring := d.ring
+	d.mutex.Unlock()
+
+	offset, sample, err := d.locate()
+	if err != nil {
+		d.setError(err)
+		return
+	}
+
+	if _, err := d.reader.Seek(offset, io.SeekStart); err != nil {
+		d.setError(err)
+		return
+	}
+	br := bufio.NewReaderSize(d.reader, 64*1024)
+
+	scale := 1.0 / float64(int(1)<<(h.bitsPerSample-1))
+	readyTarget := ring.readyTarget(h.sampleRate, h.channels, d.bufferCfg.prebufferSeconds)
+	var samples []float32
+
+	for {
+		select {
+		case <-d.stopChan:
+			return
+		default:
+		}
+
+		f, err := frame.Parse(br)
+		if err != nil {
+			if err == io.EOF || (h.totalSamples > 0 && sample >= h.totalSamples) {
+				d.setError(nil)
+			} else {
+				d.setError(err)
+			}
+			return
+		}
+
+		nSamples := len(f.Subframes[0].Samples)
+		// 丢弃目标位置之前的样本
+		skip := 0
+		if sample < d.target {
+			skip = int(d.target - sample)
+			if skip > nSamples {
+				skip = nSamples
+			}
+		}
+
+		// 转换为 float32 并交错存放
+		samples = samples[:0]
+		for i := skip; i < nSamples; i++ {
+			for ch := 0; ch < h.channels; ch++ {
+				if ch < len(f.Subframes) {
+					samples = append(samples, float32(float64(f.Subframes[ch].Samples[i])*scale))
+				}
+			}
+		}
+		sample += uint64(nSamples)
+
+		// 缓冲区满时在这里等待读取方腾出空间，关闭后返回 false
+		if !ring.Write(samples) {
+			return
+		}
+
+		d.mutex.Lock()
+		if !d.isReady && ring.Len() >= readyTarget {
+			d.isReady = true
+		}
+		d.mutex.Unlock()
+	}
+}
+
+// readAt 读取文件中指定位置的数据（未下载时等待）
+func (d *FlacStreamingDecoder) readAt(p []byte, off int64) bool {
+	if _, err := d.reader.Seek(off, io.SeekStart); err != nil {
+		return false
+	}
+	_, err := io.ReadFull(d.reader, p)
+	return err == nil
+}
+
+// locate 查找不晚于目标样本的帧，返回帧的字节偏移和第一个样本的位置
+func (d *FlacStreamingDecoder) locate() (int64, uint64, error) {
+	h := d.header
+	target := d.target
+	loOff, loSample := h.audioStart, uint64(0)
+
+	// 优先使用 SEEKTABLE
+	for _, p := range h.seekPoints {
+		if p.sample > target {
+			break
+		}
+		loOff, loSample = h.audioStart+p.offset, p.sample
+	}
+
+	closeEnough := uint64(h.sampleRate * flacSeekCloseEnoughSeconds)
+	hiOff := d.cache.GetTotalSize()
+	hiSample := h.totalSamples
+	if hiOff <= 0 || hiSample <= target {
+		return loOff, loSample, nil
+	}
+
+	// 二分查找（按样本位置插值）
+	for i := 0; i < 16; i++ {
+		if target-loSample <= closeEnough || hiOff-loOff <= flacSeekSearchWindow {
+			break
+		}
+
+		ratio := float64(target-loSample) / float64(hiSample-loSample)
+		guess := loOff + int64(ratio*float64(hiOff-loOff))
+		// 稍微往前估计，尽量落在目标帧之前
+		guess -= int64(h.maxFrameSize)
+		if guess <= loOff {
+			guess = loOff + 1
+		}
+		if guess >= hiOff {
+			break
+		}
+
+		off, sample, found, err := d.findFrame(guess, hiOff)
+		if err != nil {
+			return 0, 0, err
+		}
+		if !found || sample > target {
+			hiOff = guess
+			if found {
+				hiSample = sample
+			}
+			continue
+		}
+		loOff, loSample = off, sample
+	}
+
+	return loOff, loSample, nil
+}
+
+// findFrame 在 [pos, limit) 中查找第一个有效的帧头，返回帧偏移和第一个样本的位置
+func (d *FlacStreamingDecoder) findFrame(pos, limit int64) (int64, uint64, bool, error) {
+	size := int64(flacSeekSearchWindow)
+	if pos+size > limit {
+		size = limit - pos
+	}
+	if size < 16 {
+		return 0, 0, false, nil
+	}
+
+	window := make([]byte, size)
+	if _, err := d.reader.Seek(pos, io.SeekStart); err != nil {
+		return 0, 0, false, err
+	}
+	n, err := io.ReadFull(d.reader, window)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return 0, 0, false, err
+	}
+	window = window[:n]
+
+	h := d.header
+	for i := 0; i+2 < len(window); i++ {
+		// 帧同步码 0xFFF8（固定块大小）或 0xFFF9（可变块大小）
+		if window[i] != 0xFF || window[i+1]&0xFE != 0xF8 {
+			continue
+		}
+		f, err := frame.New(bytes.NewReader(window[i:]))
+		if err != nil {
+			continue
+		}
+		if f.SampleRate != 0 && int(f.SampleRate) != h.sampleRate {
+			continue
+		}
+		if f.BitsPerSample != 0 && int(f.BitsPerSample) != h.bitsPerSample {
+			continue
+		}
+
+		sample := f.Num
+		if f.HasFixedBlockSize {
+			sample = f.Num * uint64(h.minBlockSize)
+		}
+		if h.totalSamples > 0 && sample >= h.totalSamples {
+			continue
+		}
+		return pos + int64(i), sample, true, nil
+	}
+	return 0, 0, false, nil
+}
+
+func (d *FlacStreamingDecoder) setError(err error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.isClosed {
+		return
+	}
+	if err != nil {
+		d.lastError = err.Error()
+	}
+	d.isEOF = true
+	// 即使出错也设置 isReady，避免 C# 端无限等待
+	d.isReady = true
+}
+
+// GetInfo 获取音频信息（读到文件头之前采样率和声道数为 0）
+func (d *FlacStreamingDecoder) GetInfo() (sampleRate, channels int, isReady bool, errStr string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.header != nil {
+		sampleRate, channels = d.header.sampleRate, d.header.channels
+	}
+	return sampleRate, channels, d.isReady, d.lastError
+}
+
+// Read 读取 PCM 数据
+// 返回: 读取的帧数，0=暂无数据，-2=EOF
+func (d *FlacStreamingDecoder) Read(buffer []float32, framesToRead int) int {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.isClosed {
+		return -2
+	}
+	if d.ring == nil || d.ring.Len() == 0 {
+		if d.isEOF {
+			return -2
+		}
+		return 0
+	}
+	if !d.isReady {
+		return 0
+	}
+
+	channels := d.header.channels
+	return d.ring.Read(buffer[:framesToRead*channels]) / channels
+}
+
+// Buffered 获取已缓冲的帧数、缓冲区容量（帧）和是否已解码到结尾
+func (d *FlacStreamingDecoder) Buffered() (frames, capacity int, finished bool) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.ring != nil {
+		channels := d.header.channels
+		frames, capacity = d.ring.Len()/channels, d.ring.Cap()/channels
+	}
+	return frames, capacity, d.isEOF
+}
+
+// IsEOF 是否结束
+func (d *FlacStreamingDecoder) IsEOF() bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.isEOF && (d.ring == nil || d.ring.Len() == 0)
+}
+
+// Close 关闭解码器
+func (d *FlacStreamingDecoder) Close() {
+	d.mutex.Lock()
+	if d.isClosed {
+		d.mutex.Unlock()
+		return
+	}
+	d.isClosed = true
+	close(d.stopChan)
+	ring := d.ring
+	d.mutex.Unlock()
+
+	// 唤醒可能正在等待数据或缓冲区空间的解码协程
+	if ring != nil {
+		ring.Close()
+	}
+	d.reader.Close()
+}
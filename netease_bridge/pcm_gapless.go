@@ -0,0 +1,84 @@
+package main
+
+// MP3 解码器固有的延迟（MDCT 重叠 + 合成滤波器），即 LAME 文档中的 528 + 1
+const mp3DecoderDelay = 529
+
+// gaplessTrimmer 去除 MP3 解码输出中开头的编码器延迟和末尾的填充，实现无缝播放
+// 位置以解码器输出的 PCM 帧计算（包含被裁掉的部分）
+type gaplessTrimmer struct {
+	startSkip   int64 // 开头需要丢弃的帧数（Xing 帧本身 + 编码器延迟 + 解码器延迟）
+	validFrames int64 // 有效帧数，0 表示未知（不裁剪末尾）
+	position    int64 // 当前解码输出位置
+}
+
+// newGaplessTrimmer 根据 Xing/LAME 头创建裁剪器，没有相关信息时返回 nil
+func newGaplessTrimmer(info *mp3StreamInfo) *gaplessTrimmer {
+	if info == nil || !info.hasXing {
+		return nil
+	}
+
+	// Xing/Info 帧是一个不含音频的有效帧，解码器会输出一帧静音
+	t := &gaplessTrimmer{startSkip: int64(info.samplesPerFrame)}
+	if info.hasLame {
+		t.startSkip += int64(info.encoderDelay + mp3DecoderDelay)
+		if info.xingFrames > 0 {
+			valid := int64(info.xingFrames)*int64(info.samplesPerFrame) - int64(info.encoderDelay+info.encoderPadding)
+			if valid > 0 {
+				t.validFrames = valid
+			}
+		}
+	}
+	return t
+}
+
+// decoderFrame 把裁剪后的帧位置换算为解码器输出位置
+func (t *gaplessTrimmer) decoderFrame(frame int64) int64 {
+	return frame + t.startSkip
+}
+
+// seek 解码器 Seek 到 decoderFrame(frame) 后调用
+func (t *gaplessTrimmer) seek(frame int64) {
+	t.position = t.decoderFrame(frame)
+}
+
+// isFinished 是否已输出全部有效帧
+func (t *gaplessTrimmer) isFinished() bool {
+	return t.validFrames > 0 && t.position >= t.startSkip+t.validFrames
+}
+
+// trim 裁剪刚解码出的 frames 帧（交错存放在 buffer 中），返回保留的帧数
+func (t *gaplessTrimmer) trim(buffer []float32, frames, channels int) int {
+	start := t.position
+	t.position += int64(frames)
+
+	keepFrom := 0
+	if start < t.startSkip {
+		keepFrom = int(min64(t.startSkip-start, int64(frames)))
+	}
+	keepTo := frames
+	if t.validFrames > 0 {
+		end := t.startSkip + t.validFrames - start
+		if end < int64(keepTo) {
+			keepTo = int(max64(end, int64(keepFrom)))
+		}
+	}
+
+	if keepFrom > 0 && keepTo > keepFrom {
+		copy(buffer, buffer[keepFrom*channels:keepTo*channels])
+	}
+	return keepTo - keepFrom
+}
+
+func min64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
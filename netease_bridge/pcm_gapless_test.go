@@ -0,0 +1,131 @@
+package main
+
+import "testing"
+
+func TestNewGaplessTrimmer(t *testing.T) {
+	tests := []struct {
+		name        string
+		info        *mp3StreamInfo
+		nilTrimmer  bool
+		startSkip   int64
+		validFrames int64
+	}{
+		{"no info", nil, true, 0, 0},
+		{"no xing header", &mp3StreamInfo{samplesPerFrame: 1152}, true, 0, 0},
+		{"xing without lame", &mp3StreamInfo{samplesPerFrame: 1152, hasXing: true, xingFrames: 10}, false, 1152, 0},
+		{
+			"lame delay and padding",
+			&mp3StreamInfo{samplesPerFrame: 1152, hasXing: true, xingFrames: 10, hasLame: true, encoderDelay: 576, encoderPadding: 1000},
+			false, 1152 + 576 + mp3DecoderDelay, 10*1152 - 1576,
+		},
+		{
+			"lame without frame count",
+			&mp3StreamInfo{samplesPerFrame: 1152, hasXing: true, hasLame: true, encoderDelay: 576, encoderPadding: 1000},
+			false, 1152 + 576 + mp3DecoderDelay, 0,
+		},
+		{
+			"padding longer than the audio",
+			&mp3StreamInfo{samplesPerFrame: 576, hasXing: true, xingFrames: 1, hasLame: true, encoderDelay: 400, encoderPadding: 400},
+			false, 576 + 400 + mp3DecoderDelay, 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trimmer := newGaplessTrimmer(tt.info)
+			if tt.nilTrimmer {
+				if trimmer != nil {
+					t.Fatalf("got trimmer %+v, want nil", trimmer)
+				}
+				return
+			}
+			if trimmer == nil {
+				t.Fatal("got nil trimmer")
+			}
+			if trimmer.startSkip != tt.startSkip || trimmer.validFrames != tt.validFrames {
+				t.Fatalf("startSkip=%d validFrames=%d, want %d, %d", trimmer.startSkip, trimmer.validFrames, tt.startSkip, tt.validFrames)
+			}
+		})
+	}
+}
+
+// trimAll 把解码器输出位置 [from, to) 按 chunk 帧一次送入裁剪器，返回保留下来的帧（每帧的值为解码器位置）
+func trimAll(trimmer *gaplessTrimmer, from, to int64, chunk, channels int) []float32 {
+	var kept []float32
+	buffer := make([]float32, chunk*channels)
+	for pos := from; pos < to; pos += int64(chunk) {
+		frames := chunk
+		if rest := to - pos; rest < int64(frames) {
+			frames = int(rest)
+		}
+		for f := 0; f < frames; f++ {
+			for c := 0; c < channels; c++ {
+				buffer[f*channels+c] = float32(pos+int64(f)) + float32(c)*0.25
+			}
+		}
+		n := trimmer.trim(buffer, frames, channels)
+		kept = append(kept, buffer[:n*channels]...)
+	}
+	return kept
+}
+
+func TestGaplessTrimmerTrim(t *testing.T) {
+	info := &mp3StreamInfo{samplesPerFrame: 1152, hasXing: true, xingFrames: 10, hasLame: true, encoderDelay: 576, encoderPadding: 1000}
+	const decoded = 11 * 1152 // Xing 帧 + 10 个音频帧
+	const startSkip = 1152 + 576 + mp3DecoderDelay
+	const validFrames = 10*1152 - 1576
+
+	tests := []struct {
+		name     string
+		seekTo   int64 // 裁剪后的位置，-1 表示从头解码
+		chunk    int
+		channels int
+	}{
+		{"frame sized chunks", -1, 1152, 1},
+		{"odd chunks stereo", -1, 1000, 2},
+		{"large chunks", -1, 4096, 2},
+		{"everything at once", -1, decoded, 1},
+		{"single frames around the edges", -1, 1, 1},
+		{"after seek", 5000, 700, 2},
+		{"seek to the last frame", validFrames - 1, 64, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trimmer := newGaplessTrimmer(info)
+			from, first := int64(0), int64(startSkip)
+			if tt.seekTo >= 0 {
+				from = trimmer.decoderFrame(tt.seekTo)
+				first = from
+				trimmer.seek(tt.seekTo)
+			}
+			kept := trimAll(trimmer, from, decoded, tt.chunk, tt.channels)
+
+			wantFrames := int(startSkip + validFrames - first)
+			if len(kept) != wantFrames*tt.channels {
+				t.Fatalf("kept %d frames, want %d", len(kept)/tt.channels, wantFrames)
+			}
+			for f := 0; f < wantFrames; f++ {
+				for c := 0; c < tt.channels; c++ {
+					want := float32(first+int64(f)) + float32(c)*0.25
+					if got := kept[f*tt.channels+c]; got != want {
+						t.Fatalf("frame %d channel %d = %v, want %v", f, c, got, want)
+					}
+				}
+			}
+			if !trimmer.isFinished() {
+				t.Fatal("trimmer not finished after the padding")
+			}
+		})
+	}
+}
+
+func TestGaplessTrimmerWithoutLength(t *testing.T) {
+	// 没有帧数时只裁剪开头，不会提前结束
+	trimmer := newGaplessTrimmer(&mp3StreamInfo{samplesPerFrame: 1152, hasXing: true})
+	kept := trimAll(trimmer, 0, 5000, 512, 1)
+	if len(kept) != 5000-1152 || kept[0] != 1152 {
+		t.Fatalf("kept %d frames starting at %v, want %d starting at 1152", len(kept), kept[0], 5000-1152)
+	}
+	if trimmer.isFinished() {
+		t.Fatal("trimmer without a length should never finish")
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import "math"
+
+const (
+	limiterCeiling     = 0.8912509381337456 // -1 dBTP
+	limiterLookaheadMs = 5
+	limiterReleaseMs   = 150
+	truePeakTaps       = 12 // 4 倍过采样插值滤波器每个相位的抽头数
+	truePeakPhases     = 4
+	gainRampSeconds    = 0.5 // 增益变化（例如测量结果在播放中途得到）时的过渡时长
+)
+
+// truePeakFilter 4 倍过采样的插值系数（相位 1~3，相位 0 为原始采样点）
+var truePeakFilter = func() [truePeakPhases][truePeakTaps]float64 {
+	var filter [truePeakPhases][truePeakTaps]float64
+	for p := 1; p < truePeakPhases; p++ {
+		frac := float64(p) / truePeakPhases
+		var sum float64
+		for j := 0; j < truePeakTaps; j++ {
+			// 插值点位于第 taps/2-1 和 taps/2 个采样之间
+			d := float64(j-truePeakTaps/2+1) - frac
+			filter[p][j] = sinc(d) * kaiser(d/(truePeakTaps/2), 6)
+			sum += filter[p][j]
+		}
+		for j := range filter[p] {
+			filter[p][j] /= sum
+		}
+	}
+	return filter
+}()
+
+// truePeakLimiter 带前视的真峰值限制器
+// 通过 4 倍过采样估计采样点之间的峰值，增益包络先取前视窗口内的最小值再做平滑，
+// 保证峰值到达时增益已经降到位。输出相对输入延迟 delay 帧
+type truePeakLimiter struct {
+	channels  int
+	lookahead int
+	delay     int
+
+	history []float32 // 每个声道最近 truePeakTaps 个采样（环形）
+	histPos int
+
+	// 前视窗口最小值（单调队列）
+	index   int64
+	minIdx  []int64
+	minGain []float64
+
+	release  float64 // 释放系数
+	envelope float64
+
+	// 平滑（滑动平均）
+	box    []float64
+	boxPos int
+	boxSum float64
+
+	delayLine []float32
+	delayPos  int
+}
+
+func newTruePeakLimiter(sampleRate, channels int) *truePeakLimiter {
+	lookahead := sampleRate * limiterLookaheadMs / 1000
+	if lookahead < 1 {
+		lookahead = 1
+	}
+	l := &truePeakLimiter{
+		channels:  channels,
+		lookahead: lookahead,
+		delay:     lookahead + truePeakTaps/2 - 1,
+		release:   math.Exp(-1 / (float64(sampleRate) * limiterReleaseMs / 1000)),
+	}
+	l.reset()
+	return l
+}
+
+// reset 清空内部状态（Seek 后调用）
+func (l *truePeakLimiter) reset() {
+	l.history = make([]float32, truePeakTaps*l.channels)
+	l.histPos = 0
+	l.index = 0
+	l.minIdx = l.minIdx[:0]
+	l.minGain = l.minGain[:0]
+	l.envelope = 1
+	l.box = make([]float64, l.lookahead)
+	for i := range l.box {
+		l.box[i] = 1
+	}
+	l.boxPos = 0
+	l.boxSum = float64(l.lookahead)
+	l.delayLine = make([]float32, l.delay*l.channels)
+	l.delayPos = 0
+}
+
+// peak 估计刚加入历史的采样附近的真峰值
+func (l *truePeakLimiter) peak() float64 {
+	var peak float64
+	for c := 0; c < l.channels; c++ {
+		hist := l.history[c*truePeakTaps : (c+1)*truePeakTaps]
+		// 中心采样点
+		center := float64(hist[(l.histPos+truePeakTaps/2-1)%truePeakTaps])
+		peak = math.Max(peak, math.Abs(center))
+		for p := 1; p < truePeakPhases; p++ {
+			var v float64
+			for j := 0; j < truePeakTaps; j++ {
+				v += float64(hist[(l.histPos+j)%truePeakTaps]) * truePeakFilter[p][j]
+			}
+			peak = math.Max(peak, math.Abs(v))
+		}
+	}
+	return peak
+}
+
+// processFrame 处理一帧（in 和 out 可以相同）
+func (l *truePeakLimiter) processFrame(in, out []float32) {
+	// 更新过采样历史（histPos 指向最旧的采样）
+	for c := 0; c < l.channels; c++ {
+		l.history[c*truePeakTaps+l.histPos] = in[c]
+	}
+	l.histPos = (l.histPos + 1) % truePeakTaps
+
+	required := 1.0
+	if peak := l.peak(); peak > limiterCeiling {
+		required = limiterCeiling / peak
+	}
+
+	// 前视窗口 (lookahead + 1 帧) 内的最小增益
+	for len(l.minGain) > 0 && l.minGain[len(l.minGain)-1] >= required {
+		l.minGain = l.minGain[:len(l.minGain)-1]
+		l.minIdx = l.minIdx[:len(l.minIdx)-1]
+	}
+	l.minGain = append(l.minGain, required)
+	l.minIdx = append(l.minIdx, l.index)
+	for l.minIdx[0] < l.index-int64(l.lookahead) {
+		l.minGain = l.minGain[1:]
+		l.minIdx = l.minIdx[1:]
+	}
+	l.index++
+	hold := l.minGain[0]
+
+	// 立即压缩，缓慢释放
+	if hold < l.envelope {
+		l.envelope = hold
+	} else {
+		l.envelope = hold + (l.envelope-hold)*l.release
+	}
+
+	l.boxSum += l.envelope - l.box[l.boxPos]
+	l.box[l.boxPos] = l.envelope
+	l.boxPos = (l.boxPos + 1) % l.lookahead
+	gain := float32(l.boxSum / float64(l.lookahead))
+
+	// 延迟输出
+	base := l.delayPos * l.channels
+	for c := 0; c < l.channels; c++ {
+		delayed := l.delayLine[base+c]
+		l.delayLine[base+c] = in[c]
+		out[c] = delayed * gain
+	}
+	l.delayPos = (l.delayPos + 1) % l.delay
+}
+
+// loudnessStage 响度标准化：应用增益并通过真峰值限制器防止削波
+type loudnessStage struct {
+	sampleRate int
+	channels   int
+	limiter    *truePeakLimiter
+	gain       float64 // 当前线性增益
+	targetGain float64
+	gainStep   float64 // 每帧增益变化量
+	flushLeft  int     // 源结束后还需要输出的延迟帧数
+	srcEOF     bool
+	frame      []float32
+}
+
+func newLoudnessStage(sampleRate, channels int) *loudnessStage {
+	st := &loudnessStage{
+		sampleRate: sampleRate,
+		channels:   channels,
+		limiter:    newTruePeakLimiter(sampleRate, channels),
+		gain:       1,
+		targetGain: 1,
+		frame:      make([]float32, channels),
+	}
+	return st
+}
+
+// setGainDb 设置目标增益，从当前增益平滑过渡
+func (st *loudnessStage) setGainDb(gainDb float64) {
+	st.targetGain = math.Pow(10, gainDb/20)
+	st.gainStep = math.Abs(st.targetGain-st.gain) / (gainRampSeconds * float64(st.sampleRate))
+}
+
+// reset Seek 后调用（增益保持不变）
+func (st *loudnessStage) reset() {
+	st.limiter.reset()
+	st.flushLeft = 0
+	st.srcEOF = false
+}
+
+// process 从 read 读取 PCM 并应用增益和限制器
+// 返回: 帧数，0 = 暂无数据，-1 = 错误，-2 = EOF
+func (st *loudnessStage) process(buffer []float32, framesToRead int, read func(buffer []float32, frames int) int) int {
+	ch := st.channels
+
+	if st.srcEOF {
+		// 输出限制器中剩余的延迟数据
+		if st.flushLeft == 0 {
+			return -2
+		}
+		n := framesToRead
+		if n > st.flushLeft {
+			n = st.flushLeft
+		}
+		for i := range st.frame {
+			st.frame[i] = 0
+		}
+		for f := 0; f < n; f++ {
+			st.limiter.processFrame(st.frame, buffer[f*ch:f*ch+ch])
+		}
+		st.flushLeft -= n
+		return n
+	}
+
+	n := read(buffer, framesToRead)
+	if n == -2 {
+		st.srcEOF = true
+		st.flushLeft = st.limiter.delay
+		return st.process(buffer, framesToRead, read)
+	}
+	if n <= 0 {
+		return n
+	}
+
+	for f := 0; f < n; f++ {
+		if st.gain != st.targetGain {
+			if st.gain < st.targetGain {
+				st.gain = math.Min(st.gain+st.gainStep, st.targetGain)
+			} else {
+				st.gain = math.Max(st.gain-st.gainStep, st.targetGain)
+			}
+		}
+		frame := buffer[f*ch : f*ch+ch]
+		for c := range frame {
+			frame[c] *= float32(st.gain)
+		}
+		st.limiter.processFrame(frame, frame)
+	}
+	return n
+}
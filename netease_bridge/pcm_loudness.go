@@ -0,0 +1,462 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// 响度标准化模式
+const (
+	LoudnessOff   = "off"
+	LoudnessTrack = "track" // 按单曲响度
+	LoudnessAlbum = "album" // 按专辑响度（同专辑曲目使用相同增益，保留曲目间的响度差异）
+)
+
+const (
+	defaultTargetLufs = -18.0 // ReplayGain 2.0 参考响度
+	maxLoudnessBoost  = 12.0  // 最大提升 (dB)，避免把极安静的曲目放大到失真
+	maxLoudnessCut    = -30.0 // 最大衰减 (dB)
+)
+
+// ---------------------------------------------------------------------------
+// EBU R128 / ITU-R BS.1770 积分响度测量
+// ---------------------------------------------------------------------------
+
+// biquad 二阶 IIR 滤波器（直接 I 型，每个声道独立状态）
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+	x1, x2, y1, y2     float64
+}
+
+func (f *biquad) process(x float64) float64 {
+	y := f.b0*x + f.b1*f.x1 + f.b2*f.x2 - f.a1*f.y1 - f.a2*f.y2
+	f.x2, f.x1 = f.x1, x
+	f.y2, f.y1 = f.y1, y
+	return y
+}
+
+// newKWeightingFilters 按采样率计算 BS.1770 的 K 计权滤波器（高架 + 高通）
+func newKWeightingFilters(sampleRate int) (shelf, highpass biquad) {
+	fs := float64(sampleRate)
+
+	f0 := 1681.974450955533
+	gain := 3.999843853973347
+	q := 0.7071752369554196
+	k := math.Tan(math.Pi * f0 / fs)
+	vh := math.Pow(10, gain/20)
+	vb := math.Pow(vh, 0.4996667741545416)
+	a0 := 1 + k/q + k*k
+	shelf = biquad{
+		b0: (vh + vb*k/q + k*k) / a0,
+		b1: 2 * (k*k - vh) / a0,
+		b2: (vh - vb*k/q + k*k) / a0,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+
+	f0 = 38.13547087602444
+	q = 0.5003270373238773
+	k = math.Tan(math.Pi * f0 / fs)
+	a0 = 1 + k/q + k*k
+	highpass = biquad{
+		b0: 1,
+		b1: -2,
+		b2: 1,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+	return
+}
+
+// loudnessChannelWeights 各声道的权重（FLAC 声道顺序，环绕声道 +1.5dB，LFE 不计入）
+func loudnessChannelWeights(channels int) []float64 {
+	weights := make([]float64, channels)
+	for i := range weights {
+		weights[i] = 1
+	}
+	switch channels {
+	case 4: // FL FR BL BR
+		weights[2], weights[3] = 1.41, 1.41
+	case 5: // FL FR C BL BR
+		weights[3], weights[4] = 1.41, 1.41
+	case 6: // FL FR C LFE BL BR
+		weights[3] = 0
+		weights[4], weights[5] = 1.41, 1.41
+	case 7: // FL FR C LFE BC SL SR
+		weights[3] = 0
+		weights[4], weights[5], weights[6] = 1.41, 1.41, 1.41
+	case 8: // FL FR C LFE BL BR SL SR
+		weights[3] = 0
+		weights[4], weights[5], weights[6], weights[7] = 1.41, 1.41, 1.41, 1.41
+	}
+	return weights
+}
+
+// ebur128Meter 积分响度测量器
+// 每 100ms 计算一次子块能量，400ms 块（75% 重叠）用于门限计算
+type ebur128Meter struct {
+	channels       int
+	weights        []float64
+	shelf          []biquad
+	highpass       []biquad
+	subBlockFrames int
+	subBlockPos    int
+	subBlockSum    float64
+	subBlocks      [4]float64
+	subBlockCount  int
+	blocks         []float64 // 每个 400ms 块的加权均方值
+	samplePeak     float64
+}
+
+func newEbur128Meter(sampleRate, channels int) *ebur128Meter {
+	m := &ebur128Meter{
+		channels:       channels,
+		weights:        loudnessChannelWeights(channels),
+		shelf:          make([]biquad, channels),
+		highpass:       make([]biquad, channels),
+		subBlockFrames: sampleRate / 10,
+	}
+	shelf, highpass := newKWeightingFilters(sampleRate)
+	for c := 0; c < channels; c++ {
+		m.shelf[c] = shelf
+		m.highpass[c] = highpass
+	}
+	return m
+}
+
+// add 加入 frames 帧交错的 PCM
+func (m *ebur128Meter) add(samples []float32, frames int) {
+	for f := 0; f < frames; f++ {
+		var energy float64
+		for c := 0; c < m.channels; c++ {
+			x := float64(samples[f*m.channels+c])
+			if abs := math.Abs(x); abs > m.samplePeak {
+				m.samplePeak = abs
+			}
+			y := m.highpass[c].process(m.shelf[c].process(x))
+			energy += m.weights[c] * y * y
+		}
+		m.subBlockSum += energy
+
+		m.subBlockPos++
+		if m.subBlockPos < m.subBlockFrames {
+			continue
+		}
+
+		// 一个 100ms 子块结束
+		m.subBlocks[m.subBlockCount%4] = m.subBlockSum / float64(m.subBlockFrames)
+		m.subBlockCount++
+		m.subBlockPos = 0
+		m.subBlockSum = 0
+		if m.subBlockCount >= 4 {
+			block := (m.subBlocks[0] + m.subBlocks[1] + m.subBlocks[2] + m.subBlocks[3]) / 4
+			m.blocks = append(m.blocks, block)
+		}
+	}
+}
+
+func energyToLufs(energy float64) float64 {
+	return -0.691 + 10*math.Log10(energy)
+}
+
+func lufsToEnergy(lufs float64) float64 {
+	return math.Pow(10, (lufs+0.691)/10)
+}
+
+// integrated 计算积分响度（绝对门限 -70 LUFS + 相对门限 -10 LU）
+// 返回响度和通过门限的块数，全部低于门限（静音）时块数为 0
+func (m *ebur128Meter) integrated() (lufs float64, gatedBlocks int) {
+	absThreshold := lufsToEnergy(-70)
+
+	var sum float64
+	var count int
+	for _, block := range m.blocks {
+		if block > absThreshold {
+			sum += block
+			count++
+		}
+	}
+	if count == 0 {
+		return -70, 0
+	}
+
+	relThreshold := lufsToEnergy(energyToLufs(sum/float64(count)) - 10)
+	sum, count = 0, 0
+	for _, block := range m.blocks {
+		if block > absThreshold && block > relThreshold {
+			sum += block
+			count++
+		}
+	}
+	if count == 0 {
+		return -70, 0
+	}
+	return energyToLufs(sum / float64(count)), count
+}
+
+// measureFileLoudness 解码完整的缓存文件并测量响度
+func measureFileLoudness(path string, format AudioFormat) (lufs float64, gatedBlocks int, samplePeak float64, err error) {
+	var read func(buffer []float32, frames int) int
+	var sampleRate, channels int
+
+	if format.usesPacketDecoder() {
+		dec, err := openPacketFile(path, format)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		defer dec.Close()
+		sampleRate, channels = dec.GetInfo()
+		read = dec.ReadFrames
+	} else if format == FormatFLAC {
+		dec, err := NewFlacSeekableDecoder(path)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		defer dec.Close()
+		sampleRate, channels, _ = dec.GetInfo()
+		read = dec.ReadFrames
+	} else {
+		dec, err := NewSeekableDecoder(path)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		defer dec.Close()
+		sampleRate, channels, _ = dec.GetInfo()
+		read = dec.ReadFrames
+	}
+
+	if sampleRate <= 0 || channels <= 0 {
+		return 0, 0, 0, errors.New("unknown audio format")
+	}
+
+	const chunk = 4096
+	meter := newEbur128Meter(sampleRate, channels)
+	buffer := make([]float32, chunk*channels)
+	for {
+		n := read(buffer, chunk)
+		if n == -1 {
+			return 0, 0, 0, errors.New("decode error")
+		}
+		if n <= 0 {
+			break
+		}
+		meter.add(buffer, n)
+	}
+
+	lufs, gatedBlocks = meter.integrated()
+	return lufs, gatedBlocks, meter.samplePeak, nil
+}
+
+// ---------------------------------------------------------------------------
+// 响度数据持久化
+// ---------------------------------------------------------------------------
+
+// LoudnessEntry 一首歌的响度测量结果
+type LoudnessEntry struct {
+	SongID         int64   `json:"songId"`
+	AlbumID        int64   `json:"albumId,omitempty"`
+	IntegratedLufs float64 `json:"integratedLufs"`
+	Blocks         int     `json:"blocks"` // 通过门限的 400ms 块数，0 表示静音；专辑响度按此加权
+	SamplePeak     float64 `json:"samplePeak"`
+}
+
+// LoudnessStore 保存在 dataDir/loudness.json 中的响度数据
+type LoudnessStore struct {
+	path    string
+	mutex   sync.Mutex
+	entries map[int64]*LoudnessEntry
+	albums  map[int64]int64 // 尚未测量的歌曲所属的专辑
+	pending map[int64]bool  // 正在测量的歌曲
+}
+
+var loudnessStore *LoudnessStore
+
+// 同一时间只测量一首，避免占用过多 CPU
+var loudnessWorker = make(chan struct{}, 1)
+
+// initLoudnessStore 加载响度数据
+func initLoudnessStore(dataDir string) {
+	ls := &LoudnessStore{
+		path:    filepath.Join(dataDir, "loudness.json"),
+		entries: make(map[int64]*LoudnessEntry),
+		albums:  make(map[int64]int64),
+		pending: make(map[int64]bool),
+	}
+
+	if data, err := os.ReadFile(ls.path); err == nil {
+		var entries []*LoudnessEntry
+		if json.Unmarshal(data, &entries) == nil {
+			for _, entry := range entries {
+				ls.entries[entry.SongID] = entry
+			}
+		}
+	}
+
+	loudnessStore = ls
+}
+
+// saveLocked 保存响度数据（调用方需持有锁）
+func (ls *LoudnessStore) saveLocked() {
+	entries := make([]*LoudnessEntry, 0, len(ls.entries))
+	for _, entry := range ls.entries {
+		entries = append(entries, entry)
+	}
+
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return
+	}
+	tmpPath := ls.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return
+	}
+	os.Rename(tmpPath, ls.path)
+}
+
+// SetAlbum 记录歌曲所属的专辑（专辑模式使用）
+func (ls *LoudnessStore) SetAlbum(songId, albumId int64) {
+	if albumId <= 0 {
+		return
+	}
+	ls.mutex.Lock()
+	defer ls.mutex.Unlock()
+
+	if entry, ok := ls.entries[songId]; ok {
+		if entry.AlbumID != albumId {
+			entry.AlbumID = albumId
+			ls.saveLocked()
+		}
+		return
+	}
+	ls.albums[songId] = albumId
+}
+
+// Get 获取歌曲的测量结果
+func (ls *LoudnessStore) Get(songId int64) (LoudnessEntry, bool) {
+	ls.mutex.Lock()
+	defer ls.mutex.Unlock()
+	entry, ok := ls.entries[songId]
+	if !ok {
+		return LoudnessEntry{}, false
+	}
+	return *entry, true
+}
+
+// Gain 计算歌曲的增益 (dB)，没有测量结果时 ok 为 false
+// 专辑模式下按同专辑已测量曲目的块数加权合并响度
+func (ls *LoudnessStore) Gain(songId int64, mode string, albumId int64, targetLufs float64) (gainDb float64, ok bool) {
+	ls.mutex.Lock()
+	defer ls.mutex.Unlock()
+
+	entry, ok := ls.entries[songId]
+	if !ok {
+		return 0, false
+	}
+	if entry.Blocks == 0 {
+		return 0, true // 静音，不调整
+	}
+
+	lufs := entry.IntegratedLufs
+	if mode == LoudnessAlbum {
+		if albumId <= 0 {
+			albumId = entry.AlbumID
+		}
+		if albumId > 0 {
+			var energy float64
+			var blocks int
+			for _, e := range ls.entries {
+				if e.AlbumID == albumId && e.Blocks > 0 {
+					energy += lufsToEnergy(e.IntegratedLufs) * float64(e.Blocks)
+					blocks += e.Blocks
+				}
+			}
+			if blocks > 0 {
+				lufs = energyToLufs(energy / float64(blocks))
+			}
+		}
+	}
+
+	gainDb = targetLufs - lufs
+	return math.Max(maxLoudnessCut, math.Min(maxLoudnessBoost, gainDb)), true
+}
+
+// Analyze 在后台测量完整缓存的响度（已测量或正在测量时不做任何事）
+// cache 为正在播放的缓存：离线时可能是其他音质的缓存或离线下载的文件
+func (ls *LoudnessStore) Analyze(songId int64, cache *AudioCache) {
+	source := loudnessSource{
+		quality:  cache.quality,
+		path:     cache.GetCachePath(),
+		format:   audioFormatFromType(cache.format),
+		external: cache.external,
+	}
+
+	ls.mutex.Lock()
+	if _, measured := ls.entries[songId]; measured || ls.pending[songId] {
+		ls.mutex.Unlock()
+		return
+	}
+	ls.pending[songId] = true
+	ls.mutex.Unlock()
+
+	go func() {
+		loudnessWorker <- struct{}{}
+		defer func() { <-loudnessWorker }()
+
+		entry, err := ls.measure(songId, source)
+
+		ls.mutex.Lock()
+		defer ls.mutex.Unlock()
+		delete(ls.pending, songId)
+		if err != nil {
+			return
+		}
+		if albumId, ok := ls.albums[songId]; ok {
+			entry.AlbumID = albumId
+			delete(ls.albums, songId)
+		}
+		ls.entries[songId] = entry
+		ls.saveLocked()
+	}()
+}
+
+// loudnessSource 要测量的音频文件
+type loudnessSource struct {
+	quality  string
+	path     string
+	format   AudioFormat
+	external bool // 离线下载的文件（不由缓存管理器管理，直接读取）
+}
+
+// measure 测量响度，缓存中的文件在测量期间持有引用（防止被淘汰）
+func (ls *LoudnessStore) measure(songId int64, source loudnessSource) (*LoudnessEntry, error) {
+	path := source.path
+	if !source.external {
+		if audioCacheManager == nil {
+			return nil, errors.New("Not initialized")
+		}
+		cache := audioCacheManager.Acquire(songId, source.quality)
+		if cache == nil {
+			return nil, errors.New("audio not cached")
+		}
+		defer cache.Close()
+		if !cache.IsComplete() {
+			return nil, errors.New("audio not fully downloaded")
+		}
+		path = cache.GetCachePath()
+	}
+
+	lufs, blocks, peak, err := measureFileLoudness(path, source.format)
+	if err != nil {
+		return nil, err
+	}
+	return &LoudnessEntry{
+		SongID:         songId,
+		IntegratedLufs: lufs,
+		Blocks:         blocks,
+		SamplePeak:     peak,
+	}, nil
+}
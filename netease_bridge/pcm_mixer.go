@@ -0,0 +1,505 @@
+package main
+
+/*
+#include <stdlib.h>
+*/
+import "C"
+import (
+	"encoding/json"
+	"math"
+	"sync"
+	"unsafe"
+)
+
+// CrossfadeCurve 交叉淡化曲线
+type CrossfadeCurve int
+
+const (
+	CurveEqualPower CrossfadeCurve = iota // 等功率（cos/sin），响度更平稳
+	CurveLinear                           // 线性
+)
+
+// gains 返回淡化进度 t (0~1) 处淡出和淡入的增益
+func (c CrossfadeCurve) gains(t float64) (out, in float32) {
+	if c == CurveLinear {
+		return float32(1 - t), float32(t)
+	}
+	return float32(math.Cos(t * math.Pi / 2)), float32(math.Sin(t * math.Pi / 2))
+}
+
+// PcmMixer 在两个 PcmStream 之间交叉淡化，输出一路 PCM
+// 当前歌曲剩余时长小于淡化时长时（根据 totalFrames 判断）提前开始读取下一首
+// 加入混音器的流由混音器接管，原句柄不再可用
+type PcmMixer struct {
+	id           int64
+	current      *PcmStream // 正在播放（淡出）的流
+	next         *PcmStream // 排队中（淡入）的流
+	crossfadeMs  int
+	curve        CrossfadeCurve
+	position     int64 // current 已输出的帧数
+	nextPosition int64 // next 已输出的帧数（淡化期间）
+	fading       bool
+	fadePos      int64 // 淡化已进行的帧数
+	fadeLength   int64 // 本次淡化的总帧数
+	mixBuffer    []float32
+	mutex        sync.Mutex
+}
+
+var (
+	mixersMutex  sync.Mutex
+	activeMixers       = make(map[int64]*PcmMixer)
+	nextMixerId  int64 = 1
+)
+
+// PcmMixerInfo 返回给 C# 的混音器信息
+type PcmMixerInfo struct {
+	MixerId       int64   `json:"mixerId"`
+	CurrentSongId int64   `json:"currentSongId"`
+	NextSongId    int64   `json:"nextSongId"` // 0 表示没有排队的歌曲
+	SampleRate    int     `json:"sampleRate"`
+	Position      int64   `json:"position"`    // 当前歌曲的播放位置（帧）
+	TotalFrames   uint64  `json:"totalFrames"` // 当前歌曲的总帧数，0 表示未知
+	IsFading      bool    `json:"isFading"`
+	FadeProgress  float64 `json:"fadeProgress"` // 0~1
+	IsEOF         bool    `json:"isEOF"`
+}
+
+// takeStream 从活动流中取出流（由混音器接管）
+func takeStream(streamId int64) *PcmStream {
+	streamsMutex.Lock()
+	defer streamsMutex.Unlock()
+	stream, exists := activeStreams[streamId]
+	if !exists {
+		return nil
+	}
+	delete(activeStreams, streamId)
+	return stream
+}
+
+func closeStream(stream *PcmStream) {
+	if stream == nil {
+		return
+	}
+	stream.mutex.Lock()
+	stream.close()
+	stream.mutex.Unlock()
+}
+
+func getMixer(mixerId int64) *PcmMixer {
+	mixersMutex.Lock()
+	defer mixersMutex.Unlock()
+	return activeMixers[mixerId]
+}
+
+//export NeteaseCreateMixer
+// NeteaseCreateMixer 创建混音器并接管 streamId 作为当前歌曲
+// crossfadeMs: 淡化时长（毫秒），0 表示不淡化（直接无缝衔接）
+// curve: 0 = 等功率, 1 = 线性
+// 返回: 混音器 ID，-1 = 失败
+func NeteaseCreateMixer(streamIdC C.longlong, crossfadeMsC C.int, curveC C.int) C.longlong {
+	stream := takeStream(int64(streamIdC))
+	if stream == nil {
+		setError(ErrNotFound, "Stream not found")
+		return -1
+	}
+
+	mixer := &PcmMixer{
+		current:     stream,
+		crossfadeMs: int(crossfadeMsC),
+		curve:       CrossfadeCurve(curveC),
+	}
+
+	mixersMutex.Lock()
+	mixer.id = nextMixerId
+	nextMixerId++
+	activeMixers[mixer.id] = mixer
+	mixersMutex.Unlock()
+
+	return C.longlong(mixer.id)
+}
+
+//export NeteaseMixerQueueStream
+// NeteaseMixerQueueStream 设置下一首（接管 streamId），替换已排队的流
+// 返回: 0 = 成功, -1 = 失败
+func NeteaseMixerQueueStream(mixerIdC C.longlong, streamIdC C.longlong) C.int {
+	mixer := getMixer(int64(mixerIdC))
+	if mixer == nil {
+		setError(ErrNotFound, "Mixer not found")
+		return -1
+	}
+	stream := takeStream(int64(streamIdC))
+	if stream == nil {
+		setError(ErrNotFound, "Stream not found")
+		return -1
+	}
+
+	mixer.mutex.Lock()
+	previous := mixer.next
+	if mixer.current == nil {
+		// 当前没有歌曲，直接开始播放
+		mixer.current = stream
+		mixer.position = 0
+	} else {
+		mixer.next = stream
+	}
+	if mixer.fading {
+		// 正在淡入的流被替换，淡化终止，当前歌曲恢复原音量
+		mixer.fading = false
+	}
+	mixer.mutex.Unlock()
+
+	closeStream(previous)
+	return 0
+}
+
+//export NeteaseMixerSetCrossfade
+// NeteaseMixerSetCrossfade 修改淡化时长和曲线（对下一次淡化生效）
+func NeteaseMixerSetCrossfade(mixerIdC C.longlong, crossfadeMsC C.int, curveC C.int) C.int {
+	mixer := getMixer(int64(mixerIdC))
+	if mixer == nil {
+		setError(ErrNotFound, "Mixer not found")
+		return -1
+	}
+
+	mixer.mutex.Lock()
+	mixer.crossfadeMs = int(crossfadeMsC)
+	mixer.curve = CrossfadeCurve(curveC)
+	mixer.mutex.Unlock()
+	return 0
+}
+
+//export NeteaseMixerCrossfadeNow
+// NeteaseMixerCrossfadeNow 立即开始淡化到下一首（例如用户点击下一首）
+// 返回: 0 = 成功, -1 = 失败（没有排队的歌曲）
+func NeteaseMixerCrossfadeNow(mixerIdC C.longlong) C.int {
+	mixer := getMixer(int64(mixerIdC))
+	if mixer == nil {
+		setError(ErrNotFound, "Mixer not found")
+		return -1
+	}
+
+	mixer.mutex.Lock()
+	defer mixer.mutex.Unlock()
+
+	if mixer.current == nil || mixer.next == nil {
+		setError(ErrInvalidArgument, "No queued stream")
+		return -1
+	}
+	if !mixer.fading {
+		if length := mixer.crossfadeFrames(); length > 0 {
+			mixer.startFade(length)
+		} else {
+			mixer.advance()
+		}
+	}
+	return 0
+}
+
+//export NeteaseMixerRead
+// NeteaseMixerRead 读取混音后的 PCM 帧（交错的 float32，声道数为当前流的输出声道数）
+// 返回: 读取的帧数，0 = 暂无数据，-1 = 错误，-2 = 全部结束
+func NeteaseMixerRead(mixerIdC C.longlong, bufferPtr unsafe.Pointer, framesToReadC C.int) C.int {
+	mixer := getMixer(int64(mixerIdC))
+	if mixer == nil {
+		return -1
+	}
+
+	framesToRead := int(framesToReadC)
+
+	mixer.mutex.Lock()
+	defer mixer.mutex.Unlock()
+	buffer := (*[1 << 30]float32)(bufferPtr)[:framesToRead*mixer.outputChannels()]
+	return C.int(mixer.read(buffer, framesToRead))
+}
+
+//export NeteaseMixerSeek
+// NeteaseMixerSeek 在当前歌曲内跳转（会取消正在进行的淡化）
+// 返回: 同 NeteaseSeekPcmStream
+func NeteaseMixerSeek(mixerIdC C.longlong, frameIndexC C.longlong) C.int {
+	mixer := getMixer(int64(mixerIdC))
+	if mixer == nil {
+		return -1
+	}
+
+	mixer.mutex.Lock()
+	defer mixer.mutex.Unlock()
+
+	if mixer.current == nil {
+		return -1
+	}
+
+	if mixer.fading {
+		// 淡入的歌曲已经播放了一部分，回到开头
+		mixer.fading = false
+		mixer.next.mutex.Lock()
+		mixer.next.seek(0)
+		mixer.next.mutex.Unlock()
+	}
+
+	mixer.current.mutex.Lock()
+	result := mixer.current.seek(int64(frameIndexC))
+	mixer.current.mutex.Unlock()
+	if result >= 0 || result == -3 {
+		mixer.position = int64(frameIndexC)
+	}
+	return C.int(result)
+}
+
+//export NeteaseGetMixerInfo
+// NeteaseGetMixerInfo 获取混音器状态
+// 返回: JSON 字符串（PcmMixerInfo）
+func NeteaseGetMixerInfo(mixerIdC C.longlong) *C.char {
+	mixer := getMixer(int64(mixerIdC))
+	if mixer == nil {
+		setError(ErrNotFound, "Mixer not found")
+		return nil
+	}
+
+	mixer.mutex.Lock()
+	info := PcmMixerInfo{
+		MixerId:  mixer.id,
+		Position: mixer.position,
+		IsFading: mixer.fading,
+		IsEOF:    mixer.current == nil,
+	}
+	if mixer.current != nil {
+		mixer.current.mutex.Lock()
+		info.CurrentSongId = mixer.current.songId
+		info.SampleRate = mixer.current.outputSampleRate()
+		info.TotalFrames = mixer.current.toOutputFrames(mixer.current.totalFrames)
+		mixer.current.mutex.Unlock()
+	}
+	if mixer.next != nil {
+		info.NextSongId = mixer.next.songId
+	}
+	if mixer.fading && mixer.fadeLength > 0 {
+		info.FadeProgress = float64(mixer.fadePos) / float64(mixer.fadeLength)
+	}
+	mixer.mutex.Unlock()
+
+	jsonBytes, _ := json.Marshal(info)
+	return C.CString(string(jsonBytes))
+}
+
+//export NeteaseCloseMixer
+// NeteaseCloseMixer 关闭混音器及其接管的所有流
+func NeteaseCloseMixer(mixerIdC C.longlong) {
+	mixerId := int64(mixerIdC)
+
+	mixersMutex.Lock()
+	mixer, exists := activeMixers[mixerId]
+	if exists {
+		delete(activeMixers, mixerId)
+	}
+	mixersMutex.Unlock()
+
+	if !exists {
+		return
+	}
+
+	mixer.mutex.Lock()
+	current, next := mixer.current, mixer.next
+	mixer.current, mixer.next = nil, nil
+	mixer.mutex.Unlock()
+
+	closeStream(current)
+	closeStream(next)
+}
+
+// closeSessionMixerStreams 关闭混音器中由 session 创建的流（会话销毁时调用）
+// 当前歌曲被关闭时排队的歌曲成为当前歌曲
+func closeSessionMixerStreams(session *Session) {
+	mixersMutex.Lock()
+	mixers := make([]*PcmMixer, 0, len(activeMixers))
+	for _, mixer := range activeMixers {
+		mixers = append(mixers, mixer)
+	}
+	mixersMutex.Unlock()
+
+	for _, mixer := range mixers {
+		var closed []*PcmStream
+		mixer.mutex.Lock()
+		if mixer.next != nil && mixer.next.session == session {
+			closed = append(closed, mixer.next)
+			mixer.next = nil
+			mixer.fading = false
+		}
+		if mixer.current != nil && mixer.current.session == session {
+			closed = append(closed, mixer.current)
+			mixer.current = mixer.next
+			mixer.next = nil
+			if mixer.fading {
+				mixer.position = mixer.nextPosition
+			} else {
+				mixer.position = 0
+			}
+			mixer.fading = false
+		}
+		mixer.mutex.Unlock()
+
+		for _, stream := range closed {
+			closeStream(stream)
+		}
+	}
+}
+
+// crossfadeFrames 按当前歌曲的采样率计算淡化帧数（调用方需持有锁）
+func (m *PcmMixer) crossfadeFrames() int64 {
+	m.current.mutex.Lock()
+	sampleRate := m.current.outputSampleRate()
+	m.current.mutex.Unlock()
+	if sampleRate <= 0 {
+		sampleRate = 44100
+	}
+	return int64(m.crossfadeMs) * int64(sampleRate) / 1000
+}
+
+// startFade 开始淡化（调用方需持有锁）
+func (m *PcmMixer) startFade(length int64) {
+	m.fading = true
+	m.fadePos = 0
+	m.fadeLength = length
+	m.nextPosition = 0
+}
+
+// maybeStartFade 当前歌曲剩余时长不足淡化时长时开始淡化（调用方需持有锁）
+// 下一首还没有可以输出的数据时不开始，避免淡出到静音
+func (m *PcmMixer) maybeStartFade() {
+	if m.fading || m.next == nil || m.crossfadeMs <= 0 {
+		return
+	}
+
+	m.current.mutex.Lock()
+	totalFrames := int64(m.current.toOutputFrames(m.current.totalFrames))
+	currentRate := m.current.outputSampleRate()
+	currentChannels := m.current.outputChannels()
+	m.current.mutex.Unlock()
+	if totalFrames <= 0 {
+		return // 总长度未知，只能在结束时直接衔接
+	}
+
+	// 输出格式不同的歌曲无法直接混合，结束时直接衔接（创建流时指定相同的 outputSampleRate 即可）
+	m.next.mutex.Lock()
+	nextRate := m.next.outputSampleRate()
+	nextChannels := m.next.outputChannels()
+	nextReady := m.next.decoderReady()
+	m.next.mutex.Unlock()
+	if (nextRate != 0 && nextRate != currentRate) || nextChannels != currentChannels {
+		return
+	}
+	if !nextReady {
+		return
+	}
+
+	length := m.crossfadeFrames()
+	if m.position >= totalFrames-length {
+		remaining := totalFrames - m.position
+		if remaining < length {
+			length = remaining
+		}
+		if length > 0 {
+			m.startFade(length)
+		}
+	}
+}
+
+// outputChannels 返回当前流的输出声道数（调用方需持有锁）
+func (m *PcmMixer) outputChannels() int {
+	if m.current == nil {
+		return 2
+	}
+	m.current.mutex.Lock()
+	defer m.current.mutex.Unlock()
+	return m.current.outputChannels()
+}
+
+// advance 切换到下一首（调用方需持有锁）
+func (m *PcmMixer) advance() {
+	closeStream(m.current)
+	m.current = m.next
+	m.next = nil
+	if m.fading {
+		m.position = m.nextPosition
+	} else {
+		m.position = 0
+	}
+	m.fading = false
+}
+
+// read 读取混音后的帧（调用方需持有锁）
+func (m *PcmMixer) read(buffer []float32, framesToRead int) int {
+	if m.current == nil {
+		return -2
+	}
+
+	m.maybeStartFade()
+
+	m.current.mutex.Lock()
+	n := m.current.readFrames(buffer, framesToRead)
+	m.current.mutex.Unlock()
+
+	if n == -2 {
+		// 当前歌曲结束，切换到下一首（淡化中则继续以正常音量播放）
+		if m.next == nil {
+			closeStream(m.current)
+			m.current = nil
+			return -2
+		}
+		m.advance()
+		m.current.mutex.Lock()
+		n = m.current.readFrames(buffer, framesToRead)
+		m.current.mutex.Unlock()
+		if n > 0 {
+			m.position += int64(n)
+		}
+		return n
+	}
+	if n <= 0 {
+		return n
+	}
+	m.position += int64(n)
+
+	if !m.fading {
+		return n
+	}
+
+	// 读取相同帧数的下一首并混合
+	channels := len(buffer) / framesToRead
+	if len(m.mixBuffer) < n*channels {
+		m.mixBuffer = make([]float32, n*channels)
+	}
+	m.next.mutex.Lock()
+	nextRead := m.next.readFrames(m.mixBuffer[:n*channels], n)
+	m.next.mutex.Unlock()
+	if nextRead < 0 {
+		nextRead = 0
+	}
+	m.nextPosition += int64(nextRead)
+
+	// 下一首暂时没有数据（缓冲中）时淡化进度停在当前位置，当前歌曲保持此时的音量
+	for i := 0; i < n; i++ {
+		step := i
+		if step > nextRead {
+			step = nextRead
+		}
+		t := float64(m.fadePos+int64(step)) / float64(m.fadeLength)
+		if t > 1 {
+			t = 1
+		}
+		gainOut, gainIn := m.curve.gains(t)
+		for ch := 0; ch < channels; ch++ {
+			var in float32
+			if i < nextRead {
+				in = m.mixBuffer[i*channels+ch]
+			}
+			buffer[i*channels+ch] = buffer[i*channels+ch]*gainOut + in*gainIn
+		}
+	}
+	m.fadePos += int64(nextRead)
+
+	if m.fadePos >= m.fadeLength {
+		// 淡化完成，下一首成为当前歌曲
+		m.advance()
+	}
+	return n
+}
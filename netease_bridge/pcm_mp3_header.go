@@ -0,0 +1,355 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// mp3StreamInfo 从 MP3 文件头部解析出的信息，用于在下载完成前把帧位置换算为字节偏移
+type mp3StreamInfo struct {
+	audioStart      int64 // 第一个 MPEG 帧的偏移（跳过 ID3v2 标签）
+	sampleRate      int
+	channels        int
+	bitrate         int // 第一帧的码率 (kbps)
+	samplesPerFrame int
+
+	// Xing/Info 头（VBR 或 LAME 编码的 CBR）
+	hasXing    bool
+	xingFrames uint32 // 音频帧数（不含 Xing 帧本身）
+	xingBytes  uint32 // 音频数据字节数
+	xingToc    []byte // 100 项目录，toc[i] = 第 i% 时间对应的字节位置 * 256 / xingBytes
+
+	// LAME 扩展头（编码器延迟和末尾填充，用于无缝播放）
+	hasLame        bool
+	encoderDelay   int // 开头的编码器延迟（采样数）
+	encoderPadding int // 末尾的填充（采样数）
+
+	// VBRI 头（Fraunhofer 编码器）
+	hasVbri    bool
+	vbriFrames uint32
+	vbriBytes  uint32
+	vbriToc    []int64 // 每项为该段起始的字节偏移（相对 audioStart）
+	vbriStep   uint32  // 每个目录项对应的帧数
+}
+
+// mp3 帧头中的码率表 (kbps)，索引为 [version][layer][bitrateIndex]
+// version: 0 = MPEG1, 1 = MPEG2/2.5；layer: 0 = Layer I, 1 = Layer II, 2 = Layer III
+var mp3BitrateTable = [2][3][16]int{
+	{
+		{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448, 0},
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384, 0},
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0},
+	},
+	{
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256, 0},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+	},
+}
+
+var mp3SampleRateTable = [3]int{44100, 48000, 32000}
+
+// mp3FrameHeader 解析后的 MPEG 音频帧头
+type mp3FrameHeader struct {
+	mpeg1           bool
+	layer           int // 1, 2, 3
+	bitrate         int // kbps
+	sampleRate      int
+	channels        int
+	frameSize       int
+	samplesPerFrame int
+}
+
+// parseMp3FrameHeader 解析 4 字节 MPEG 音频帧头
+func parseMp3FrameHeader(b []byte) (mp3FrameHeader, bool) {
+	var h mp3FrameHeader
+	if len(b) < 4 || b[0] != 0xFF || b[1]&0xE0 != 0xE0 {
+		return h, false
+	}
+
+	versionBits := (b[1] >> 3) & 0x03 // 00 = MPEG2.5, 10 = MPEG2, 11 = MPEG1
+	layerBits := (b[1] >> 1) & 0x03   // 01 = Layer III, 10 = Layer II, 11 = Layer I
+	bitrateIndex := b[2] >> 4
+	sampleRateIndex := (b[2] >> 2) & 0x03
+	padding := int((b[2] >> 1) & 0x01)
+	channelMode := b[3] >> 6
+
+	if versionBits == 0x01 || layerBits == 0 || bitrateIndex == 0 || bitrateIndex == 0x0F || sampleRateIndex == 0x03 {
+		return h, false
+	}
+
+	h.mpeg1 = versionBits == 0x03
+	h.layer = 4 - int(layerBits)
+	versionIndex := 1
+	if h.mpeg1 {
+		versionIndex = 0
+	}
+	h.bitrate = mp3BitrateTable[versionIndex][h.layer-1][bitrateIndex]
+
+	h.sampleRate = mp3SampleRateTable[sampleRateIndex]
+	switch versionBits {
+	case 0x02:
+		h.sampleRate /= 2
+	case 0x00:
+		h.sampleRate /= 4
+	}
+
+	h.channels = 2
+	if channelMode == 0x03 {
+		h.channels = 1
+	}
+
+	switch h.layer {
+	case 1:
+		h.samplesPerFrame = 384
+		h.frameSize = (12*h.bitrate*1000/h.sampleRate + padding) * 4
+	case 2:
+		h.samplesPerFrame = 1152
+		h.frameSize = 144*h.bitrate*1000/h.sampleRate + padding
+	default:
+		if h.mpeg1 {
+			h.samplesPerFrame = 1152
+			h.frameSize = 144*h.bitrate*1000/h.sampleRate + padding
+		} else {
+			h.samplesPerFrame = 576
+			h.frameSize = 72*h.bitrate*1000/h.sampleRate + padding
+		}
+	}
+
+	return h, h.frameSize > 4
+}
+
+// id3v2Size 返回 ID3v2 标签的总长度，没有标签时返回 0
+func id3v2Size(b []byte) int64 {
+	if len(b) < 10 || string(b[0:3]) != "ID3" {
+		return 0
+	}
+	size := int64(b[6]&0x7F)<<21 | int64(b[7]&0x7F)<<14 | int64(b[8]&0x7F)<<7 | int64(b[9]&0x7F)
+	size += 10
+	if b[5]&0x10 != 0 {
+		size += 10 // footer
+	}
+	return size
+}
+
+// parseMp3StreamInfo 解析 MP3 文件头部
+// readAt 读取文件中指定位置的数据，数据不可用时返回 false
+func parseMp3StreamInfo(readAt func(p []byte, off int64) bool) (*mp3StreamInfo, error) {
+	head := make([]byte, 10)
+	if !readAt(head, 0) {
+		return nil, errors.New("header not available")
+	}
+
+	// 跳过 ID3v2 标签（可能有多个）
+	var offset int64
+	for {
+		size := id3v2Size(head)
+		if size == 0 {
+			break
+		}
+		offset += size
+		if !readAt(head, offset) {
+			return nil, errors.New("header not available")
+		}
+	}
+
+	// 在标签之后查找第一个有效的帧（要求下一帧的帧头也有效，避免误判）
+	const searchWindow = 64 * 1024
+	window := make([]byte, searchWindow)
+	n := len(window)
+	for n > 0 && !readAt(window[:n], offset) {
+		n /= 2
+		if n < 4096 {
+			return nil, errors.New("header not available")
+		}
+	}
+	window = window[:n]
+
+	for i := 0; i+4 <= len(window); i++ {
+		h, ok := parseMp3FrameHeader(window[i:])
+		if !ok {
+			continue
+		}
+		next := i + h.frameSize
+		if next+4 <= len(window) {
+			if _, ok := parseMp3FrameHeader(window[next:]); !ok {
+				continue
+			}
+		}
+
+		info := &mp3StreamInfo{
+			audioStart:      offset + int64(i),
+			sampleRate:      h.sampleRate,
+			channels:        h.channels,
+			bitrate:         h.bitrate,
+			samplesPerFrame: h.samplesPerFrame,
+		}
+		if i+h.frameSize <= len(window) {
+			info.parseInfoFrame(window[i:i+h.frameSize], h)
+		}
+		return info, nil
+	}
+
+	return nil, errors.New("no MPEG audio frame found")
+}
+
+// parseInfoFrame 解析第一帧中的 Xing/Info 或 VBRI 头
+func (info *mp3StreamInfo) parseInfoFrame(frame []byte, h mp3FrameHeader) {
+	// Xing 头位于帧头和 side info 之后
+	sideInfo := 32
+	switch {
+	case h.mpeg1 && h.channels == 1:
+		sideInfo = 17
+	case !h.mpeg1 && h.channels == 2:
+		sideInfo = 17
+	case !h.mpeg1 && h.channels == 1:
+		sideInfo = 9
+	}
+
+	pos := 4 + sideInfo
+	if pos+8 <= len(frame) {
+		tag := string(frame[pos : pos+4])
+		if tag == "Xing" || tag == "Info" {
+			flags := binary.BigEndian.Uint32(frame[pos+4:])
+			p := pos + 8
+			if flags&0x01 != 0 && p+4 <= len(frame) {
+				info.xingFrames = binary.BigEndian.Uint32(frame[p:])
+				p += 4
+			}
+			if flags&0x02 != 0 && p+4 <= len(frame) {
+				info.xingBytes = binary.BigEndian.Uint32(frame[p:])
+				p += 4
+			}
+			if flags&0x04 != 0 && p+100 <= len(frame) {
+				info.xingToc = append([]byte(nil), frame[p:p+100]...)
+				p += 100
+			}
+			if flags&0x08 != 0 {
+				p += 4 // 质量指示
+			}
+			info.hasXing = true
+
+			// LAME 扩展头紧跟在 Xing 头之后，偏移 21 处为 12 位延迟 + 12 位填充
+			if p+24 <= len(frame) {
+				encoder := string(frame[p : p+4])
+				if encoder == "LAME" || encoder == "Lavc" || encoder == "Lavf" {
+					info.encoderDelay = int(frame[p+21])<<4 | int(frame[p+22])>>4
+					info.encoderPadding = int(frame[p+22]&0x0F)<<8 | int(frame[p+23])
+					info.hasLame = true
+				}
+			}
+			return
+		}
+	}
+
+	// VBRI 头固定位于帧头之后 32 字节
+	pos = 4 + 32
+	if pos+26 <= len(frame) && string(frame[pos:pos+4]) == "VBRI" {
+		info.vbriBytes = binary.BigEndian.Uint32(frame[pos+10:])
+		info.vbriFrames = binary.BigEndian.Uint32(frame[pos+14:])
+		entries := int(binary.BigEndian.Uint16(frame[pos+18:]))
+		scale := int64(binary.BigEndian.Uint16(frame[pos+20:]))
+		entrySize := int(binary.BigEndian.Uint16(frame[pos+22:]))
+		info.vbriStep = uint32(binary.BigEndian.Uint16(frame[pos+24:]))
+		p := pos + 26
+		if entrySize < 1 || entrySize > 4 || p+entries*entrySize > len(frame) {
+			return
+		}
+		var offset int64
+		info.vbriToc = make([]int64, 0, entries+1)
+		info.vbriToc = append(info.vbriToc, 0)
+		for i := 0; i < entries; i++ {
+			var v int64
+			for j := 0; j < entrySize; j++ {
+				v = v<<8 | int64(frame[p+j])
+			}
+			p += entrySize
+			offset += v * scale
+			info.vbriToc = append(info.vbriToc, offset)
+		}
+		info.hasVbri = true
+	}
+}
+
+// totalSamples 返回可确定的总采样数（PCM 帧数），未知时返回 0
+func (info *mp3StreamInfo) totalSamples() uint64 {
+	switch {
+	case info.hasXing && info.xingFrames > 0:
+		return uint64(info.xingFrames) * uint64(info.samplesPerFrame)
+	case info.hasVbri && info.vbriFrames > 0:
+		return uint64(info.vbriFrames) * uint64(info.samplesPerFrame)
+	}
+	return 0
+}
+
+// estimatedSamples 估算总采样数：优先使用 Xing/VBRI 头中的帧数，否则按第一帧的码率（CBR）和文件大小计算
+func (info *mp3StreamInfo) estimatedSamples(fileSize int64) uint64 {
+	if total := info.totalSamples(); total > 0 {
+		return total
+	}
+	audioBytes := fileSize - info.audioStart
+	if audioBytes <= 0 || info.bitrate <= 0 || info.sampleRate <= 0 {
+		return 0
+	}
+	seconds := float64(audioBytes) * 8 / (float64(info.bitrate) * 1000)
+	return uint64(seconds*float64(info.sampleRate) + 0.5)
+}
+
+// byteOffsetForFrame 把 PCM 帧位置换算为文件中的字节偏移
+// fileSize 为整个文件的大小，用于 CBR 估算和缺少字节数信息的 Xing 头
+func (info *mp3StreamInfo) byteOffsetForFrame(frame int64, fileSize int64) int64 {
+	if frame <= 0 {
+		return info.audioStart
+	}
+	audioBytes := fileSize - info.audioStart
+	total := int64(info.totalSamples())
+
+	var offset int64
+	switch {
+	case info.hasXing && len(info.xingToc) == 100 && total > 0:
+		// Xing 目录：按时间百分比查表并线性插值
+		if info.xingBytes > 0 {
+			audioBytes = int64(info.xingBytes)
+		}
+		percent := float64(frame) / float64(total) * 100
+		if percent > 99.999 {
+			percent = 99.999
+		}
+		index := int(percent)
+		a := float64(info.xingToc[index])
+		b := 256.0
+		if index < 99 {
+			b = float64(info.xingToc[index+1])
+		}
+		pos := a + (b-a)*(percent-float64(index))
+		offset = int64(pos / 256 * float64(audioBytes))
+	case info.hasVbri && len(info.vbriToc) > 1 && info.vbriStep > 0:
+		// VBRI 目录：每项对应固定的帧数
+		mpegFrame := float64(frame) / float64(info.samplesPerFrame)
+		entry := mpegFrame / float64(info.vbriStep)
+		index := int(entry)
+		if index >= len(info.vbriToc)-1 {
+			offset = info.vbriToc[len(info.vbriToc)-1]
+		} else {
+			a := float64(info.vbriToc[index])
+			b := float64(info.vbriToc[index+1])
+			offset = int64(a + (b-a)*(entry-float64(index)))
+		}
+	case total > 0 && audioBytes > 0:
+		// 有总帧数但没有目录：按比例估算
+		offset = int64(float64(frame) / float64(total) * float64(audioBytes))
+	default:
+		// CBR：按第一帧的码率估算
+		offset = int64(float64(frame) / float64(info.sampleRate) * float64(info.bitrate) * 1000 / 8)
+	}
+
+	// 文件大小未知时 audioBytes 可能为负，结果限制在 [audioStart, fileSize-1]
+	offset += info.audioStart
+	if fileSize > 0 && offset >= fileSize {
+		offset = fileSize - 1
+	}
+	if offset < info.audioStart {
+		offset = info.audioStart
+	}
+	return offset
+}
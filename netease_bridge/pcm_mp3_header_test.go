@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestParseMp3FrameHeader(t *testing.T) {
+	tests := []struct {
+		name   string
+		header []byte
+		ok     bool
+		want   mp3FrameHeader
+	}{
+		{
+			"mpeg1 layer3 128k joint stereo",
+			[]byte{0xFF, 0xFB, 0x90, 0x64}, true,
+			mp3FrameHeader{mpeg1: true, layer: 3, bitrate: 128, sampleRate: 44100, channels: 2, frameSize: 417, samplesPerFrame: 1152},
+		},
+		{
+			"mpeg1 layer3 padded mono",
+			[]byte{0xFF, 0xFB, 0x92, 0xC4}, true,
+			mp3FrameHeader{mpeg1: true, layer: 3, bitrate: 128, sampleRate: 44100, channels: 1, frameSize: 418, samplesPerFrame: 1152},
+		},
+		{
+			"mpeg2 layer3 64k",
+			[]byte{0xFF, 0xF3, 0x80, 0x44}, true,
+			mp3FrameHeader{layer: 3, bitrate: 64, sampleRate: 22050, channels: 2, frameSize: 208, samplesPerFrame: 576},
+		},
+		{"bad sync", []byte{0xFF, 0x1B, 0x90, 0x64}, false, mp3FrameHeader{}},
+		{"reserved version", []byte{0xFF, 0xEB, 0x90, 0x64}, false, mp3FrameHeader{}},
+		{"free bitrate", []byte{0xFF, 0xFB, 0x00, 0x64}, false, mp3FrameHeader{}},
+		{"bad bitrate", []byte{0xFF, 0xFB, 0xF0, 0x64}, false, mp3FrameHeader{}},
+		{"reserved sample rate", []byte{0xFF, 0xFB, 0x9C, 0x64}, false, mp3FrameHeader{}},
+		{"too short", []byte{0xFF, 0xFB, 0x90}, false, mp3FrameHeader{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, ok := parseMp3FrameHeader(tt.header)
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, want %v", ok, tt.ok)
+			}
+			if ok && h != tt.want {
+				t.Fatalf("header = %+v, want %+v", h, tt.want)
+			}
+		})
+	}
+}
+
+func TestId3v2Size(t *testing.T) {
+	tests := []struct {
+		name string
+		tag  []byte
+		want int64
+	}{
+		{"syncsafe size", []byte{'I', 'D', '3', 4, 0, 0x00, 0, 0, 0x02, 0x01}, 267},
+		{"with footer", []byte{'I', 'D', '3', 4, 0, 0x10, 0, 0, 0x02, 0x01}, 277},
+		{"large size", []byte{'I', 'D', '3', 3, 0, 0x00, 0x01, 0x00, 0x00, 0x00}, 1<<21 + 10},
+		{"no tag", []byte{0xFF, 0xFB, 0x90, 0x64, 0, 0, 0, 0, 0, 0}, 0},
+		{"too short", []byte{'I', 'D', '3', 4, 0}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := id3v2Size(tt.tag); got != tt.want {
+				t.Fatalf("id3v2Size() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// linearXingToc 时间和字节位置成正比的 Xing 目录
+func linearXingToc() []byte {
+	toc := make([]byte, 100)
+	for i := range toc {
+		toc[i] = byte(i * 256 / 100)
+	}
+	return toc
+}
+
+func TestByteOffsetForFrame(t *testing.T) {
+	xing := &mp3StreamInfo{
+		audioStart: 100, sampleRate: 44100, bitrate: 128, samplesPerFrame: 1152,
+		hasXing: true, xingFrames: 100, xingBytes: 10000, xingToc: linearXingToc(),
+	}
+	xingNoBytes := &mp3StreamInfo{
+		audioStart: 100, sampleRate: 44100, bitrate: 128, samplesPerFrame: 1152,
+		hasXing: true, xingFrames: 100, xingToc: linearXingToc(),
+	}
+	xingNoToc := &mp3StreamInfo{
+		audioStart: 100, sampleRate: 44100, bitrate: 128, samplesPerFrame: 1152,
+		hasXing: true, xingFrames: 100,
+	}
+	vbri := &mp3StreamInfo{
+		audioStart: 50, sampleRate: 44100, bitrate: 128, samplesPerFrame: 1152,
+		hasVbri: true, vbriFrames: 30, vbriStep: 10, vbriToc: []int64{0, 1000, 3000, 6000},
+	}
+	cbr := &mp3StreamInfo{sampleRate: 44100, bitrate: 128, samplesPerFrame: 1152}
+
+	tests := []struct {
+		name     string
+		info     *mp3StreamInfo
+		frame    int64
+		fileSize int64
+		want     int64
+	}{
+		{"start is audioStart", xing, 0, 10100, 100},
+		{"negative frame", xing, -5, 10100, 100},
+		{"xing halfway", xing, 57600, 10100, 5100},
+		{"xing interpolates between entries", xing, 58176, 10100, 5139},
+		{"xing past the end", xing, 1 << 30, 10100, 10099},
+		{"xing clamped to file size", xing, 57600, 3000, 2999},
+		{"xing without byte count uses file size", xingNoBytes, 57600, 10100, 5100},
+		{"xing without byte count and unknown size", xingNoBytes, 57600, 0, 100},
+		{"frame count without toc", xingNoToc, 28800, 10100, 2600},
+		{"vbri first entry", vbri, 5 * 1152, 10000, 550},
+		{"vbri interpolates", vbri, 15 * 1152, 10000, 2050},
+		{"vbri past the end", vbri, 1000 * 1152, 10000, 6050},
+		{"cbr one second", cbr, 44100, 20000, 16000},
+		{"cbr clamped to file size", cbr, 44100, 10000, 9999},
+		{"cbr unknown size", cbr, 44100, 0, 16000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.info.byteOffsetForFrame(tt.frame, tt.fileSize); got != tt.want {
+				t.Fatalf("byteOffsetForFrame(%d, %d) = %d, want %d", tt.frame, tt.fileSize, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMp3StreamInfoXing(t *testing.T) {
+	const frameSize = 417
+	header := []byte{0xFF, 0xFB, 0x90, 0x64}
+
+	// ID3v2 标签（10 字节头 + 10 字节内容），随后是带 Xing/LAME 头的第一帧和若干普通帧
+	data := []byte{'I', 'D', '3', 4, 0, 0, 0, 0, 0, 10}
+	data = append(data, make([]byte, 10)...)
+	audioStart := int64(len(data))
+	for i := 0; i < 12; i++ {
+		frame := make([]byte, frameSize)
+		copy(frame, header)
+		data = append(data, frame...)
+	}
+
+	frame := data[audioStart : audioStart+frameSize]
+	p := 4 + 32
+	copy(frame[p:], "Xing")
+	binary.BigEndian.PutUint32(frame[p+4:], 0x0F)
+	binary.BigEndian.PutUint32(frame[p+8:], 1000)
+	binary.BigEndian.PutUint32(frame[p+12:], 400000)
+	copy(frame[p+16:], linearXingToc())
+	p += 16 + 100 + 4
+	copy(frame[p:], "LAME")
+	frame[p+21], frame[p+22], frame[p+23] = 576>>4, (576&0x0F)<<4|1000>>8, 1000&0xFF
+
+	readAt := func(b []byte, off int64) bool {
+		if off < 0 || off+int64(len(b)) > int64(len(data)) {
+			return false
+		}
+		copy(b, data[off:])
+		return true
+	}
+	info, err := parseMp3StreamInfo(readAt)
+	if err != nil {
+		t.Fatalf("parseMp3StreamInfo() error: %v", err)
+	}
+
+	if info.audioStart != audioStart || info.sampleRate != 44100 || info.channels != 2 || info.bitrate != 128 {
+		t.Fatalf("stream info = %+v", info)
+	}
+	if !info.hasXing || info.xingFrames != 1000 || info.xingBytes != 400000 || len(info.xingToc) != 100 {
+		t.Fatalf("xing = %v frames=%d bytes=%d toc=%d", info.hasXing, info.xingFrames, info.xingBytes, len(info.xingToc))
+	}
+	if !info.hasLame || info.encoderDelay != 576 || info.encoderPadding != 1000 {
+		t.Fatalf("lame = %v delay=%d padding=%d", info.hasLame, info.encoderDelay, info.encoderPadding)
+	}
+	if got := info.totalSamples(); got != 1000*1152 {
+		t.Fatalf("totalSamples() = %d, want %d", got, 1000*1152)
+	}
+}
@@ -0,0 +1,590 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// mp4 文件中单个 box 的最大读取大小（moov 通常只有几百 KB）
+const mp4MaxBoxSize = 64 * 1024 * 1024
+
+// 音轨最多的样本数（与不超过 mp4MaxBoxSize 的 stsz 能列出的样本数相同）
+const mp4MaxSamples = mp4MaxBoxSize / 4
+
+// mp4AudioTrack 从 moov 中解析出的 AAC 音轨
+type mp4AudioTrack struct {
+	timescale  uint32
+	sampleRate int // mp4a 中的采样率
+	channels   int
+	asc        []byte // AudioSpecificConfig（esds 中的 DecoderSpecificInfo）
+	mediaTime  int64  // 编辑列表中的起始时间（编码器前置的静音，timescale 单位）
+
+	// 每个 AAC 帧（MP4 中称为 sample）的文件偏移、大小和起始时间（timescale 单位）
+	offsets []int64
+	sizes   []uint32
+	times   []uint64
+	endTime uint64
+}
+
+// parseMp4AudioTrack 解析 MP4 文件，返回第一个音轨
+// moov 可能在文件末尾（mdat 之后），此时会跳过 mdat 读取末尾的数据
+func parseMp4AudioTrack(r io.ReadSeeker) (*mp4AudioTrack, error) {
+	pos := int64(0)
+	for {
+		if _, err := r.Seek(pos, io.SeekStart); err != nil {
+			return nil, err
+		}
+		boxType, size, headerSize, err := readMp4BoxHeader(r)
+		if err != nil {
+			if err == io.EOF {
+				return nil, errors.New("moov box not found")
+			}
+			return nil, err
+		}
+		if pos == 0 && boxType != "ftyp" {
+			return nil, errors.New("not an MP4 file")
+		}
+
+		if boxType == "moov" {
+			if size == 0 || size-headerSize > mp4MaxBoxSize {
+				return nil, errors.New("invalid moov box size")
+			}
+			moov := make([]byte, size-headerSize)
+			if _, err := io.ReadFull(r, moov); err != nil {
+				return nil, err
+			}
+			return parseMp4Moov(moov)
+		}
+
+		if size == 0 {
+			// 一直延伸到文件末尾
+			return nil, errors.New("moov box not found")
+		}
+		pos += size
+	}
+}
+
+// readMp4BoxHeader 读取 box 头，返回类型、总大小（0 表示到文件末尾）和头部大小
+func readMp4BoxHeader(r io.Reader) (string, int64, int64, error) {
+	var header [8]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+		return "", 0, 0, err
+	}
+	size := int64(binary.BigEndian.Uint32(header[0:4]))
+	boxType := string(header[4:8])
+	headerSize := int64(8)
+	if size == 1 {
+		var large [8]byte
+		if _, err := io.ReadFull(r, large[:]); err != nil {
+			return "", 0, 0, err
+		}
+		size = int64(binary.BigEndian.Uint64(large[:]))
+		headerSize = 16
+	}
+	if size != 0 && size < headerSize {
+		return "", 0, 0, fmt.Errorf("invalid %s box size", boxType)
+	}
+	return boxType, size, headerSize, nil
+}
+
+// mp4Boxes 遍历内存中的子 box，回调返回 false 时停止
+func mp4Boxes(data []byte, fn func(boxType string, body []byte) bool) {
+	for len(data) >= 8 {
+		size := int(binary.BigEndian.Uint32(data[0:4]))
+		boxType := string(data[4:8])
+		headerSize := 8
+		switch {
+		case size == 1 && len(data) >= 16:
+			size = int(binary.BigEndian.Uint64(data[8:16]))
+			headerSize = 16
+		case size == 0:
+			size = len(data)
+		}
+		if size < headerSize || size > len(data) {
+			return
+		}
+		if !fn(boxType, data[headerSize:size]) {
+			return
+		}
+		data = data[size:]
+	}
+}
+
+// mp4Child 查找第一个指定类型的子 box
+func mp4Child(data []byte, path ...string) []byte {
+	for _, name := range path {
+		var found []byte
+		mp4Boxes(data, func(boxType string, body []byte) bool {
+			if boxType == name {
+				found = body
+				return false
+			}
+			return true
+		})
+		if found == nil {
+			return nil
+		}
+		data = found
+	}
+	return data
+}
+
+func parseMp4Moov(moov []byte) (*mp4AudioTrack, error) {
+	var track *mp4AudioTrack
+	var parseErr error
+	mp4Boxes(moov, func(boxType string, trak []byte) bool {
+		if boxType != "trak" {
+			return true
+		}
+		hdlr := mp4Child(trak, "mdia", "hdlr")
+		if len(hdlr) < 12 || string(hdlr[8:12]) != "soun" {
+			return true
+		}
+		track, parseErr = parseMp4Trak(trak)
+		return false
+	})
+	if parseErr != nil {
+		return nil, parseErr
+	}
+	if track == nil {
+		return nil, errors.New("no audio track in MP4 file")
+	}
+	return track, nil
+}
+
+func parseMp4Trak(trak []byte) (*mp4AudioTrack, error) {
+	t := &mp4AudioTrack{}
+
+	// mdhd: 时间单位
+	mdhd := mp4Child(trak, "mdia", "mdhd")
+	switch {
+	case len(mdhd) >= 24 && mdhd[0] == 0:
+		t.timescale = binary.BigEndian.Uint32(mdhd[12:16])
+	case len(mdhd) >= 32 && mdhd[0] == 1:
+		t.timescale = binary.BigEndian.Uint32(mdhd[20:24])
+	}
+	if t.timescale == 0 {
+		return nil, errors.New("invalid mdhd box")
+	}
+
+	// elst: 跳过编码器前置的静音（只处理第一个非空的编辑）
+	if elst := mp4Child(trak, "edts", "elst"); len(elst) >= 8 {
+		count := int(binary.BigEndian.Uint32(elst[4:8]))
+		entry := elst[8:]
+		entrySize := 12
+		if elst[0] == 1 {
+			entrySize = 20
+		}
+		for i := 0; i < count && len(entry) >= entrySize; i++ {
+			var mediaTime int64
+			if elst[0] == 1 {
+				mediaTime = int64(binary.BigEndian.Uint64(entry[8:16]))
+			} else {
+				mediaTime = int64(int32(binary.BigEndian.Uint32(entry[4:8])))
+			}
+			entry = entry[entrySize:]
+			if mediaTime >= 0 {
+				t.mediaTime = mediaTime
+				break
+			}
+		}
+	}
+
+	stbl := mp4Child(trak, "mdia", "minf", "stbl")
+	if stbl == nil {
+		return nil, errors.New("missing stbl box")
+	}
+	if err := t.parseStsd(mp4Child(stbl, "stsd")); err != nil {
+		return nil, err
+	}
+	if err := t.parseSampleTable(stbl); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// parseStsd 解析 mp4a 样本描述和 esds 中的 AudioSpecificConfig
+func (t *mp4AudioTrack) parseStsd(stsd []byte) error {
+	if len(stsd) < 8 {
+		return errors.New("missing stsd box")
+	}
+	var entry []byte
+	var entryType string
+	mp4Boxes(stsd[8:], func(boxType string, body []byte) bool {
+		entryType, entry = boxType, body
+		return false
+	})
+	if entryType != "mp4a" {
+		return fmt.Errorf("unsupported MP4 audio codec: %s", entryType)
+	}
+	if len(entry) < 28 {
+		return errors.New("invalid mp4a box")
+	}
+
+	t.channels = int(binary.BigEndian.Uint16(entry[16:18]))
+	t.sampleRate = int(binary.BigEndian.Uint32(entry[24:28]) >> 16)
+
+	// QuickTime 声音描述的版本 1/2 有额外字段
+	children := entry[28:]
+	switch binary.BigEndian.Uint16(entry[8:10]) {
+	case 1:
+		if len(children) >= 16 {
+			children = children[16:]
+		}
+	case 2:
+		if len(children) >= 36 {
+			children = children[36:]
+		}
+	}
+
+	esds := mp4Child(children, "esds")
+	if len(esds) < 4 {
+		return errors.New("missing esds box")
+	}
+	asc := findMp4DecoderSpecificInfo(esds[4:])
+	if len(asc) < 2 {
+		return errors.New("missing AAC decoder config")
+	}
+	t.asc = asc
+
+	// 以 AudioSpecificConfig 为准（mp4a 中的采样率对 HE-AAC 是核心采样率）
+	if sampleRate, channels := parseAacAudioConfig(asc); sampleRate > 0 {
+		t.sampleRate = sampleRate
+		if channels > 0 {
+			t.channels = channels
+		}
+	}
+	return nil
+}
+
+// AAC 采样率索引表
+var aacSampleRates = []int{96000, 88200, 64000, 48000, 44100, 32000, 24000, 22050, 16000, 12000, 11025, 8000, 7350}
+
+// parseAacAudioConfig 解析 AudioSpecificConfig，返回输出采样率和声道数
+// 显式标记 SBR（HE-AAC）时返回扩展采样率
+func parseAacAudioConfig(asc []byte) (sampleRate, channels int) {
+	var bitPos uint
+	read := func(n uint) int {
+		v := 0
+		for i := uint(0); i < n; i++ {
+			byteIndex := int(bitPos / 8)
+			if byteIndex >= len(asc) {
+				return -1
+			}
+			v = v<<1 | int(asc[byteIndex]>>(7-bitPos%8))&1
+			bitPos++
+		}
+		return v
+	}
+	readObjectType := func() int {
+		objectType := read(5)
+		if objectType == 31 {
+			objectType = 32 + read(6)
+		}
+		return objectType
+	}
+	readSampleRate := func() int {
+		index := read(4)
+		if index == 15 {
+			return read(24)
+		}
+		if index < 0 || index >= len(aacSampleRates) {
+			return 0
+		}
+		return aacSampleRates[index]
+	}
+
+	objectType := readObjectType()
+	sampleRate = readSampleRate()
+	channels = read(4)
+	if objectType == 5 || objectType == 29 {
+		// SBR/PS：后面是扩展采样率
+		if rate := readSampleRate(); rate > 0 {
+			sampleRate = rate
+		}
+		if objectType == 29 && channels == 1 {
+			channels = 2 // PS 输出立体声
+		}
+	}
+	if channels == 7 {
+		channels = 8 // 7.1
+	}
+	if sampleRate < 0 || channels < 0 {
+		return 0, 0
+	}
+	return sampleRate, channels
+}
+
+// readMp4DescriptorLength 读取 MPEG-4 描述符的长度（每字节 7 位）
+func readMp4DescriptorLength(data []byte) (length int, n int) {
+	for n < 4 && n < len(data) {
+		b := data[n]
+		n++
+		length = length<<7 | int(b&0x7F)
+		if b&0x80 == 0 {
+			break
+		}
+	}
+	return length, n
+}
+
+// findMp4DecoderSpecificInfo 在 ES_Descriptor 中查找 DecoderSpecificInfo（tag 0x05）
+func findMp4DecoderSpecificInfo(data []byte) []byte {
+	for len(data) >= 2 {
+		tag := data[0]
+		length, n := readMp4DescriptorLength(data[1:])
+		body := data[1+n:]
+		if length > len(body) {
+			length = len(body)
+		}
+		switch tag {
+		case 0x03: // ES_Descriptor
+			if len(body) < 3 {
+				return nil
+			}
+			flags := body[2]
+			skip := 3
+			if flags&0x80 != 0 { // streamDependenceFlag
+				skip += 2
+			}
+			if flags&0x40 != 0 && len(body) > skip { // URL_Flag
+				skip += 1 + int(body[skip])
+			}
+			if flags&0x20 != 0 { // OCRstreamFlag
+				skip += 2
+			}
+			if skip > length {
+				return nil
+			}
+			data = body[skip:length]
+		case 0x04: // DecoderConfigDescriptor
+			if length < 13 {
+				return nil
+			}
+			data = body[13:length]
+		case 0x05: // DecoderSpecificInfo
+			return body[:length]
+		default:
+			data = body[length:]
+		}
+	}
+	return nil
+}
+
+// parseSampleTable 根据 stts/stsc/stsz/stco 计算每个样本的位置和时间
+func (t *mp4AudioTrack) parseSampleTable(stbl []byte) error {
+	// stsz: 样本大小
+	stsz := mp4Child(stbl, "stsz")
+	if len(stsz) < 12 {
+		return errors.New("missing stsz box")
+	}
+	fixedSize := binary.BigEndian.Uint32(stsz[4:8])
+	count := int(binary.BigEndian.Uint32(stsz[8:12]))
+	if count == 0 {
+		return errors.New("MP4 audio track has no samples")
+	}
+	if fixedSize == 0 && len(stsz) < 12+count*4 {
+		return errors.New("invalid stsz box")
+	}
+
+	// stts: 样本时长（样本数不能超过 stts 中的样本总数，避免按文件中的数值分配过大的内存）
+	stts := mp4Child(stbl, "stts")
+	if len(stts) < 8 {
+		return errors.New("missing stts box")
+	}
+	entries := int(binary.BigEndian.Uint32(stts[4:8]))
+	var sttsSamples uint64
+	for i := 0; i < entries && 8+i*8+8 <= len(stts); i++ {
+		sttsSamples += uint64(binary.BigEndian.Uint32(stts[8+i*8:]))
+	}
+	if uint64(count) > sttsSamples {
+		return errors.New("invalid stts box")
+	}
+	if count > mp4MaxSamples {
+		return errors.New("too many samples in MP4 audio track")
+	}
+
+	t.sizes = make([]uint32, count)
+	for i := range t.sizes {
+		if fixedSize != 0 {
+			t.sizes[i] = fixedSize
+		} else {
+			t.sizes[i] = binary.BigEndian.Uint32(stsz[12+i*4:])
+		}
+	}
+
+	t.times = make([]uint64, count)
+	sample := 0
+	var time uint64
+	for i := 0; i < entries && 8+i*8+8 <= len(stts); i++ {
+		n := int(binary.BigEndian.Uint32(stts[8+i*8:]))
+		delta := uint64(binary.BigEndian.Uint32(stts[12+i*8:]))
+		for j := 0; j < n && sample < count; j++ {
+			t.times[sample] = time
+			time += delta
+			sample++
+		}
+	}
+	if sample < count {
+		return errors.New("invalid stts box")
+	}
+	t.endTime = time
+
+	// stco/co64: 块偏移
+	var chunkOffsets []int64
+	if stco := mp4Child(stbl, "stco"); len(stco) >= 8 {
+		n := int(binary.BigEndian.Uint32(stco[4:8]))
+		for i := 0; i < n && 8+i*4+4 <= len(stco); i++ {
+			chunkOffsets = append(chunkOffsets, int64(binary.BigEndian.Uint32(stco[8+i*4:])))
+		}
+	} else if co64 := mp4Child(stbl, "co64"); len(co64) >= 8 {
+		n := int(binary.BigEndian.Uint32(co64[4:8]))
+		for i := 0; i < n && 8+i*8+8 <= len(co64); i++ {
+			chunkOffsets = append(chunkOffsets, int64(binary.BigEndian.Uint64(co64[8+i*8:])))
+		}
+	}
+	if len(chunkOffsets) == 0 {
+		return errors.New("missing stco box")
+	}
+
+	// stsc: 每个块包含的样本数
+	stsc := mp4Child(stbl, "stsc")
+	if len(stsc) < 8 {
+		return errors.New("missing stsc box")
+	}
+	stscEntries := int(binary.BigEndian.Uint32(stsc[4:8]))
+	if len(stsc) < 8+stscEntries*12 || stscEntries == 0 {
+		return errors.New("invalid stsc box")
+	}
+
+	t.offsets = make([]int64, count)
+	sample = 0
+	for i := 0; i < stscEntries && sample < count; i++ {
+		firstChunk := int(binary.BigEndian.Uint32(stsc[8+i*12:])) - 1
+		perChunk := int(binary.BigEndian.Uint32(stsc[12+i*12:]))
+		lastChunk := len(chunkOffsets)
+		if i+1 < stscEntries {
+			lastChunk = int(binary.BigEndian.Uint32(stsc[8+(i+1)*12:])) - 1
+		}
+		for chunk := firstChunk; chunk < lastChunk && chunk < len(chunkOffsets) && sample < count; chunk++ {
+			offset := chunkOffsets[chunk]
+			for j := 0; j < perChunk && sample < count; j++ {
+				t.offsets[sample] = offset
+				offset += int64(t.sizes[sample])
+				sample++
+			}
+		}
+	}
+	if sample < count {
+		return errors.New("invalid sample table")
+	}
+	return nil
+}
+
+// sampleAt 返回包含时间 time（timescale 单位）的样本序号
+func (t *mp4AudioTrack) sampleAt(time uint64) int {
+	i := sort.Search(len(t.times), func(i int) bool { return t.times[i] > time })
+	if i > 0 {
+		i--
+	}
+	return i
+}
+
+// mp4AacSource MP4 容器中的 AAC 音轨
+type mp4AacSource struct {
+	reader  io.ReadSeeker
+	track   *mp4AudioTrack
+	decoder aacFrameDecoder
+	next    int // 下一个要解码的样本
+	frame   []byte
+}
+
+func openMp4AacSource(reader io.ReadSeeker) (packetSource, error) {
+	track, err := parseMp4AudioTrack(reader)
+	if err != nil {
+		return nil, err
+	}
+	decoder, err := newAacFrameDecoder(track.asc)
+	if err != nil {
+		return nil, err
+	}
+	return &mp4AacSource{reader: reader, track: track, decoder: decoder}, nil
+}
+
+// outputRate 解码器输出的采样率（HE-AAC 的输出采样率是 mp4a 中的两倍）
+func (s *mp4AacSource) outputRate() int {
+	if rate, _ := s.decoder.format(); rate > 0 {
+		return rate
+	}
+	return s.track.sampleRate
+}
+
+// toFrames 把 timescale 单位的时间换算为输出帧
+func (s *mp4AacSource) toFrames(time int64) int64 {
+	return time * int64(s.outputRate()) / int64(s.track.timescale)
+}
+
+func (s *mp4AacSource) info() (sampleRate, channels int, totalFrames uint64) {
+	sampleRate, channels = s.decoder.format()
+	if sampleRate == 0 {
+		sampleRate, channels = s.track.sampleRate, s.track.channels
+	}
+	if total := s.toFrames(int64(s.track.endTime) - s.track.mediaTime); total > 0 {
+		totalFrames = uint64(total)
+	}
+	return
+}
+
+// seek 返回的位置扣除了编辑列表中的前置静音，从头播放时返回负数
+func (s *mp4AacSource) seek(frame uint64) (int64, error) {
+	time := uint64(s.track.mediaTime) + frame*uint64(s.track.timescale)/uint64(s.outputRate())
+	// 多解码一帧，让 MDCT 的重叠部分正确
+	index := s.track.sampleAt(time)
+	if index > 0 {
+		index--
+	}
+	s.next = index
+	s.decoder.reset()
+	return s.toFrames(int64(s.track.times[index]) - s.track.mediaTime), nil
+}
+
+func (s *mp4AacSource) decode() ([]float32, error) {
+	for {
+		if s.next >= len(s.track.sizes) {
+			return nil, io.EOF
+		}
+		index := s.next
+		s.next++
+
+		size := int(s.track.sizes[index])
+		if cap(s.frame) < size {
+			s.frame = make([]byte, size)
+		}
+		frame := s.frame[:size]
+		if _, err := s.reader.Seek(s.track.offsets[index], io.SeekStart); err != nil {
+			return nil, err
+		}
+		if _, err := io.ReadFull(s.reader, frame); err != nil {
+			return nil, err
+		}
+
+		samples, err := s.decoder.decode(frame)
+		if err != nil {
+			return nil, err
+		}
+		if len(samples) == 0 {
+			continue // 解码器延迟，没有输出
+		}
+		return samples, nil
+	}
+}
+
+func (s *mp4AacSource) close() {
+	s.decoder.close()
+}
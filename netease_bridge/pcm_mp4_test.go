@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func mp4Box(boxType string, body ...[]byte) []byte {
+	data := bytes.Join(body, nil)
+	out := make([]byte, 8, 8+len(data))
+	binary.BigEndian.PutUint32(out, uint32(8+len(data)))
+	copy(out[4:], boxType)
+	return append(out, data...)
+}
+
+func mp4U16(v uint16) []byte { return binary.BigEndian.AppendUint16(nil, v) }
+
+func mp4U32(values ...uint32) []byte {
+	var out []byte
+	for _, v := range values {
+		out = binary.BigEndian.AppendUint32(out, v)
+	}
+	return out
+}
+
+func mp4Hdlr(handler string) []byte {
+	return mp4Box("hdlr", mp4U32(0, 0), []byte(handler), make([]byte, 13))
+}
+
+// mp4Esds 带 DecoderSpecificInfo 的 ES_Descriptor
+func mp4Esds(asc []byte) []byte {
+	decoderConfig := append([]byte{0x40, 0x15}, make([]byte, 11)...)
+	decoderConfig = append(decoderConfig, 0x05, byte(len(asc)))
+	decoderConfig = append(decoderConfig, asc...)
+	es := []byte{0x00, 0x01, 0x00, 0x04, byte(len(decoderConfig))}
+	es = append(es, decoderConfig...)
+	es = append(es, 0x06, 0x01, 0x02)
+	return mp4Box("esds", mp4U32(0), []byte{0x03, byte(len(es))}, es)
+}
+
+func mp4SampleEntry(codec string, channels, sampleRate int, children ...[]byte) []byte {
+	body := [][]byte{
+		make([]byte, 6), mp4U16(1), // reserved, data_reference_index
+		mp4U16(0), mp4U16(0), mp4U32(0), // version, revision, vendor
+		mp4U16(uint16(channels)), mp4U16(16), mp4U16(0), mp4U16(0),
+		mp4U32(uint32(sampleRate) << 16),
+	}
+	return mp4Box(codec, append(body, children...)...)
+}
+
+// mp4AudioTrak 5 个样本分布在 3 个块中（2+2+1），带一个前置静音的编辑列表
+func mp4AudioTrak(sampleEntry []byte) []byte {
+	return mp4AudioTrakTables(sampleEntry, mp4U32(0, 1, 5, 1024), mp4U32(0, 0, 5, 100, 110, 120, 130, 140))
+}
+
+// mp4AudioTrakTables 使用指定 stts 和 stsz 内容的音轨
+func mp4AudioTrakTables(sampleEntry, stts, stsz []byte) []byte {
+	return mp4Box("trak",
+		mp4Box("edts", mp4Box("elst", mp4U32(0, 2), mp4U32(100), mp4U32(0xFFFFFFFF), mp4U32(0x10000), mp4U32(5000, 2112, 0x10000))),
+		mp4Box("mdia",
+			mp4Box("mdhd", mp4U32(0, 0, 0, 44100, 5120, 0)),
+			mp4Hdlr("soun"),
+			mp4Box("minf", mp4Box("stbl",
+				mp4Box("stsd", mp4U32(0, 1), sampleEntry),
+				mp4Box("stts", stts),
+				mp4Box("stsc", mp4U32(0, 2, 1, 2, 1, 3, 1, 1)),
+				mp4Box("stsz", stsz),
+				mp4Box("stco", mp4U32(0, 3, 1000, 2000, 3000)),
+			)),
+		),
+	)
+}
+
+func mp4VideoTrak() []byte {
+	return mp4Box("trak", mp4Box("mdia", mp4Box("mdhd", mp4U32(0, 0, 0, 90000, 0, 0)), mp4Hdlr("vide")))
+}
+
+var (
+	mp4Ftyp     = mp4Box("ftyp", []byte("M4A "), mp4U32(0), []byte("M4A isom"))
+	aacLcStereo = []byte{0x12, 0x10} // AAC-LC, 44100Hz, 2 声道
+	mp4aEntry   = mp4SampleEntry("mp4a", 2, 44100, mp4Esds(aacLcStereo))
+)
+
+func mp4LargeMdat(payload int) []byte {
+	out := make([]byte, 16, 16+payload)
+	binary.BigEndian.PutUint32(out, 1)
+	copy(out[4:], "mdat")
+	binary.BigEndian.PutUint64(out[8:], uint64(16+payload))
+	return append(out, make([]byte, payload)...)
+}
+
+func TestParseMp4AudioTrack(t *testing.T) {
+	moov := mp4Box("moov", mp4VideoTrak(), mp4AudioTrak(mp4aEntry))
+	tests := []struct {
+		name string
+		file [][]byte
+	}{
+		{"moov before mdat", [][]byte{mp4Ftyp, moov, mp4Box("mdat", make([]byte, 64))}},
+		{"moov after mdat", [][]byte{mp4Ftyp, mp4Box("free"), mp4Box("mdat", make([]byte, 64)), moov}},
+		{"moov after 64-bit mdat", [][]byte{mp4Ftyp, mp4LargeMdat(32), moov}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			track, err := parseMp4AudioTrack(bytes.NewReader(bytes.Join(tt.file, nil)))
+			if err != nil {
+				t.Fatalf("parseMp4AudioTrack() error: %v", err)
+			}
+			if track.timescale != 44100 || track.sampleRate != 44100 || track.channels != 2 {
+				t.Fatalf("timescale=%d sampleRate=%d channels=%d", track.timescale, track.sampleRate, track.channels)
+			}
+			if !bytes.Equal(track.asc, aacLcStereo) {
+				t.Fatalf("asc = %x, want %x", track.asc, aacLcStereo)
+			}
+			if track.mediaTime != 2112 {
+				t.Fatalf("mediaTime = %d, want 2112", track.mediaTime)
+			}
+			if want := []int64{1000, 1100, 2000, 2120, 3000}; !reflect.DeepEqual(track.offsets, want) {
+				t.Fatalf("offsets = %v, want %v", track.offsets, want)
+			}
+			if want := []uint32{100, 110, 120, 130, 140}; !reflect.DeepEqual(track.sizes, want) {
+				t.Fatalf("sizes = %v, want %v", track.sizes, want)
+			}
+			if want := []uint64{0, 1024, 2048, 3072, 4096}; !reflect.DeepEqual(track.times, want) {
+				t.Fatalf("times = %v, want %v", track.times, want)
+			}
+			if track.endTime != 5120 {
+				t.Fatalf("endTime = %d, want 5120", track.endTime)
+			}
+		})
+	}
+}
+
+func TestParseMp4AudioTrackErrors(t *testing.T) {
+	noEsds := mp4SampleEntry("mp4a", 2, 44100)
+	alac := mp4SampleEntry("alac", 2, 44100)
+	withTables := func(stts, stsz []byte) []byte {
+		return bytes.Join([][]byte{mp4Ftyp, mp4Box("moov", mp4AudioTrakTables(mp4aEntry, stts, stsz))}, nil)
+	}
+	tests := []struct {
+		name string
+		file []byte
+		want string
+	}{
+		{"not mp4", mp4Box("RIFF", make([]byte, 8)), "not an MP4 file"},
+		{"no moov", bytes.Join([][]byte{mp4Ftyp, mp4Box("mdat", make([]byte, 8))}, nil), "moov box not found"},
+		{"no audio track", bytes.Join([][]byte{mp4Ftyp, mp4Box("moov", mp4VideoTrak())}, nil), "no audio track"},
+		{"unsupported codec", bytes.Join([][]byte{mp4Ftyp, mp4Box("moov", mp4AudioTrak(alac))}, nil), "unsupported MP4 audio codec: alac"},
+		{"missing esds", bytes.Join([][]byte{mp4Ftyp, mp4Box("moov", mp4AudioTrak(noEsds))}, nil), "missing esds box"},
+		{"no samples", withTables(mp4U32(0, 0), mp4U32(0, 0, 0)), "no samples"},
+		{"no samples with fixed size", withTables(mp4U32(0, 1, 5, 1024), mp4U32(0, 400, 0)), "no samples"},
+		{"fixed size count beyond stts", withTables(mp4U32(0, 1, 5, 1024), mp4U32(0, 400, 0xFFFFFFFF)), "invalid stts box"},
+		{"fixed size count too large", withTables(mp4U32(0, 2, 0xFFFFFFFF, 1024, 0xFFFFFFFF, 1024), mp4U32(0, 400, 0xFFFFFFFF)), "too many samples"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseMp4AudioTrack(bytes.NewReader(tt.file))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseAacAudioConfig(t *testing.T) {
+	tests := []struct {
+		name       string
+		asc        []byte
+		sampleRate int
+		channels   int
+	}{
+		{"aac-lc 44.1k stereo", []byte{0x12, 0x10}, 44100, 2},
+		{"aac-lc 48k mono", []byte{0x11, 0x88}, 48000, 1},
+		{"he-aac explicit sbr", []byte{0x2B, 0x11, 0x80}, 48000, 2},
+		{"7.1 channel config", []byte{0x12, 0x38}, 44100, 8},
+		{"truncated", []byte{0x12}, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sampleRate, channels := parseAacAudioConfig(tt.asc)
+			if sampleRate != tt.sampleRate || channels != tt.channels {
+				t.Fatalf("parseAacAudioConfig() = %d, %d, want %d, %d", sampleRate, channels, tt.sampleRate, tt.channels)
+			}
+		})
+	}
+}
+
+func TestMp4SampleAt(t *testing.T) {
+	track := &mp4AudioTrack{times: []uint64{0, 1024, 2048, 3072, 4096}}
+	tests := []struct {
+		time uint64
+		want int
+	}{
+		{0, 0},
+		{1023, 0},
+		{1024, 1},
+		{3500, 3},
+		{1 << 40, 4},
+	}
+	for _, tt := range tests {
+		if got := track.sampleAt(tt.time); got != tt.want {
+			t.Errorf("sampleAt(%d) = %d, want %d", tt.time, got, tt.want)
+		}
+	}
+}
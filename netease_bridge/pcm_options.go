@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// PcmStreamOptions 创建 PCM 流时的可选参数（NeteaseCreatePcmStreamEx 传入的 JSON）
+// 未设置的字段保持默认行为
+type PcmStreamOptions struct {
+	// 输出采样率（Hz），0 表示使用音源的采样率
+	OutputSampleRate int `json:"outputSampleRate"`
+
+	// 输出声道数（1~8），0 表示立体声；单声道音源上混，多声道音源按标准系数下混
+	OutputChannels int `json:"outputChannels"`
+
+	// 响度标准化：""/"off" 关闭，"track" 按单曲，"album" 按专辑
+	Loudness string `json:"loudness"`
+
+	// 目标响度 (LUFS)，0 表示默认的 -18 LUFS
+	TargetLufs float64 `json:"targetLufs"`
+
+	// 歌曲所属专辑 ID，专辑模式使用
+	AlbumId int64 `json:"albumId"`
+
+	// 解码缓冲区时长（秒），0 表示默认的 4 秒；缓冲区满时解码暂停，内存占用固定
+	DecodeBufferSeconds float64 `json:"decodeBufferSeconds"`
+
+	// 欠载后重新缓冲的时长（秒）：缓冲到该时长（或缓冲区将满）后再继续输出，避免断断续续地播放
+	// 0 表示有数据就立即输出
+	RebufferSeconds float64 `json:"rebufferSeconds"`
+
+	// 开始输出前预缓冲的时长（毫秒），0 表示默认的 500 毫秒；超过解码缓冲区时为缓冲区满
+	PrebufferMs int `json:"prebufferMs"`
+
+	// 边下边播时等待文件头（FLAC 元数据块、MP3 第一帧）下载的最长时间（毫秒），0 表示默认的 20 秒
+	FlacOpenTimeoutMs int `json:"flacOpenTimeoutMs"`
+
+	// 下载超时（毫秒），0 表示默认值；只对本次创建的下载生效（已在下载中的歌曲沿用原来的设置）
+	ConnectTimeoutMs  int `json:"connectTimeoutMs"`  // 建立连接，默认 15 秒
+	ResponseTimeoutMs int `json:"responseTimeoutMs"` // 等待响应头，默认 30 秒
+	ReadTimeoutMs     int `json:"readTimeoutMs"`     // 下载中没有收到数据，默认 30 秒
+
+	// FLAC 下载完成后解码整个文件校验 STREAMINFO 中的音频 MD5（文件 MD5 总是会校验）
+	VerifyFlacAudio bool `json:"verifyFlacAudio"`
+}
+
+// 边下边播时默认等待文件头的时间
+const defaultHeaderOpenTimeout = 20 * time.Second
+
+// 超时和预缓冲的上限（毫秒）
+const (
+	maxPrebufferMs = 30000
+	maxTimeoutMs   = 600000
+)
+
+// parsePcmStreamOptions 解析并校验流参数，空字符串返回默认参数
+func parsePcmStreamOptions(optionsJson string) (PcmStreamOptions, error) {
+	var options PcmStreamOptions
+	if optionsJson == "" {
+		return options, nil
+	}
+
+	if err := json.Unmarshal([]byte(optionsJson), &options); err != nil {
+		return options, fmt.Errorf("Invalid stream options: %w", err)
+	}
+
+	if options.OutputSampleRate != 0 && (options.OutputSampleRate < 8000 || options.OutputSampleRate > 384000) {
+		return options, errors.New("Invalid stream options: outputSampleRate must be between 8000 and 384000")
+	}
+
+	if options.OutputChannels < 0 || options.OutputChannels > maxSourceChannels {
+		return options, errors.New("Invalid stream options: outputChannels must be between 1 and 8")
+	}
+
+	switch options.Loudness {
+	case "", LoudnessOff, LoudnessTrack, LoudnessAlbum:
+	default:
+		return options, fmt.Errorf("Invalid stream options: unknown loudness mode %q", options.Loudness)
+	}
+
+	if options.TargetLufs < -70 || options.TargetLufs > 0 {
+		return options, errors.New("Invalid stream options: targetLufs must be between -70 and 0")
+	}
+
+	if options.DecodeBufferSeconds != 0 && (options.DecodeBufferSeconds < minDecodeBufferSeconds || options.DecodeBufferSeconds > maxDecodeBufferSeconds) {
+		return options, errors.New("Invalid stream options: decodeBufferSeconds must be between 0.5 and 30")
+	}
+
+	if options.RebufferSeconds < 0 || options.RebufferSeconds > maxDecodeBufferSeconds {
+		return options, errors.New("Invalid stream options: rebufferSeconds must be between 0 and 30")
+	}
+
+	if options.PrebufferMs < 0 || options.PrebufferMs > maxPrebufferMs {
+		return options, errors.New("Invalid stream options: prebufferMs must be between 0 and 30000")
+	}
+
+	timeouts := []struct {
+		name  string
+		value int
+	}{
+		{"flacOpenTimeoutMs", options.FlacOpenTimeoutMs},
+		{"connectTimeoutMs", options.ConnectTimeoutMs},
+		{"responseTimeoutMs", options.ResponseTimeoutMs},
+		{"readTimeoutMs", options.ReadTimeoutMs},
+	}
+	for _, t := range timeouts {
+		if t.value < 0 || t.value > maxTimeoutMs {
+			return options, fmt.Errorf("Invalid stream options: %s must be between 0 and 600000", t.name)
+		}
+	}
+
+	return options, nil
+}
+
+// loudnessEnabled 是否启用响度标准化
+func (o PcmStreamOptions) loudnessEnabled() bool {
+	return o.Loudness == LoudnessTrack || o.Loudness == LoudnessAlbum
+}
+
+// decodeBuffer 解码缓冲区的容量和预缓冲时长，未设置时使用默认值
+func (o PcmStreamOptions) decodeBuffer() decodeBufferConfig {
+	cfg := decodeBufferConfig{
+		seconds:          o.DecodeBufferSeconds,
+		prebufferSeconds: float64(o.PrebufferMs) / 1000,
+	}
+	if cfg.seconds == 0 {
+		cfg.seconds = defaultDecodeBufferSeconds
+	}
+	if cfg.prebufferSeconds == 0 {
+		cfg.prebufferSeconds = defaultPrebufferSeconds
+	}
+	return cfg
+}
+
+// headerOpenTimeout 等待文件头的时间，未设置时使用默认值
+func (o PcmStreamOptions) headerOpenTimeout() time.Duration {
+	return msOrDefault(o.FlacOpenTimeoutMs, defaultHeaderOpenTimeout)
+}
+
+// downloadOptions 下载参数，未设置的超时使用默认值
+func (o PcmStreamOptions) downloadOptions() downloadOptions {
+	return downloadOptions{
+		timeouts: downloadTimeouts{
+			connect:        msOrDefault(o.ConnectTimeoutMs, defaultDownloadTimeouts.connect),
+			responseHeader: msOrDefault(o.ResponseTimeoutMs, defaultDownloadTimeouts.responseHeader),
+			read:           msOrDefault(o.ReadTimeoutMs, defaultDownloadTimeouts.read),
+		},
+		verifyFlacAudio: o.VerifyFlacAudio,
+	}
+}
+
+// msOrDefault 毫秒数转换为时长，0 返回默认值
+func msOrDefault(ms int, def time.Duration) time.Duration {
+	if ms == 0 {
+		return def
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+// targetLufs 目标响度，未设置时使用默认值
+func (o PcmStreamOptions) targetLufs() float64 {
+	if o.TargetLufs == 0 {
+		return defaultTargetLufs
+	}
+	return o.TargetLufs
+}
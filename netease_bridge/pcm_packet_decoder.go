@@ -0,0 +1,339 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// packetSource 按包解码的音源（AAC、Vorbis 等），由 PacketDecoder 在后台驱动
+type packetSource interface {
+	// info 返回采样率、声道数和总帧数（未知时为 0），第一次 decode 之后一定有效
+	info() (sampleRate, channels int, totalFrames uint64)
+	// seek 定位到不晚于 frame 的位置，返回下一次 decode 输出的第一帧的位置
+	// 返回值可能为负数（例如编码器的前置静音），PacketDecoder 会丢弃目标之前的帧
+	seek(frame uint64) (int64, error)
+	// decode 解码下一段 PCM（交错存放），结束时返回 io.EOF
+	decode() ([]float32, error)
+	close()
+}
+
+// openPacketSource 根据格式创建音源
+func openPacketSource(format AudioFormat, reader io.ReadSeeker) (packetSource, error) {
+	switch format {
+	case FormatAAC:
+		return openMp4AacSource(reader)
+	case FormatVorbis:
+		return openVorbisSource(reader)
+	}
+	return nil, fmt.Errorf("Unsupported packet format: %v", format)
+}
+
+// PacketDecoder 在后台从 targetFrame 开始解码 AAC/Vorbis
+// 数据通过 CacheReader 读取：下载完成前读到未下载的位置会等待（并请求优先下载），
+// 下载完成后与直接读文件相同，因此同一个解码器既用于边下边播也用于 Seek
+type PacketDecoder struct {
+	format      AudioFormat
+	cache       *AudioCache
+	target      uint64 // 目标帧位置
+	reader      *CacheReader
+	mutex       sync.Mutex
+	ring        *pcmRingBuffer // 已解码的 PCM 数据（解码出第一段后创建）
+	bufferCfg   decodeBufferConfig
+	sampleRate  int
+	channels    int
+	totalFrames uint64
+	isReady     bool
+	isEOF       bool
+	lastError   string
+	isClosed    bool
+	stopChan    chan struct{}
+}
+
+// NewPacketDecoder 创建从 targetFrame 开始输出的解码器
+// bufferCfg: 缓冲区容量和预缓冲时长
+func NewPacketDecoder(cache *AudioCache, format AudioFormat, targetFrame uint64, bufferCfg decodeBufferConfig) (*PacketDecoder, error) {
+	reader, err := cache.NewReader()
+	if err != nil {
+		return nil, err
+	}
+
+	d := &PacketDecoder{
+		format:    format,
+		cache:     cache,
+		target:    targetFrame,
+		reader:    reader,
+		bufferCfg: bufferCfg,
+		stopChan:  make(chan struct{}),
+	}
+	go d.decodeLoop()
+	return d, nil
+}
+
+func (d *PacketDecoder) decodeLoop() {
+	// 容器可能需要读取文件末尾（MP4 的 moov 在末尾、Ogg 的总长度），要等知道文件大小后再打开
+	for d.cache.GetTotalSize() <= 0 {
+		if state, _, _ := d.cache.GetState(); state == DownloadFailed {
+			d.setError(errors.New("download failed"))
+			return
+		}
+		select {
+		case <-d.stopChan:
+			return
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+
+	source, err := openPacketSource(d.format, d.reader)
+	if err != nil {
+		d.setError(err)
+		return
+	}
+	defer source.close()
+
+	// 从头播放也要定位，音源据此报告需要丢弃的前置静音
+	position, err := source.seek(d.target)
+	if err != nil {
+		d.setError(err)
+		return
+	}
+
+	var ring *pcmRingBuffer
+	readyTarget := 0
+	for {
+		select {
+		case <-d.stopChan:
+			return
+		default:
+		}
+
+		samples, err := source.decode()
+		if err != nil {
+			if err == io.EOF {
+				d.setError(nil)
+			} else {
+				d.setError(err)
+			}
+			return
+		}
+
+		sampleRate, channels, totalFrames := source.info()
+		if channels <= 0 || len(samples) == 0 {
+			continue
+		}
+		frames := int64(len(samples) / channels)
+
+		// 丢弃目标位置之前的帧
+		skip := int64(0)
+		if position < int64(d.target) {
+			skip = int64(d.target) - position
+			if skip > frames {
+				skip = frames
+			}
+		}
+		position += frames
+
+		d.mutex.Lock()
+		d.sampleRate = sampleRate
+		d.channels = channels
+		d.totalFrames = totalFrames
+		if d.ring == nil {
+			d.ring = newPcmRingBuffer(sampleRate, channels, d.bufferCfg.seconds)
+			if d.isClosed {
+				d.ring.Close()
+			}
+			ring = d.ring
+			readyTarget = ring.readyTarget(sampleRate, channels, d.bufferCfg.prebufferSeconds)
+		}
+		d.mutex.Unlock()
+
+		// 缓冲区满时在这里等待读取方腾出空间，关闭后返回 false
+		if !ring.Write(samples[skip*int64(channels):]) {
+			return
+		}
+
+		d.mutex.Lock()
+		if !d.isReady && ring.Len() >= readyTarget {
+			d.isReady = true
+		}
+		d.mutex.Unlock()
+	}
+}
+
+func (d *PacketDecoder) setError(err error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.isClosed {
+		return
+	}
+	if err != nil {
+		d.lastError = err.Error()
+	}
+	d.isEOF = true
+	// 即使出错也设置 isReady，避免 C# 端无限等待
+	d.isReady = true
+}
+
+// GetInfo 获取音频信息（解码出第一段数据之前采样率和声道数为 0）
+func (d *PacketDecoder) GetInfo() (sampleRate, channels int, totalFrames uint64, isReady bool, errStr string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.sampleRate, d.channels, d.totalFrames, d.isReady, d.lastError
+}
+
+// Read 读取 PCM 数据
+// 返回: 读取的帧数，0=暂无数据，-2=EOF
+func (d *PacketDecoder) Read(buffer []float32, framesToRead int) int {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.isClosed {
+		return -2
+	}
+	if d.ring == nil || d.ring.Len() == 0 {
+		if d.isEOF {
+			return -2
+		}
+		return 0
+	}
+	if !d.isReady {
+		return 0
+	}
+
+	return d.ring.Read(buffer[:framesToRead*d.channels]) / d.channels
+}
+
+// Buffered 获取已缓冲的帧数、缓冲区容量（帧）和是否已解码到结尾
+func (d *PacketDecoder) Buffered() (frames, capacity int, finished bool) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.ring != nil && d.channels > 0 {
+		frames, capacity = d.ring.Len()/d.channels, d.ring.Cap()/d.channels
+	}
+	return frames, capacity, d.isEOF
+}
+
+// IsEOF 是否结束
+func (d *PacketDecoder) IsEOF() bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.isEOF && (d.ring == nil || d.ring.Len() == 0)
+}
+
+// Close 关闭解码器
+func (d *PacketDecoder) Close() {
+	d.mutex.Lock()
+	if d.isClosed {
+		d.mutex.Unlock()
+		return
+	}
+	d.isClosed = true
+	close(d.stopChan)
+	ring := d.ring
+	d.mutex.Unlock()
+
+	// 唤醒等待缓冲区空间的解码协程
+	if ring != nil {
+		ring.Close()
+	}
+
+	// 唤醒可能正在等待数据的解码协程
+	d.reader.Close()
+}
+
+// packetFileReader 同步解码完整的文件（响度测量等离线处理使用）
+type packetFileReader struct {
+	file       *os.File
+	source     packetSource
+	position   int64 // 下一段解码输出的位置，负数表示前置静音
+	pending    []float32
+	sampleRate int
+	channels   int
+	err        error
+}
+
+// openPacketFile 打开文件并解码第一段数据以确定采样率和声道数
+func openPacketFile(path string, format AudioFormat) (*packetFileReader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	source, err := openPacketSource(format, file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	r := &packetFileReader{file: file, source: source}
+	if r.position, err = source.seek(0); err != nil {
+		r.Close()
+		return nil, err
+	}
+	if err := r.fill(); err != nil {
+		r.Close()
+		return nil, err
+	}
+	r.sampleRate, r.channels, _ = source.info()
+	return r, nil
+}
+
+// fill 解码下一段数据（丢弃前置静音）
+func (r *packetFileReader) fill() error {
+	for len(r.pending) == 0 {
+		samples, err := r.source.decode()
+		if err != nil {
+			return err
+		}
+		_, channels, _ := r.source.info()
+		if channels <= 0 {
+			continue
+		}
+		frames := int64(len(samples) / channels)
+		skip := int64(0)
+		if r.position < 0 {
+			skip = -r.position
+			if skip > frames {
+				skip = frames
+			}
+		}
+		r.position += frames
+		r.pending = samples[skip*int64(channels):]
+	}
+	return nil
+}
+
+// GetInfo 获取采样率和声道数
+func (r *packetFileReader) GetInfo() (sampleRate, channels int) {
+	return r.sampleRate, r.channels
+}
+
+// ReadFrames 读取 PCM 帧
+// 返回: 读取的帧数，-1=错误，-2=EOF
+func (r *packetFileReader) ReadFrames(buffer []float32, framesToRead int) int {
+	if r.err == nil {
+		r.err = r.fill()
+	}
+	if len(r.pending) == 0 {
+		if r.err == io.EOF {
+			return -2
+		}
+		return -1
+	}
+
+	n := framesToRead * r.channels
+	if n > len(r.pending) {
+		n = len(r.pending)
+	}
+	copy(buffer, r.pending[:n])
+	r.pending = r.pending[n:]
+	return n / r.channels
+}
+
+// Close 关闭文件
+func (r *packetFileReader) Close() {
+	r.source.close()
+	r.file.Close()
+}
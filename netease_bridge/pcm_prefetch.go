@@ -0,0 +1,125 @@
+package main
+
+/*
+#include <stdlib.h>
+*/
+import "C"
+import (
+	"sync"
+)
+
+// 正在预取的缓存（持有一个引用，下载结束后释放）
+var (
+	prefetchMutex sync.Mutex
+	prefetches    = make(map[string]*AudioCache)
+)
+
+//export NeteasePrefetchSong
+// NeteasePrefetchSong 预取歌曲：获取 URL 并在后台下载到音频缓存
+// 之后对同一歌曲调用 NeteaseCreatePcmStream 会直接使用该缓存（下载完成后即可 Seek）
+// 返回: 1 = 已开始预取或已有缓存, 0 = 失败
+func NeteasePrefetchSong(songIdC C.longlong, qualityC *C.char) C.int {
+	return NeteaseSessionPrefetchSong(0, songIdC, qualityC)
+}
+
+//export NeteaseSessionPrefetchSong
+// NeteaseSessionPrefetchSong 使用指定会话获取播放地址并预取歌曲
+func NeteaseSessionPrefetchSong(sessionC C.longlong, songIdC C.longlong, qualityC *C.char) C.int {
+	session := getSession(int64(sessionC))
+	if session == nil {
+		return 0
+	}
+
+	songId := int64(songIdC)
+	quality := C.GoString(qualityC)
+	if quality == "" {
+		quality = "exhigh"
+	}
+	key := audioCacheKey(songId, quality)
+
+	prefetchMutex.Lock()
+	_, exists := prefetches[key]
+	prefetchMutex.Unlock()
+	if exists {
+		return 1
+	}
+
+	cache, _, err := acquireAudioCache(session, songId, quality, downloadOptions{timeouts: defaultDownloadTimeouts})
+	if err != nil {
+		setErrorFrom(err, ErrNetwork)
+		return 0
+	}
+
+	if cache.IsComplete() {
+		// 已经在本地缓存中
+		cache.Close()
+		return 1
+	}
+
+	prefetchMutex.Lock()
+	if _, exists := prefetches[key]; exists {
+		// 并发调用已经开始预取
+		prefetchMutex.Unlock()
+		cache.Close()
+		return 1
+	}
+	prefetches[key] = cache
+	prefetchMutex.Unlock()
+
+	// 下载结束（完成或失败）后释放预取持有的引用
+	// 完整的文件会写入缓存清单，失败的下载在没有其他引用时被删除
+	cache.AddOnComplete(func() {
+		releasePrefetch(key, cache)
+	})
+	cache.AddOnFailed(func(string) {
+		releasePrefetch(key, cache)
+	})
+
+	return 1
+}
+
+//export NeteaseCancelPrefetch
+// NeteaseCancelPrefetch 取消预取（如果歌曲正在播放，下载会继续）
+func NeteaseCancelPrefetch(songIdC C.longlong, qualityC *C.char) {
+	quality := C.GoString(qualityC)
+	if quality == "" {
+		quality = "exhigh"
+	}
+	key := audioCacheKey(int64(songIdC), quality)
+
+	prefetchMutex.Lock()
+	cache, exists := prefetches[key]
+	prefetchMutex.Unlock()
+	if exists {
+		releasePrefetch(key, cache)
+	}
+}
+
+// cancelSessionPrefetches 取消使用 session 获取地址的预取（会话销毁时调用）
+func cancelSessionPrefetches(session *Session) {
+	prefetchMutex.Lock()
+	owned := make(map[string]*AudioCache)
+	for key, cache := range prefetches {
+		if cache.urlSessionIs(session) {
+			owned[key] = cache
+		}
+	}
+	prefetchMutex.Unlock()
+
+	for key, cache := range owned {
+		releasePrefetch(key, cache)
+	}
+}
+
+// releasePrefetch 释放预取持有的缓存引用（只释放一次）
+func releasePrefetch(key string, cache *AudioCache) {
+	prefetchMutex.Lock()
+	if prefetches[key] != cache {
+		prefetchMutex.Unlock()
+		return
+	}
+	delete(prefetches, key)
+	prefetchMutex.Unlock()
+
+	cache.Close()
+}
@@ -0,0 +1,161 @@
+package main
+
+import "math"
+
+const (
+	resamplerTaps   = 32  // 单侧抽头数（滤波器总长 64）
+	resamplerPhases = 256 // 多相滤波器的相位数，相位之间线性插值
+	resamplerBeta   = 8.6 // Kaiser 窗参数（约 -90dB 阻带）
+	resamplerChunk  = 1024
+)
+
+// pcmResampler 多相窗函数 sinc 重采样器
+// 从 read 回调拉取源采样率的 PCM，输出目标采样率的 PCM（交错存放）
+type pcmResampler struct {
+	inRate   int
+	outRate  int
+	channels int
+	step     float64     // 每个输出帧对应的输入帧数
+	filter   [][]float32 // [相位][抽头]
+	input    []float32   // 待处理的输入帧（开头保留 taps-1 帧历史）
+	pos      float64     // 下一个输出帧在 input 中的位置（帧）
+	srcEOF   bool
+	readBuf  []float32
+}
+
+func newPcmResampler(inRate, outRate, channels int) *pcmResampler {
+	r := &pcmResampler{
+		inRate:   inRate,
+		outRate:  outRate,
+		channels: channels,
+		step:     float64(inRate) / float64(outRate),
+		readBuf:  make([]float32, resamplerChunk*channels),
+	}
+
+	// 降采样时截止频率降到目标采样率的奈奎斯特频率以下，防止混叠
+	cutoff := 1.0
+	if outRate < inRate {
+		cutoff = float64(outRate) / float64(inRate)
+	}
+	cutoff *= 0.97
+
+	r.filter = make([][]float32, resamplerPhases+1)
+	for p := 0; p <= resamplerPhases; p++ {
+		frac := float64(p) / resamplerPhases
+		coeffs := make([]float32, 2*resamplerTaps)
+		var sum float64
+		values := make([]float64, 2*resamplerTaps)
+		for j := range values {
+			d := float64(j-resamplerTaps+1) - frac
+			values[j] = cutoff * sinc(cutoff*d) * kaiser(d/resamplerTaps, resamplerBeta)
+			sum += values[j]
+		}
+		// 每个相位归一化，保证直流增益为 1
+		for j, v := range values {
+			coeffs[j] = float32(v / sum)
+		}
+		r.filter[p] = coeffs
+	}
+
+	r.reset()
+	return r
+}
+
+// reset 清空内部状态（Seek 后调用）
+func (r *pcmResampler) reset() {
+	r.input = make([]float32, (resamplerTaps-1)*r.channels, 4*resamplerChunk*r.channels)
+	r.pos = resamplerTaps - 1
+	r.srcEOF = false
+}
+
+// process 输出最多 frames 帧
+// 返回: 输出的帧数，0 = 暂无数据，-1 = 错误，-2 = EOF
+func (r *pcmResampler) process(out []float32, frames int, read func(buffer []float32, frames int) int) int {
+	ch := r.channels
+	produced := 0
+
+	for produced < frames {
+		i := int(r.pos)
+		if (i+resamplerTaps+1)*ch > len(r.input) {
+			// 输入不足，从源拉取更多数据
+			if r.srcEOF {
+				if produced == 0 {
+					return -2
+				}
+				break
+			}
+			n := read(r.readBuf, resamplerChunk)
+			if n == -2 {
+				// 用静音冲刷滤波器中剩余的数据
+				r.srcEOF = true
+				r.input = append(r.input, make([]float32, resamplerTaps*ch)...)
+				continue
+			}
+			if n <= 0 {
+				if produced == 0 {
+					return n
+				}
+				break
+			}
+			r.input = append(r.input, r.readBuf[:n*ch]...)
+			continue
+		}
+
+		frac := r.pos - float64(i)
+		phase := frac * resamplerPhases
+		p := int(phase)
+		w := float32(phase - float64(p))
+		h0, h1 := r.filter[p], r.filter[p+1]
+		base := (i - resamplerTaps + 1) * ch
+		for c := 0; c < ch; c++ {
+			var acc float32
+			for j := 0; j < 2*resamplerTaps; j++ {
+				acc += r.input[base+j*ch+c] * (h0[j] + w*(h1[j]-h0[j]))
+			}
+			out[produced*ch+c] = acc
+		}
+		produced++
+		r.pos += r.step
+	}
+
+	// 丢弃不再需要的输入（保留 taps-1 帧历史）
+	if drop := int(r.pos) - resamplerTaps + 1; drop > 0 {
+		if drop*ch > len(r.input) {
+			drop = len(r.input) / ch
+		}
+		remaining := copy(r.input, r.input[drop*ch:])
+		r.input = r.input[:remaining]
+		r.pos -= float64(drop)
+	}
+
+	return produced
+}
+
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	x *= math.Pi
+	return math.Sin(x) / x
+}
+
+// kaiser Kaiser 窗，x 取值 [-1, 1]
+func kaiser(x, beta float64) float64 {
+	if x < -1 || x > 1 {
+		return 0
+	}
+	return besselI0(beta*math.Sqrt(1-x*x)) / besselI0(beta)
+}
+
+// besselI0 第一类修正贝塞尔函数 I0（级数展开）
+func besselI0(x float64) float64 {
+	sum, term := 1.0, 1.0
+	for k := 1; k < 50; k++ {
+		term *= (x / (2 * float64(k))) * (x / (2 * float64(k)))
+		sum += term
+		if term < sum*1e-12 {
+			break
+		}
+	}
+	return sum
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// resamplerSource 按块提供 frames 帧 PCM，之后返回 EOF
+func resamplerSource(channels, frames int, sample func(frame, channel int) float32) func(buffer []float32, n int) int {
+	next := 0
+	return func(buffer []float32, n int) int {
+		if next >= frames {
+			return -2
+		}
+		if n > frames-next {
+			n = frames - next
+		}
+		for i := 0; i < n; i++ {
+			for c := 0; c < channels; c++ {
+				buffer[i*channels+c] = sample(next+i, c)
+			}
+		}
+		next += n
+		return n
+	}
+}
+
+// resampleAll 一直处理到 EOF，返回全部输出
+func resampleAll(t *testing.T, r *pcmResampler, read func(buffer []float32, n int) int) []float32 {
+	t.Helper()
+	var output []float32
+	buffer := make([]float32, 700*r.channels)
+	for calls := 0; ; calls++ {
+		if calls > 100000 {
+			t.Fatal("resampler did not reach EOF")
+		}
+		n := r.process(buffer, 700, read)
+		if n == -2 {
+			return output
+		}
+		if n <= 0 {
+			t.Fatalf("process() = %d before EOF", n)
+		}
+		output = append(output, buffer[:n*r.channels]...)
+	}
+}
+
+func TestPcmResamplerRates(t *testing.T) {
+	tests := []struct {
+		name     string
+		inRate   int
+		outRate  int
+		channels int
+	}{
+		{"same rate", 44100, 44100, 2},
+		{"upsample 44.1k to 48k", 44100, 48000, 2},
+		{"downsample 48k to 44.1k", 48000, 44100, 2},
+		{"downsample 96k to 48k mono", 96000, 48000, 1},
+		{"upsample 22.05k to 48k", 22050, 48000, 2},
+	}
+	const inFrames = 20000
+	const level = 0.5
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newPcmResampler(tt.inRate, tt.outRate, tt.channels)
+			read := resamplerSource(tt.channels, inFrames, func(frame, channel int) float32 {
+				if channel == 1 {
+					return -level
+				}
+				return level
+			})
+			output := resampleAll(t, r, read)
+			outFrames := len(output) / tt.channels
+
+			// 输出时长与输入一致（末尾多出滤波器冲刷的部分）
+			ratio := float64(tt.outRate) / float64(tt.inRate)
+			want := float64(inFrames) * ratio
+			tail := float64(resamplerTaps)*ratio + 2
+			if float64(outFrames) < want-2 || float64(outFrames) > want+tail {
+				t.Fatalf("output frames = %d, want %.0f..%.0f", outFrames, want-2, want+tail)
+			}
+
+			// 滤波器填满之后直流增益为 1，声道之间不串扰
+			margin := int(2*float64(resamplerTaps)*ratio) + 2
+			for i := margin; i < int(want)-margin; i++ {
+				for c := 0; c < tt.channels; c++ {
+					expected := float32(level)
+					if c == 1 {
+						expected = -level
+					}
+					if got := output[i*tt.channels+c]; math.Abs(float64(got-expected)) > 1e-3 {
+						t.Fatalf("frame %d channel %d = %v, want %v", i, c, got, expected)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestPcmResamplerPreservesSine(t *testing.T) {
+	const inRate, outRate = 48000, 44100
+	const freq = 1000.0
+	r := newPcmResampler(inRate, outRate, 1)
+	read := resamplerSource(1, inRate/2, func(frame, channel int) float32 {
+		return float32(math.Sin(2 * math.Pi * freq * float64(frame) / inRate))
+	})
+	output := resampleAll(t, r, read)
+
+	// 通带内的正弦波幅度不变
+	var peak float64
+	for _, v := range output[outRate/10 : outRate/2-outRate/10] {
+		peak = math.Max(peak, math.Abs(float64(v)))
+	}
+	if peak < 0.98 || peak > 1.02 {
+		t.Fatalf("sine peak = %v, want about 1", peak)
+	}
+}
+
+func TestPcmResamplerSourceStates(t *testing.T) {
+	tests := []struct {
+		name   string
+		result int // 源返回的值
+		want   int
+	}{
+		{"eof", -2, -2},
+		{"no data yet", 0, 0},
+		{"error", -1, -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newPcmResampler(44100, 48000, 2)
+			buffer := make([]float32, 256*2)
+			read := func([]float32, int) int { return tt.result }
+			if got := r.process(buffer, 256, read); got != tt.want {
+				t.Fatalf("process() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPcmResamplerReset(t *testing.T) {
+	r := newPcmResampler(44100, 48000, 1)
+	silent := func(buffer []float32, n int) int {
+		for i := range buffer[:n] {
+			buffer[i] = 0
+		}
+		return n
+	}
+	buffer := make([]float32, 512)
+	if n := r.process(buffer, 512, silent); n != 512 {
+		t.Fatalf("process() = %d, want 512", n)
+	}
+	if r.process(buffer, 512, func([]float32, int) int { return -2 }) <= 0 {
+		t.Fatal("expected flushed frames after EOF")
+	}
+
+	// reset 之后重新开始，不再处于 EOF 状态
+	r.reset()
+	if r.srcEOF || r.pos != resamplerTaps-1 {
+		t.Fatalf("reset left srcEOF=%v pos=%v", r.srcEOF, r.pos)
+	}
+	if n := r.process(buffer, 512, silent); n != 512 {
+		t.Fatalf("process() after reset = %d, want 512", n)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import "sync"
+
+// 解码缓冲区的默认时长和允许范围（秒）
+const (
+	defaultDecodeBufferSeconds = 4.0
+	minDecodeBufferSeconds     = 0.5
+	maxDecodeBufferSeconds     = 30.0
+)
+
+// 开始输出前默认预缓冲的时长（秒）
+const defaultPrebufferSeconds = 0.5
+
+// decodeBufferConfig 解码缓冲区的容量和预缓冲时长
+type decodeBufferConfig struct {
+	seconds          float64 // 缓冲区容量，缓冲区满时解码协程等待读取
+	prebufferSeconds float64 // 缓冲到该时长后才报告就绪
+}
+
+// pcmRingBuffer 固定容量的 PCM 环形缓冲区（交错存放的 float32 样本）
+// 一个解码协程写入、音频线程读取：缓冲区满时写入方阻塞到读取方腾出空间，读取方从不阻塞
+type pcmRingBuffer struct {
+	mutex   sync.Mutex
+	notFull *sync.Cond
+	data    []float32
+	head    int // 下一个读取的位置
+	count   int // 已缓冲的样本数
+	closed  bool
+}
+
+// newPcmRingBuffer 创建可以容纳 seconds 秒音频的缓冲区
+func newPcmRingBuffer(sampleRate, channels int, seconds float64) *pcmRingBuffer {
+	if seconds <= 0 {
+		seconds = defaultDecodeBufferSeconds
+	}
+	// 容量按整帧对齐，读写都不会拆开一帧
+	frames := int(float64(sampleRate) * seconds)
+	if frames < 1 {
+		frames = 1
+	}
+	r := &pcmRingBuffer{data: make([]float32, frames*channels)}
+	r.notFull = sync.NewCond(&r.mutex)
+	return r
+}
+
+// Write 写入全部样本，缓冲区满时等待
+// 返回: false = 缓冲区已关闭（未写完的样本被丢弃）
+func (r *pcmRingBuffer) Write(samples []float32) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for len(samples) > 0 {
+		for r.count == len(r.data) && !r.closed {
+			r.notFull.Wait()
+		}
+		if r.closed {
+			return false
+		}
+
+		tail := (r.head + r.count) % len(r.data)
+		n := len(r.data) - r.count
+		if n > len(r.data)-tail {
+			n = len(r.data) - tail // 先写到数组末尾，剩余部分下一轮从头写
+		}
+		if n > len(samples) {
+			n = len(samples)
+		}
+		copy(r.data[tail:tail+n], samples[:n])
+		r.count += n
+		samples = samples[n:]
+	}
+	return true
+}
+
+// Read 读取最多 len(dst) 个样本，不等待
+// 返回: 读取的样本数
+func (r *pcmRingBuffer) Read(dst []float32) int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	n := len(dst)
+	if n > r.count {
+		n = r.count
+	}
+	first := n
+	if first > len(r.data)-r.head {
+		first = len(r.data) - r.head
+	}
+	copy(dst[:first], r.data[r.head:r.head+first])
+	copy(dst[first:n], r.data[:n-first])
+
+	r.head = (r.head + n) % len(r.data)
+	r.count -= n
+	if n > 0 {
+		r.notFull.Signal()
+	}
+	return n
+}
+
+// Len 已缓冲的样本数
+func (r *pcmRingBuffer) Len() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.count
+}
+
+// readyTarget 报告就绪前需要缓冲的样本数，按实际的采样率和声道数计算
+// 预缓冲时长超过缓冲区容量时为缓冲区满
+func (r *pcmRingBuffer) readyTarget(sampleRate, channels int, prebufferSeconds float64) int {
+	target := int(prebufferSeconds*float64(sampleRate)) * channels
+	if target < channels {
+		target = channels // 至少一帧
+	}
+	if target > len(r.data) {
+		target = len(r.data)
+	}
+	return target
+}
+
+// Cap 缓冲区容量（样本数）
+func (r *pcmRingBuffer) Cap() int {
+	return len(r.data)
+}
+
+// Close 关闭缓冲区，唤醒等待中的写入方（之后仍可读出剩余数据）
+func (r *pcmRingBuffer) Close() {
+	r.mutex.Lock()
+	r.closed = true
+	r.mutex.Unlock()
+	r.notFull.Broadcast()
+}
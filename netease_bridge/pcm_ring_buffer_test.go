@@ -0,0 +1,163 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func ringSamples(from, n int) []float32 {
+	samples := make([]float32, n)
+	for i := range samples {
+		samples[i] = float32(from + i)
+	}
+	return samples
+}
+
+func TestPcmRingBufferWrapAround(t *testing.T) {
+	tests := []struct {
+		name     string
+		capacity int   // 帧数（单声道）
+		writes   []int // 每轮先写入的样本数
+		reads    []int // 每轮随后读取的样本数
+	}{
+		{"exact fill", 8, []int{8}, []int{8}},
+		{"wrap once", 8, []int{6, 6}, []int{4, 8}},
+		{"wrap many", 5, []int{3, 4, 2, 5, 1}, []int{2, 5, 3, 4, 2}},
+		{"read more than buffered", 4, []int{2, 3}, []int{3, 4}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newPcmRingBuffer(tt.capacity, 1, 1)
+			if r.Cap() != tt.capacity {
+				t.Fatalf("Cap() = %d, want %d", r.Cap(), tt.capacity)
+			}
+			written, read := 0, 0
+			for i := range tt.writes {
+				if !r.Write(ringSamples(written, tt.writes[i])) {
+					t.Fatalf("write %d: buffer reported closed", i)
+				}
+				written += tt.writes[i]
+				if r.Len() != written-read {
+					t.Fatalf("write %d: Len() = %d, want %d", i, r.Len(), written-read)
+				}
+
+				dst := make([]float32, tt.reads[i])
+				n := r.Read(dst)
+				want := tt.reads[i]
+				if want > written-read {
+					want = written - read
+				}
+				if n != want {
+					t.Fatalf("read %d: got %d samples, want %d", i, n, want)
+				}
+				for j := 0; j < n; j++ {
+					if dst[j] != float32(read+j) {
+						t.Fatalf("read %d: sample %d = %v, want %d", i, j, dst[j], read+j)
+					}
+				}
+				read += n
+			}
+		})
+	}
+}
+
+func TestPcmRingBufferWriterBlocksUntilRead(t *testing.T) {
+	r := newPcmRingBuffer(4, 2, 1) // 8 个样本
+	if !r.Write(ringSamples(0, 6)) {
+		t.Fatal("initial write failed")
+	}
+
+	done := make(chan bool)
+	go func() {
+		done <- r.Write(ringSamples(6, 6))
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("writer did not block on a full buffer")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if r.Len() != r.Cap() {
+		t.Fatalf("Len() = %d while writer waits, want %d", r.Len(), r.Cap())
+	}
+
+	dst := make([]float32, 4)
+	if n := r.Read(dst); n != 4 {
+		t.Fatalf("Read() = %d, want 4", n)
+	}
+	select {
+	case ok := <-done:
+		if !ok {
+			t.Fatal("writer reported closed buffer")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("writer was not woken up by Read")
+	}
+
+	rest := make([]float32, 16)
+	n := r.Read(rest)
+	if n != 8 {
+		t.Fatalf("Read() = %d, want 8", n)
+	}
+	for i := 0; i < n; i++ {
+		if rest[i] != float32(4+i) {
+			t.Fatalf("sample %d = %v, want %d", i, rest[i], 4+i)
+		}
+	}
+}
+
+func TestPcmRingBufferCloseWhileBlocked(t *testing.T) {
+	r := newPcmRingBuffer(4, 1, 1)
+	if !r.Write(ringSamples(0, 4)) {
+		t.Fatal("initial write failed")
+	}
+
+	done := make(chan bool)
+	go func() {
+		done <- r.Write(ringSamples(4, 2))
+	}()
+	time.Sleep(20 * time.Millisecond)
+	r.Close()
+
+	select {
+	case ok := <-done:
+		if ok {
+			t.Fatal("Write returned true after Close")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Close did not wake up the blocked writer")
+	}
+
+	// 关闭后仍可读出剩余数据，但不能再写入
+	dst := make([]float32, 8)
+	if n := r.Read(dst); n != 4 {
+		t.Fatalf("Read() after Close = %d, want 4", n)
+	}
+	if r.Write(ringSamples(0, 1)) {
+		t.Fatal("Write succeeded on a closed buffer")
+	}
+}
+
+func TestPcmRingBufferReadyTarget(t *testing.T) {
+	r := newPcmRingBuffer(1000, 2, 1) // 2000 个样本
+	tests := []struct {
+		name       string
+		sampleRate int
+		channels   int
+		prebuffer  float64
+		want       int
+	}{
+		{"half second stereo", 1000, 2, 0.5, 1000},
+		{"zero prebuffer is one frame", 1000, 2, 0, 2},
+		{"capped at capacity", 1000, 2, 5, 2000},
+		{"mono source", 1000, 1, 0.25, 250},
+		{"higher source rate", 4000, 2, 0.1, 800},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := r.readyTarget(tt.sampleRate, tt.channels, tt.prebuffer); got != tt.want {
+				t.Fatalf("readyTarget() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -10,7 +10,6 @@ import (
 	"fmt"
 	"strings"
 	"sync"
-	"time"
 	"unsafe"
 )
 
@@ -20,12 +19,46 @@ type AudioFormat int
 const (
 	FormatMP3 AudioFormat = iota
 	FormatFLAC
+	FormatAAC    // MP4 容器中的 AAC（m4a）
+	FormatVorbis // Ogg Vorbis
 )
 
+// audioFormatFromType 根据 SongURL.Type 判断音频格式
+func audioFormatFromType(musicType string) AudioFormat {
+	switch strings.ToLower(musicType) {
+	case "flac":
+		return FormatFLAC
+	case "m4a", "mp4", "aac":
+		return FormatAAC
+	case "ogg", "oga":
+		return FormatVorbis
+	}
+	return FormatMP3 // 默认 MP3
+}
+
+// String 返回 PcmStreamInfo.Format 中使用的格式名
+func (f AudioFormat) String() string {
+	switch f {
+	case FormatFLAC:
+		return "flac"
+	case FormatAAC:
+		return "aac"
+	case FormatVorbis:
+		return "vorbis"
+	}
+	return "mp3"
+}
+
+// usesPacketDecoder 是否使用 PacketDecoder（边下边播和 Seek 共用一个解码器）
+func (f AudioFormat) usesPacketDecoder() bool {
+	return f == FormatAAC || f == FormatVorbis
+}
+
 // PcmStream 表示一个 PCM 音频流
 // 支持边下边播 + Seek 时切换到完整文件解码
 type PcmStream struct {
 	id              int64
+	session         *Session // 创建流的会话（获取播放地址使用）
 	songId          int64
 	url             string
 	format          AudioFormat // 音频格式
@@ -39,14 +72,51 @@ type PcmStream struct {
 	// MP3 可 Seek 解码器（下载完成后可用）
 	seekableDec     *SeekableDecoder
 	
-	// FLAC 流式解码器
+	// FLAC 流式解码器（边下边播，下载完成前 Seek 时从目标位置重新创建）
 	flacStreamingDec *FlacStreamingDecoder
 	
 	// FLAC 可 Seek 解码器
 	flacSeekableDec  *FlacSeekableDecoder
 	
+	// AAC/Vorbis 解码器（通过缓存读取器解码，下载完成前后都可以 Seek）
+	packetDec        *PacketDecoder
+	
+	// 文件头信息（下载完成前 Seek 时用于把帧位置换算为字节偏移）
+	mp3Info          *mp3StreamInfo
+	flacHeader       *flacHeaderInfo
+	
+	// 无缝播放：MP3 编码器延迟/填充裁剪
+	trimmer         *gaplessTrimmer
+	gaplessChecked  bool   // 是否已确定是否需要裁剪（开始输出后不再改变）
+	
+	// 当前流结束后无缝接续的下一个流
+	next            *PcmStream
+	
+	// 创建参数和输出重采样
+	options         PcmStreamOptions
+	resampler       *pcmResampler
+	
+	// 声道转换（音源声道数与输出声道数不同时使用）
+	channelMapper   *channelMapper
+	channelBuf      []float32
+	
+	// 响度标准化（增益 + 真峰值限制器）
+	loudness        *loudnessStage
+	loudnessGainDb  float64
+	loudnessGainSet bool   // 是否已得到测量结果（得到前以 0dB 输出）
+	
+	// 播放位置（输出采样率下已输出的帧数，Seek 时设为目标位置）
+	position        int64
+	positionFloor   int64  // Seek 目标位置，限制器延迟输出期间位置不小于此值
+	
+	// DSP 处理器链（dspOverride 为 false 时跟随全局配置）
+	dsp             *dspChain
+	dspConfig       *DspConfig
+	dspOverride     bool
+	
 	// 音频缓存
 	cache           *AudioCache
+	offline         bool   // 网络不可用，使用的是其他音质的缓存或离线下载的文件
 	
 	// 状态
 	mutex           sync.Mutex
@@ -54,6 +124,11 @@ type PcmStream struct {
 	isReady         bool
 	isEOF           bool
 	lastError       string
+	isFailed        bool   // 流已无法继续播放（例如等待 Seek 时下载失败）
+	
+	// 事件队列（NeteasePollEvents）
+	events          streamEventState
+	buffering       streamBufferState // 缓冲状态和欠载次数
 	
 	// 延迟 Seek 支持
 	pendingSeek     int64  // 等待执行的 Seek 位置，-1 表示无
@@ -69,90 +144,176 @@ var (
 // PcmStreamInfo 返回给 C# 的流信息
 type PcmStreamInfo struct {
 	StreamId     int64  `json:"streamId"`
+	SongId       int64  `json:"songId"` // 链接的下一首开始播放后会变化
 	SampleRate   int    `json:"sampleRate"`
-	Channels     int    `json:"channels"`
+	Channels     int    `json:"channels"` // 输出声道数（NeteaseReadPcmFrames 按此交错）
 	TotalFrames  uint64 `json:"totalFrames"`
+	Position     int64  `json:"position"` // 当前播放位置（输出帧）
 	IsReady      bool   `json:"isReady"`
 	CanSeek      bool   `json:"canSeek"`
 	IsEOF        bool   `json:"isEOF"`   // 流是否已结束
-	Format       string `json:"format"` // "mp3" or "flac"
+	Format       string `json:"format"` // "mp3", "flac", "aac" or "vorbis"
 	Error        string `json:"error,omitempty"`
+
+	// 声道布局: "mono", "stereo", "5.1", ...（音源声道数未知时为 0）
+	ChannelLayout  string `json:"channelLayout"`
+	SourceChannels int    `json:"sourceChannels"`
+
+	// 响度标准化: 当前应用的增益 (dB) 和测量得到的积分响度（未测量时为 0）
+	LoudnessGainDb float64 `json:"loudnessGainDb"`
+	MeasuredLufs   float64 `json:"measuredLufs"`
+
+	// 缓冲状态: "buffering", "playing", "stalled"；欠载次数和解码器中已缓冲的时长（秒）
+	BufferState     string  `json:"bufferState"`
+	UnderrunCount   int     `json:"underrunCount"`
+	BufferedSeconds float64 `json:"bufferedSeconds"`
+
+	// 缓存下载状态: "idle", "downloading", "retrying", "complete", "failed"
+	DownloadState   string `json:"downloadState"`
+	DownloadRetries int    `json:"downloadRetries"`
+	DownloadError   string `json:"downloadError,omitempty"`
+
+	// 下载完成后的完整性校验: "unverified", "verifying", "verified", "redownloading", "corrupted"
+	Integrity      string `json:"integrity"`
+	IntegrityError string `json:"integrityError,omitempty"`
+
+	// 离线播放: 网络不可用，使用的是其他音质的缓存或离线下载的文件
+	Offline bool `json:"offline"`
 }
 
 //export NeteaseCreatePcmStream
 func NeteaseCreatePcmStream(songIdC C.longlong, qualityC *C.char) C.longlong {
-	if !initialized {
-		lastError = "Not initialized"
+	session := getSession(0)
+	if session == nil {
 		return -1
 	}
+	return C.longlong(createPcmStream(session, int64(songIdC), C.GoString(qualityC), PcmStreamOptions{}))
+}
 
-	songId := int64(songIdC)
-	quality := C.GoString(qualityC)
-	if quality == "" {
-		quality = "exhigh"
-	}
+//export NeteaseCreatePcmStreamEx
+// NeteaseCreatePcmStreamEx 创建 PCM 流并指定可选参数
+// optionsJson: PcmStreamOptions 的 JSON，例如 {"outputSampleRate": 48000}
+// 返回: 流 ID，-1 = 失败
+func NeteaseCreatePcmStreamEx(songIdC C.longlong, qualityC *C.char, optionsJsonC *C.char) C.longlong {
+	return NeteaseSessionCreatePcmStream(0, songIdC, qualityC, optionsJsonC)
+}
 
-	// 获取歌曲 URL
-	urlResult := NeteaseGetSongURL(C.longlong(songId), C.CString(quality))
-	if urlResult == nil {
+//export NeteaseSessionCreatePcmStream
+// NeteaseSessionCreatePcmStream 使用指定会话获取播放地址并创建 PCM 流
+// optionsJson: PcmStreamOptions 的 JSON，空字符串使用默认值
+// 返回: 流 ID，-1 = 失败
+func NeteaseSessionCreatePcmStream(sessionC C.longlong, songIdC C.longlong, qualityC *C.char, optionsJsonC *C.char) C.longlong {
+	session := getSession(int64(sessionC))
+	if session == nil {
 		return -1
 	}
-	
-	var songUrl SongURL
-	urlJson := C.GoString(urlResult)
-	NeteaseFreeString(urlResult)
-	
-	if err := json.Unmarshal([]byte(urlJson), &songUrl); err != nil {
-		lastError = "Failed to parse song URL: " + err.Error()
+	options, err := parsePcmStreamOptions(C.GoString(optionsJsonC))
+	if err != nil {
+		setError(ErrInvalidArgument, err.Error())
 		return -1
 	}
+	return C.longlong(createPcmStream(session, int64(songIdC), C.GoString(qualityC), options))
+}
 
-	if songUrl.URL == "" {
-		lastError = "Empty URL returned"
-		return -1
+// createPcmStream 创建 PCM 流，返回流 ID，失败时返回 -1 并记录错误
+func createPcmStream(session *Session, songId int64, quality string, options PcmStreamOptions) int64 {
+	if quality == "" {
+		quality = "exhigh"
 	}
 
-	// 检测音频格式
-	audioFormat := FormatMP3 // 默认 MP3
-	if strings.ToLower(songUrl.Type) == "flac" {
-		audioFormat = FormatFLAC
+	cache, offline, err := acquireAudioCache(session, songId, quality, options.downloadOptions())
+	if err != nil {
+		setErrorFrom(err, ErrNetwork)
+		return -1
 	}
 
 	// 创建流
 	stream := &PcmStream{
+		session:     session,
 		songId:      songId,
-		url:         songUrl.URL,
-		format:      audioFormat,
+		url:         cache.GetURL(),
+		format:      audioFormatFromType(cache.format),
+		cache:       cache,
+		options:     options,
 		pendingSeek: -1, // 初始化为无待定 Seek
+		buffering:   newStreamBufferState(),
+		offline:     offline,
 	}
 
-	// 创建缓存（后台下载）
-	cache, err := NewAudioCache(songUrl.URL, songId)
-	if err == nil {
-		stream.cache = cache
-		// 设置下载完成回调
-		cache.SetOnComplete(func() {
-			stream.onCacheComplete()
-		})
-		cache.StartDownload()
+	if options.loudnessEnabled() && loudnessStore != nil {
+		// 没有测量结果时在缓存完整后测量（首次播放以 0dB 输出，测量完成后平滑过渡）
+		loudnessStore.SetAlbum(songId, options.AlbumId)
+		if cache.IsComplete() {
+			loudnessStore.Analyze(songId, cache)
+		} else {
+			cache.AddOnComplete(func() {
+				loudnessStore.Analyze(songId, cache)
+			})
+		}
 	}
 
-	// 根据格式创建流式解码器
-	if audioFormat == FormatFLAC {
-		// FLAC: 需要等待足够的数据才能开始解码
-		// 创建 FLAC 流式解码器
-		if cache != nil {
-			// 传入缓存完成检查回调
-			stream.flacStreamingDec = NewFlacStreamingDecoder(cache.GetCachePath(), func() bool {
-				return cache.IsComplete()
+	if stream.format.usesPacketDecoder() {
+		decoder, err := NewPacketDecoder(cache, stream.format, 0, options.decodeBuffer())
+		if err != nil {
+			cache.Close()
+			setError(ErrIO, "Failed to open audio cache: "+err.Error())
+			return -1
+		}
+		stream.packetDec = decoder
+		if !cache.IsComplete() {
+			cache.AddOnFailed(func(errMsg string) {
+				stream.onCacheFailed(errMsg)
+			})
+			cache.AddOnRedownload(func() {
+				stream.onCacheRedownload()
 			})
-			// FLAC 需要等缓存下载一部分后才能尝试打开
-			go stream.tryOpenFlacStream()
+		}
+	} else if cache.IsComplete() {
+		// 完整缓存：直接使用可 Seek 解码器
+		stream.mutex.Lock()
+		err := stream.openSeekableDecoder()
+		if err == nil {
+			stream.useSeekable = true
+		}
+		stream.mutex.Unlock()
+		if err != nil {
+			cache.Close()
+			setErrorFrom(err, ErrDecode)
+			return -1
 		}
 	} else {
-		// MP3: 可以立即开始流式解码
-		stream.streamingDec = NewStreamingDecoder(songUrl.URL)
-		stream.streamingDec.Start()
+		// 设置下载完成/失败回调
+		cache.AddOnComplete(func() {
+			stream.onCacheComplete()
+		})
+		cache.AddOnFailed(func(errMsg string) {
+			stream.onCacheFailed(errMsg)
+		})
+		cache.AddOnRedownload(func() {
+			stream.onCacheRedownload()
+		})
+
+		// 根据格式创建流式解码器
+		if stream.format == FormatFLAC {
+			// FLAC: 解码协程先从缓存读取文件头，再从头开始解码（与缓存共用同一个下载）
+			decoder, err := NewFlacStreamingDecoder(cache, nil, 0, options.decodeBuffer(), options.headerOpenTimeout())
+			if err != nil {
+				cache.Close()
+				setError(ErrIO, "Failed to open audio cache: "+err.Error())
+				return -1
+			}
+			stream.flacStreamingDec = decoder
+		} else {
+			// MP3: 从缓存文件流式解码（与缓存共用同一个下载）
+			reader, err := cache.NewReader()
+			if err != nil {
+				cache.Close()
+				setError(ErrIO, "Failed to open audio cache: "+err.Error())
+				return -1
+			}
+			stream.streamingDec = NewStreamingDecoder(reader, nil, stream.options.decodeBuffer(), stream.options.headerOpenTimeout())
+			stream.streamingDec.Start()
+		}
 	}
 
 	streamsMutex.Lock()
@@ -161,39 +322,81 @@ func NeteaseCreatePcmStream(songIdC C.longlong, qualityC *C.char) C.longlong {
 	activeStreams[stream.id] = stream
 	streamsMutex.Unlock()
 
-	return C.longlong(stream.id)
+	stream.mutex.Lock()
+	stream.startEventWatcher()
+	stream.mutex.Unlock()
+
+	return stream.id
 }
 
-// tryOpenFlacStream 尝试打开 FLAC 流（等待足够的缓存数据）
-func (s *PcmStream) tryOpenFlacStream() {
-	if s.flacStreamingDec == nil {
-		return
+// acquireAudioCache 获取歌曲的音频缓存
+// 优先使用本地缓存或正在进行的下载（例如预取），否则获取 URL 并开始后台下载
+// 强制离线或网络不可用时使用其他音质的缓存或离线下载的文件，此时 offline 为 true
+func acquireAudioCache(session *Session, songId int64, quality string, download downloadOptions) (cache *AudioCache, offline bool, err error) {
+	if cache := audioCacheManager.Acquire(songId, quality); cache != nil {
+		return cache, false, nil
 	}
 
-	// 每 100ms 尝试一次打开 FLAC
-	for i := 0; i < 200; i++ { // 最多等待 20 秒
-		s.mutex.Lock()
-		if s.flacStreamingDec.TryOpen() {
-			sampleRate, channels, isReady, _ := s.flacStreamingDec.GetInfo()
-			if isReady {
-				s.sampleRate = sampleRate
-				s.channels = channels
-				s.isReady = true
-				s.mutex.Unlock()
-				return
+	if offlineForced() {
+		if cache := acquireOfflineAudio(songId); cache != nil {
+			return cache, true, nil
+		}
+		return nil, false, newError(ErrNetwork, "Song is not available offline")
+	}
+
+	songUrl, err := resolvePlayableSongURL(session, songId, quality)
+	if err != nil {
+		if markNetworkFailure(asBridgeError(err, ErrNetwork)) {
+			if cache := acquireOfflineAudio(songId); cache != nil {
+				return cache, true, nil
 			}
 		}
-		s.mutex.Unlock()
-		
-		// 检查是否下载完成
-		if s.cache != nil && s.cache.IsComplete() {
-			// 下载完成，直接使用可 Seek 解码器
-			return
+		return nil, false, err
+	}
+	markNetworkOK()
+
+	download.md5 = songUrl.MD5
+	cache, err = audioCacheManager.Create(songId, quality, songUrl.URL, songUrl.Type, download)
+	if err != nil {
+		return nil, false, fmt.Errorf("Failed to create audio cache: %w", err)
+	}
+	cache.SetSizeHint(songUrl.Size)
+	// 暂停很久或 Seek 时地址可能已经过期，由缓存用同一个会话重新获取
+	cache.SetURLRefresher(session, func(s *Session) (*SongURL, error) {
+		return resolvePlayableSongURL(s, songId, quality)
+	})
+	return cache, false, nil
+}
+
+// aacFallbackQualities 构建不包含 AAC 解码器时依次尝试的音质（无损一般是 flac，其余是 mp3）
+var aacFallbackQualities = []string{"lossless", "exhigh", "standard"}
+
+// resolvePlayableSongURL 获取当前构建能够解码的播放地址
+// 没有 AAC 解码器时，m4a 地址换成其他音质的 flac/mp3 地址，都没有时返回 ErrDecode
+func resolvePlayableSongURL(session *Session, songId int64, quality string) (*SongURL, error) {
+	songUrl, err := session.resolveSongURL(songId, quality)
+	if err != nil || aacDecodingAvailable || audioFormatFromType(songUrl.Type) != FormatAAC {
+		return songUrl, err
+	}
+
+	var lastErr error
+	for _, level := range aacFallbackQualities {
+		if level == quality {
+			continue
+		}
+		fallback, err := session.resolveSongURL(songId, level)
+		if err != nil {
+			lastErr = err
+			continue
 		}
-		
-		// 等待 100ms
-		time.Sleep(100 * time.Millisecond)
+		if audioFormatFromType(fallback.Type) != FormatAAC {
+			return fallback, nil
+		}
+	}
+	if lastErr != nil {
+		return nil, lastErr
 	}
+	return nil, newError(ErrDecode, "Only AAC (m4a) is available for this song and this build has no AAC decoder")
 }
 
 // onCacheComplete 缓存下载完成回调
@@ -205,64 +408,325 @@ func (s *PcmStream) onCacheComplete() {
 		return
 	}
 
+	s.emitEvent(StreamEvent{Type: EventCacheComplete, Progress: 100})
+
+	if err := s.openSeekableDecoder(); err != nil {
+		s.lastError = err.Error()
+		s.emitError(s.lastError)
+		return
+	}
+
+	// 如果有待定的 Seek，执行它
+	if s.pendingSeek >= 0 {
+		s.useSeekable = true
+		// 关闭流式解码器
+		s.closeStreamingDecoders()
+		// 执行 Seek
+		s.seekSeekable(s.pendingSeek)
+		s.pendingSeek = -1
+		s.isPaused = false
+		s.emitEvent(StreamEvent{Type: EventSeekCompleted, Position: s.currentPosition()})
+	}
+}
+
+// onCacheFailed 缓存下载失败回调（重试耗尽或不可恢复的错误）
+func (s *PcmStream) onCacheFailed(errMsg string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.cache == nil {
+		return
+	}
+
+	s.lastError = "Download failed: " + errMsg
+	s.emitError(s.lastError)
+
+	// 等待中的 Seek 永远不会完成，停止输出静音并报告错误
+	if s.pendingSeek >= 0 {
+		s.pendingSeek = -1
+		s.isPaused = false
+		s.isFailed = true
+	}
+}
+
+// onCacheRedownload 缓存校验失败、从头重新下载时的回调
+// 流式解码器可能已经读到损坏的数据，从当前位置重新创建（需要的数据由缓存优先下载）
+func (s *PcmStream) onCacheRedownload() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.cache == nil || s.useSeekable {
+		return
+	}
+
+	position := s.currentPosition()
+	if s.seekSource(position) == -1 {
+		s.emitError(s.lastError)
+		return
+	}
+	s.position = position
+	s.positionFloor = position
+	s.resetPlaybackEvents()
+	if s.events.ready {
+		s.events.ready = false
+		s.emitEvent(StreamEvent{Type: EventBuffering, Position: position})
+	}
+}
+
+// openSeekableDecoder 从完整的缓存文件创建可 Seek 解码器（调用方需持有锁）
+func (s *PcmStream) openSeekableDecoder() error {
 	// 根据格式创建可 Seek 解码器
 	if s.format == FormatFLAC {
 		// FLAC 可 Seek 解码器
 		seekable, err := NewFlacSeekableDecoder(s.cache.GetCachePath())
 		if err != nil {
-			s.lastError = "Failed to create FLAC seekable decoder: " + err.Error()
-			return
+			return fmt.Errorf("Failed to create FLAC seekable decoder: %w", err)
 		}
 
 		s.flacSeekableDec = seekable
-		
+
 		// 更新采样率和总帧数
 		sampleRate, channels, totalFrames := seekable.GetInfo()
 		s.sampleRate = sampleRate
 		s.channels = channels
 		s.totalFrames = totalFrames
-
-		// 如果有待定的 Seek，执行它
-		if s.pendingSeek >= 0 {
-			s.useSeekable = true
-			// 关闭流式解码器
-			if s.flacStreamingDec != nil {
-				s.flacStreamingDec.Close()
-			}
-			// 执行 Seek
-			s.flacSeekableDec.Seek(uint64(s.pendingSeek))
-			s.pendingSeek = -1
-			s.isPaused = false
-		}
 	} else {
 		// MP3 可 Seek 解码器
 		seekable, err := NewSeekableDecoder(s.cache.GetCachePath())
 		if err != nil {
-			s.lastError = "Failed to create seekable decoder: " + err.Error()
-			return
+			return fmt.Errorf("Failed to create seekable decoder: %w", err)
 		}
 
 		s.seekableDec = seekable
-		
+
 		// 更新采样率和总帧数
 		sampleRate, channels, totalFrames := seekable.GetInfo()
 		s.sampleRate = sampleRate
 		s.channels = channels
 		s.totalFrames = uint64(totalFrames)
 
-		// 如果有待定的 Seek，执行它
-		if s.pendingSeek >= 0 {
-			s.useSeekable = true
-			// 关闭流式解码器
-			if s.streamingDec != nil {
-				s.streamingDec.Close()
+		// 总帧数不含编码器延迟和填充
+		s.initGapless()
+		if s.trimmer != nil && s.trimmer.validFrames > 0 {
+			s.totalFrames = uint64(s.trimmer.validFrames)
+		}
+	}
+	return nil
+}
+
+// seekSeekable 在可 Seek 解码器上执行 Seek（调用方需持有锁）
+func (s *PcmStream) seekSeekable(frameIndex int64) error {
+	if s.format == FormatFLAC {
+		return s.flacSeekableDec.Seek(uint64(frameIndex))
+	}
+
+	s.initGapless()
+	s.gaplessChecked = true
+	if s.trimmer == nil {
+		return s.seekableDec.Seek(frameIndex)
+	}
+	if err := s.seekableDec.Seek(s.trimmer.decoderFrame(frameIndex)); err != nil {
+		return err
+	}
+	s.trimmer.seek(frameIndex)
+	return nil
+}
+
+// initGapless 解析 LAME 头并创建裁剪器（调用方需持有锁）
+// 文件头还没下载时不做任何事，下次调用时重试
+func (s *PcmStream) initGapless() {
+	if s.gaplessChecked || s.format != FormatMP3 {
+		return
+	}
+	if !s.loadHeaderInfo() {
+		return
+	}
+	s.gaplessChecked = true
+	s.trimmer = newGaplessTrimmer(s.mp3Info)
+}
+
+// sourceFormat 返回解码器输出的采样率和声道数，未知时为 0（调用方需持有锁）
+func (s *PcmStream) sourceFormat() (sampleRate, channels int) {
+	if s.format.usesPacketDecoder() {
+		if s.packetDec != nil {
+			sampleRate, channels, _, _, _ = s.packetDec.GetInfo()
+		}
+	} else if s.format == FormatFLAC {
+		if s.useSeekable && s.flacSeekableDec != nil {
+			sampleRate, channels, _ = s.flacSeekableDec.GetInfo()
+		} else if s.flacStreamingDec != nil {
+			sampleRate, channels, _, _ = s.flacStreamingDec.GetInfo()
+		}
+		if sampleRate == 0 && s.flacHeader != nil {
+			sampleRate, channels = s.flacHeader.sampleRate, s.flacHeader.channels
+		}
+	} else {
+		if s.useSeekable && s.seekableDec != nil {
+			sampleRate, channels, _ = s.seekableDec.GetInfo()
+		} else if s.streamingDec != nil {
+			sampleRate, channels, _, _ = s.streamingDec.GetInfo()
+		}
+		if sampleRate == 0 && s.mp3Info != nil {
+			sampleRate, channels = s.mp3Info.sampleRate, s.mp3Info.channels
+		}
+	}
+	return
+}
+
+// outputSampleRate 返回输出采样率，未知时为 0（调用方需持有锁）
+func (s *PcmStream) outputSampleRate() int {
+	if s.options.OutputSampleRate > 0 {
+		return s.options.OutputSampleRate
+	}
+	sampleRate, _ := s.sourceFormat()
+	return sampleRate
+}
+
+// toOutputFrames 把音源采样率下的帧数换算为输出采样率下的帧数（调用方需持有锁）
+func (s *PcmStream) toOutputFrames(frames uint64) uint64 {
+	sampleRate, _ := s.sourceFormat()
+	outRate := s.options.OutputSampleRate
+	if outRate <= 0 || sampleRate <= 0 || sampleRate == outRate {
+		return frames
+	}
+	return uint64(float64(frames) * float64(outRate) / float64(sampleRate))
+}
+
+// toSourceFrame 把输出采样率下的帧位置换算为音源采样率下的帧位置（调用方需持有锁）
+func (s *PcmStream) toSourceFrame(frame int64) int64 {
+	sampleRate, _ := s.sourceFormat()
+	outRate := s.options.OutputSampleRate
+	if outRate <= 0 || sampleRate <= 0 || sampleRate == outRate {
+		return frame
+	}
+	return int64(float64(frame) * float64(sampleRate) / float64(outRate))
+}
+
+// closeStreamingDecoders 关闭所有边下边播使用的解码器（调用方需持有锁）
+func (s *PcmStream) closeStreamingDecoders() {
+	if s.streamingDec != nil {
+		s.streamingDec.Close()
+	}
+	if s.flacStreamingDec != nil {
+		s.flacStreamingDec.Close()
+	}
+	if s.packetDec != nil {
+		s.packetDec.Close()
+	}
+}
+
+// loadHeaderInfo 从已下载的数据中解析文件头（调用方需持有锁）
+// 返回 true 表示可以在下载完成前 Seek
+func (s *PcmStream) loadHeaderInfo() bool {
+	if s.cache == nil || s.cache.GetExpectedSize() <= 0 {
+		return false
+	}
+
+	if s.format == FormatFLAC {
+		if s.flacHeader == nil {
+			header, err := parseFlacHeaderInfo(s.cache.ReadAvailableAt)
+			if err != nil {
+				return false
 			}
-			// 执行 Seek
-			s.seekableDec.Seek(s.pendingSeek)
-			s.pendingSeek = -1
-			s.isPaused = false
+			s.flacHeader = header
+		}
+	} else if s.format == FormatMP3 {
+		if s.mp3Info == nil {
+			info, err := parseMp3StreamInfo(s.cache.ReadAvailableAt)
+			if err != nil {
+				return false
+			}
+			s.mp3Info = info
 		}
 	}
+	return true
+}
+
+// estimateTotalFrames 可 Seek 解码器打开之前根据文件头估算总帧数（调用方需持有锁）
+// MP3 使用 Xing/Info/VBRI 头中的帧数，没有时按 CBR 码率和文件大小计算
+func (s *PcmStream) estimateTotalFrames() {
+	if s.format.usesPacketDecoder() {
+		// 容器中有准确的总长度
+		if s.packetDec != nil {
+			if _, _, totalFrames, _, _ := s.packetDec.GetInfo(); totalFrames > 0 {
+				s.totalFrames = totalFrames
+			}
+		}
+		return
+	}
+	if s.seekableDec != nil || s.flacSeekableDec != nil || !s.loadHeaderInfo() {
+		return
+	}
+
+	if s.format == FormatFLAC {
+		s.totalFrames = s.flacHeader.totalSamples
+		return
+	}
+
+	// 与输出一致：启用裁剪时不含编码器延迟和填充
+	trimmer := s.trimmer
+	if !s.gaplessChecked {
+		trimmer = newGaplessTrimmer(s.mp3Info)
+	}
+	if trimmer != nil && trimmer.validFrames > 0 {
+		s.totalFrames = uint64(trimmer.validFrames)
+		return
+	}
+	s.totalFrames = s.mp3Info.estimatedSamples(s.cache.GetExpectedSize())
+}
+
+// canSeek 是否可以 Seek（调用方需持有锁）
+func (s *PcmStream) canSeek() bool {
+	if s.format.usesPacketDecoder() {
+		return s.packetDec != nil
+	}
+	if s.format == FormatFLAC && s.flacSeekableDec != nil {
+		return true
+	}
+	if s.format == FormatMP3 && s.seekableDec != nil {
+		return true
+	}
+	return s.loadHeaderInfo()
+}
+
+// seekBeforeComplete 下载完成前 Seek：优先下载目标位置附近的数据并从那里开始解码（调用方需持有锁）
+// 返回 false 表示文件头还不可用，只能等待下载完成后再 Seek
+func (s *PcmStream) seekBeforeComplete(frameIndex int64) bool {
+	if !s.loadHeaderInfo() {
+		return false
+	}
+
+	if s.format == FormatFLAC {
+		decoder, err := NewFlacStreamingDecoder(s.cache, s.flacHeader, uint64(frameIndex), s.options.decodeBuffer(), s.options.headerOpenTimeout())
+		if err != nil {
+			return false
+		}
+		s.closeStreamingDecoders()
+		s.flacStreamingDec = decoder
+		s.sampleRate = s.flacHeader.sampleRate
+		s.channels = s.flacHeader.channels
+		return true
+	}
+
+	// MP3: 按 Xing/VBRI 目录或码率估算字节偏移，从该位置重新开始流式解码
+	s.initGapless()
+	s.gaplessChecked = true
+	decoderFrame := frameIndex
+	if s.trimmer != nil {
+		decoderFrame = s.trimmer.decoderFrame(frameIndex)
+	}
+	offset := s.mp3Info.byteOffsetForFrame(decoderFrame, s.cache.GetExpectedSize())
+	reader, err := s.cache.NewReaderAt(offset)
+	if err != nil {
+		return false
+	}
+	s.closeStreamingDecoders()
+	s.streamingDec = NewStreamingDecoder(reader, s.mp3Info, s.options.decodeBuffer(), s.options.headerOpenTimeout())
+	s.streamingDec.Start()
+	if s.trimmer != nil {
+		s.trimmer.seek(frameIndex)
+	}
+	return true
 }
 
 //export NeteaseGetPcmStreamInfo
@@ -274,13 +738,16 @@ func NeteaseGetPcmStreamInfo(streamIdC C.longlong) *C.char {
 	streamsMutex.Unlock()
 
 	if !exists {
-		lastError = "Stream not found"
+		setError(ErrNotFound, "Stream not found")
 		return nil
 	}
 
 	stream.mutex.Lock()
 	defer stream.mutex.Unlock()
 
+	// 下载完成前也尽早给出总长度
+	stream.estimateTotalFrames()
+
 	// 从当前使用的解码器获取信息
 	var sampleRate, channels int
 	var isReady bool
@@ -288,7 +755,14 @@ func NeteaseGetPcmStreamInfo(streamIdC C.longlong) *C.char {
 	var canSeek bool
 	var isEOF bool
 
-	if stream.format == FormatFLAC {
+	if stream.format.usesPacketDecoder() {
+		// AAC / Vorbis
+		if stream.packetDec != nil {
+			sampleRate, channels, _, isReady, errStr = stream.packetDec.GetInfo()
+			canSeek = true
+			isEOF = stream.packetDec.IsEOF()
+		}
+	} else if stream.format == FormatFLAC {
 		// FLAC 格式
 		if stream.useSeekable && stream.flacSeekableDec != nil {
 			sampleRate, channels, _ = stream.flacSeekableDec.GetInfo()
@@ -297,7 +771,7 @@ func NeteaseGetPcmStreamInfo(streamIdC C.longlong) *C.char {
 			isEOF = stream.flacSeekableDec.IsEOF()
 		} else if stream.flacStreamingDec != nil {
 			sampleRate, channels, isReady, errStr = stream.flacStreamingDec.GetInfo()
-			canSeek = false
+			canSeek = stream.canSeek()
 			isEOF = stream.flacStreamingDec.IsEOF()
 		}
 	} else {
@@ -309,27 +783,62 @@ func NeteaseGetPcmStreamInfo(streamIdC C.longlong) *C.char {
 			isEOF = stream.seekableDec.IsEOF()
 		} else if stream.streamingDec != nil {
 			sampleRate, channels, isReady, errStr = stream.streamingDec.GetInfo()
-			canSeek = false
+			canSeek = stream.canSeek()
 			isEOF = stream.streamingDec.IsEOF()
 		}
 	}
 
-	// 格式字符串
-	formatStr := "mp3"
-	if stream.format == FormatFLAC {
-		formatStr = "flac"
+	if stream.lastError != "" {
+		errStr = stream.lastError
+	}
+
+	if stream.options.OutputSampleRate > 0 && sampleRate > 0 {
+		sampleRate = stream.options.OutputSampleRate
 	}
+	sourceChannels := channels
+	channels = stream.outputChannels()
 
 	info := PcmStreamInfo{
 		StreamId:    stream.id,
+		SongId:      stream.songId,
 		SampleRate:  sampleRate,
 		Channels:    channels,
-		TotalFrames: stream.totalFrames,
-		IsReady:     isReady,
+		TotalFrames: stream.toOutputFrames(stream.totalFrames),
+		Position:    stream.currentPosition(),
+		IsReady:     isReady || stream.isFailed, // 失败时也视为就绪，避免 C# 端无限等待
 		CanSeek:     canSeek,
-		IsEOF:       isEOF || stream.isEOF, // 任一标记为 EOF 即为 EOF
-		Format:      formatStr,
+		IsEOF:       isEOF || stream.isEOF || (stream.trimmer != nil && stream.trimmer.isFinished()), // 任一标记为 EOF 即为 EOF
+		Format:      stream.format.String(),
 		Error:       errStr,
+
+		ChannelLayout:  channelLayoutName(channels),
+		SourceChannels: sourceChannels,
+
+		BufferState:     stream.buffering.state,
+		UnderrunCount:   stream.buffering.underruns,
+		BufferedSeconds: stream.bufferedSeconds(),
+
+		Offline: stream.offline,
+	}
+
+	if stream.loudnessGainSet {
+		info.LoudnessGainDb = stream.loudnessGainDb
+	}
+	if loudnessStore != nil {
+		if entry, ok := loudnessStore.Get(stream.songId); ok {
+			info.MeasuredLufs = entry.IntegratedLufs
+		}
+	}
+
+	if stream.cache != nil {
+		state, retries, downloadErr := stream.cache.GetState()
+		info.DownloadState = state.String()
+		info.DownloadRetries = retries
+		info.DownloadError = downloadErr
+
+		integrity, integrityErr := stream.cache.GetIntegrity()
+		info.Integrity = integrity.String()
+		info.IntegrityError = integrityErr
 	}
 
 	jsonBytes, _ := json.Marshal(info)
@@ -350,37 +859,220 @@ func NeteaseReadPcmFrames(streamIdC C.longlong, bufferPtr unsafe.Pointer, frames
 	}
 
 	stream.mutex.Lock()
-	defer stream.mutex.Unlock()
+	buffer := (*[1 << 30]float32)(bufferPtr)[:framesToRead*stream.outputChannels()]
+	result := stream.readFrames(buffer, framesToRead)
+	next := stream.next
+	stream.mutex.Unlock()
+
+	if result == -2 && next != nil {
+		// 当前歌曲结束，无缝切换到链接的下一首（句柄不变）
+		streamsMutex.Lock()
+		if activeStreams[streamId] == stream {
+			activeStreams[streamId] = next
+		}
+		streamsMutex.Unlock()
+
+		stream.mutex.Lock()
+		stream.next = nil
+		stream.close()
+		stream.mutex.Unlock()
+
+		next.mutex.Lock()
+		next.id = streamId
+		next.emitEvent(StreamEvent{Type: EventTrackChanged})
+		buffer = (*[1 << 30]float32)(bufferPtr)[:framesToRead*next.outputChannels()]
+		result = next.readFrames(buffer, framesToRead)
+		next.mutex.Unlock()
+	}
+
+	return C.int(result)
+}
+
+// readFrames 读取输出的 PCM 帧（调用方需持有锁）
+// 返回: 读取的帧数，0 = 暂无数据，-1 = 错误，-2 = EOF
+func (s *PcmStream) readFrames(buffer []float32, framesToRead int) int {
+	result := s.readOutputFrames(buffer, framesToRead)
+	s.trackReadResult(result)
+	return result
+}
+
+// readOutputFrames 读取 PCM 帧并应用响度标准化和 DSP（调用方需持有锁）
+func (s *PcmStream) readOutputFrames(buffer []float32, framesToRead int) int {
+	// 下载失败导致无法继续
+	if s.isFailed {
+		return -1
+	}
 
 	// 如果暂停中（等待延迟 Seek），返回静音
-	if stream.isPaused {
-		buffer := (*[1 << 30]float32)(bufferPtr)[:framesToRead*2]
+	if s.isPaused {
 		for i := range buffer {
 			buffer[i] = 0
 		}
-		return C.int(framesToRead) // 返回请求的帧数，但都是静音
+		return framesToRead // 返回请求的帧数，但都是静音
+	}
+
+	// 欠载后等待重新缓冲，避免断断续续地播放
+	if s.holdForRebuffer() {
+		return 0
+	}
+
+	n := s.readNormalizedFrames(buffer, framesToRead)
+	if n > 0 {
+		s.applyDsp(buffer, n)
+		s.position += int64(n)
+	}
+	return n
+}
+
+// currentPosition 返回当前播放位置（输出帧，调用方需持有锁）
+// 扣除响度限制器的延迟，保证与实际输出的音频对应
+func (s *PcmStream) currentPosition() int64 {
+	position := s.position
+	if s.loudness != nil {
+		position -= int64(s.loudness.limiter.delay)
+	}
+	if position < s.positionFloor {
+		position = s.positionFloor
+	}
+	return position
+}
+
+// readNormalizedFrames 读取响度标准化后的 PCM 帧（调用方需持有锁）
+func (s *PcmStream) readNormalizedFrames(buffer []float32, framesToRead int) int {
+	// 响度标准化作用在重采样后的输出上（采样率未知时解码器也还没有数据）
+	if s.options.loudnessEnabled() && loudnessStore != nil {
+		if rate := s.outputSampleRate(); rate > 0 {
+			outChannels := s.outputChannels()
+			if s.loudness == nil || s.loudness.sampleRate != rate || s.loudness.channels != outChannels {
+				s.loudness = newLoudnessStage(rate, outChannels)
+				if s.loudnessGainSet {
+					s.loudness.setGainDb(s.loudnessGainDb)
+				}
+			}
+			if !s.loudnessGainSet {
+				if gainDb, ok := loudnessStore.Gain(s.songId, s.options.Loudness, s.options.AlbumId, s.options.targetLufs()); ok {
+					s.loudnessGainDb = gainDb
+					s.loudnessGainSet = true
+					s.loudness.setGainDb(gainDb)
+				}
+			}
+			return s.loudness.process(buffer, framesToRead, s.readResampledFrames)
+		}
 	}
 
-	buffer := (*[1 << 30]float32)(bufferPtr)[:framesToRead*2]
+	return s.readResampledFrames(buffer, framesToRead)
+}
+
+// readResampledFrames 读取输出采样率的 PCM 帧（调用方需持有锁）
+func (s *PcmStream) readResampledFrames(buffer []float32, framesToRead int) int {
+	// 输出采样率与音源不同时重采样（源采样率未知时解码器也还没有数据）
+	outRate := s.options.OutputSampleRate
+	sampleRate, _ := s.sourceFormat()
+	if outRate <= 0 || sampleRate <= 0 || sampleRate == outRate {
+		return s.readMappedFrames(buffer, framesToRead)
+	}
+	outChannels := s.outputChannels()
+	if s.resampler == nil || s.resampler.inRate != sampleRate || s.resampler.channels != outChannels {
+		s.resampler = newPcmResampler(sampleRate, outRate, outChannels)
+	}
+	return s.resampler.process(buffer, framesToRead, s.readMappedFrames)
+}
+
+// outputChannels 返回输出声道数（调用方需持有锁）
+func (s *PcmStream) outputChannels() int {
+	if s.options.OutputChannels > 0 {
+		return s.options.OutputChannels
+	}
+	return 2
+}
+
+// readMappedFrames 读取音源采样率的 PCM 帧并转换为输出声道数（调用方需持有锁）
+func (s *PcmStream) readMappedFrames(buffer []float32, framesToRead int) int {
+	outChannels := s.outputChannels()
+	_, channels := s.sourceFormat()
+	if channels == outChannels {
+		return s.readSourceFrames(buffer, framesToRead)
+	}
+
+	// 解码器按音源声道数写入，先读到临时缓冲区
+	if need := framesToRead * maxSourceChannels; len(s.channelBuf) < need {
+		s.channelBuf = make([]float32, need)
+	}
+	n := s.readSourceFrames(s.channelBuf, framesToRead)
+	if n <= 0 {
+		return n
+	}
+	if channels <= 0 {
+		// 读取前解码器还未就绪，重新获取声道数
+		if _, channels = s.sourceFormat(); channels <= 0 {
+			return 0
+		}
+	}
+
+	if s.channelMapper == nil || s.channelMapper.in != channels || s.channelMapper.out != outChannels {
+		s.channelMapper = newChannelMapper(channels, outChannels)
+	}
+	s.channelMapper.process(buffer, s.channelBuf, n)
+	return n
+}
+
+// readSourceFrames 从当前使用的解码器读取音源采样率的 PCM 帧（调用方需持有锁）
+func (s *PcmStream) readSourceFrames(buffer []float32, framesToRead int) int {
+	s.estimateTotalFrames()
 
 	// 根据格式选择解码器
-	if stream.format == FormatFLAC {
-		// FLAC 格式
-		if stream.useSeekable && stream.flacSeekableDec != nil {
-			return C.int(stream.flacSeekableDec.ReadFrames(buffer, framesToRead))
-		} else if stream.flacStreamingDec != nil {
-			return C.int(stream.flacStreamingDec.Read(buffer, framesToRead))
+	if s.format.usesPacketDecoder() {
+		if s.packetDec != nil {
+			return s.packetDec.Read(buffer, framesToRead)
 		}
-	} else {
-		// MP3 格式
-		if stream.useSeekable && stream.seekableDec != nil {
-			return C.int(stream.seekableDec.ReadFrames(buffer, framesToRead))
-		} else if stream.streamingDec != nil {
-			return C.int(stream.streamingDec.ReadFrames(buffer, framesToRead))
+		return -1
+	}
+	if s.format == FormatFLAC {
+		// FLAC 格式
+		if s.useSeekable && s.flacSeekableDec != nil {
+			return s.flacSeekableDec.ReadFrames(buffer, framesToRead)
+		} else if s.flacStreamingDec != nil {
+			return s.flacStreamingDec.Read(buffer, framesToRead)
 		}
+		return -1
 	}
 
-	return -1
+	// MP3 格式
+	s.initGapless()
+	// 开头的延迟可能跨越多次读取，裁剪后为空时继续读
+	for i := 0; i < 8; i++ {
+		var n, channels int
+		if s.useSeekable && s.seekableDec != nil {
+			n = s.seekableDec.ReadFrames(buffer, framesToRead)
+			_, channels, _ = s.seekableDec.GetInfo()
+		} else if s.streamingDec != nil {
+			n = s.streamingDec.ReadFrames(buffer, framesToRead)
+			_, channels, _, _ = s.streamingDec.GetInfo()
+		} else {
+			return -1
+		}
+
+		if n > 0 {
+			// 已经开始输出，之后不再启用裁剪
+			s.gaplessChecked = true
+		}
+		if s.trimmer == nil || n < 0 {
+			return n
+		}
+		if s.trimmer.isFinished() {
+			return -2 // 剩下的都是填充
+		}
+		if n == 0 {
+			return 0
+		}
+		if kept := s.trimmer.trim(buffer, n, channels); kept > 0 {
+			return kept
+		}
+		if s.trimmer.isFinished() {
+			return -2
+		}
+	}
+	return 0
 }
 
 //export NeteaseSeekPcmStream
@@ -399,58 +1091,121 @@ func NeteaseSeekPcmStream(streamIdC C.longlong, frameIndexC C.longlong) C.int {
 	stream.mutex.Lock()
 	defer stream.mutex.Unlock()
 
-	// 根据格式检查是否有可 Seek 解码器
-	if stream.format == FormatFLAC {
-		if stream.flacSeekableDec == nil {
-			// 缓存还没下载完，设置延迟 Seek
-			stream.pendingSeek = frameIndex
-			stream.isPaused = true
-			return -3 // 延迟 Seek 已设置
-		}
+	return C.int(stream.seek(frameIndex))
+}
 
-		// 切换到可 Seek 解码器
-		if !stream.useSeekable {
-			stream.useSeekable = true
-			// 关闭流式解码器
-			if stream.flacStreamingDec != nil {
-				stream.flacStreamingDec.Close()
-			}
+// seek 跳转到指定帧（调用方需持有锁）
+// 返回: 0 = 成功, -1 = 失败, -3 = 已设置延迟 Seek
+func (s *PcmStream) seek(frameIndex int64) int {
+	// 位置在 Seek 失败时保持不变
+	outputFrame := frameIndex
+	result := s.seekSource(frameIndex)
+	if result != -1 {
+		s.position = outputFrame
+		s.positionFloor = outputFrame
+		s.resetPlaybackEvents()
+	}
+	switch result {
+	case 0:
+		s.emitEvent(StreamEvent{Type: EventSeekCompleted, Position: outputFrame})
+	case -3:
+		// 等待下载完成后执行
+		if s.events.ready {
+			s.events.ready = false
+			s.emitEvent(StreamEvent{Type: EventBuffering, Position: outputFrame})
 		}
+	}
+	return result
+}
 
-		// 执行 Seek
-		err := stream.flacSeekableDec.Seek(uint64(frameIndex))
+// seekSource 把解码器跳转到指定帧（调用方需持有锁）
+func (s *PcmStream) seekSource(frameIndex int64) int {
+	// frameIndex 为输出采样率下的位置
+	frameIndex = s.toSourceFrame(frameIndex)
+	if s.resampler != nil {
+		s.resampler.reset()
+	}
+	if s.loudness != nil {
+		s.loudness.reset()
+	}
+	if s.dsp != nil {
+		s.dsp.reset()
+	}
+
+	// AAC/Vorbis: 从目标位置重新创建解码器（需要的数据由缓存优先下载）
+	if s.format.usesPacketDecoder() {
+		if frameIndex < 0 {
+			frameIndex = 0
+		}
+		decoder, err := NewPacketDecoder(s.cache, s.format, uint64(frameIndex), s.options.decodeBuffer())
 		if err != nil {
-			stream.lastError = err.Error()
+			s.lastError = err.Error()
 			return -1
 		}
-	} else {
-		if stream.seekableDec == nil {
-			// 缓存还没下载完，设置延迟 Seek
-			stream.pendingSeek = frameIndex
-			stream.isPaused = true
-			return -3 // 延迟 Seek 已设置
+		if s.packetDec != nil {
+			s.packetDec.Close()
 		}
+		s.packetDec = decoder
+		s.pendingSeek = -1
+		s.isPaused = false
+		return 0
+	}
 
-		// 切换到可 Seek 解码器
-		if !stream.useSeekable {
-			stream.useSeekable = true
-			// 关闭流式解码器
-			if stream.streamingDec != nil {
-				stream.streamingDec.Close()
-			}
-		}
+	// 根据格式检查是否有可 Seek 解码器
+	hasSeekable := s.seekableDec != nil
+	if s.format == FormatFLAC {
+		hasSeekable = s.flacSeekableDec != nil
+	}
 
-		// 执行 Seek
-		err := stream.seekableDec.Seek(frameIndex)
-		if err != nil {
-			stream.lastError = err.Error()
-			return -1
+	if !hasSeekable {
+		// 缓存还没下载完，优先下载目标位置的数据
+		if s.seekBeforeComplete(frameIndex) {
+			s.pendingSeek = -1
+			s.isPaused = false
+			return 0
 		}
+		// 文件头还不可用，设置延迟 Seek
+		s.pendingSeek = frameIndex
+		s.isPaused = true
+		return -3 // 延迟 Seek 已设置
+	}
+
+	// 切换到可 Seek 解码器
+	if !s.useSeekable {
+		s.useSeekable = true
+		// 关闭流式解码器
+		s.closeStreamingDecoders()
+	}
+
+	// 执行 Seek
+	if err := s.seekSeekable(frameIndex); err != nil {
+		s.lastError = err.Error()
+		return -1
 	}
 
 	return 0 // 成功
 }
 
+//export NeteaseGetPcmStreamPosition
+// NeteaseGetPcmStreamPosition 获取当前播放位置
+// 返回: 输出采样率下的帧位置（与 NeteaseSeekPcmStream 的参数一致），-1 = 流不存在
+// 位置按 NeteaseReadPcmFrames 已返回的帧计算，切换解码器和 Seek 时保持连续
+func NeteaseGetPcmStreamPosition(streamIdC C.longlong) C.longlong {
+	streamsMutex.Lock()
+	stream, exists := activeStreams[int64(streamIdC)]
+	streamsMutex.Unlock()
+
+	if !exists {
+		setError(ErrNotFound, "Stream not found")
+		return -1
+	}
+
+	stream.mutex.Lock()
+	defer stream.mutex.Unlock()
+
+	return C.longlong(stream.currentPosition())
+}
+
 //export NeteaseCanSeekPcmStream
 func NeteaseCanSeekPcmStream(streamIdC C.longlong) C.int {
 	streamId := int64(streamIdC)
@@ -466,14 +1221,8 @@ func NeteaseCanSeekPcmStream(streamIdC C.longlong) C.int {
 	stream.mutex.Lock()
 	defer stream.mutex.Unlock()
 
-	if stream.format == FormatFLAC {
-		if stream.flacSeekableDec != nil {
-			return 1 // 可以 Seek
-		}
-	} else {
-		if stream.seekableDec != nil {
-			return 1 // 可以 Seek
-		}
+	if stream.canSeek() {
+		return 1 // 可以 Seek（下载完成前通过区间下载实现）
 	}
 	return 0 // 不能 Seek
 }
@@ -496,26 +1245,81 @@ func NeteaseClosePcmStream(streamIdC C.longlong) {
 	stream.mutex.Lock()
 	defer stream.mutex.Unlock()
 
-	// MP3 解码器
-	if stream.streamingDec != nil {
-		stream.streamingDec.Close()
+	stream.close()
+}
+
+// close 关闭所有解码器并释放缓存，链接的下一个流也会被关闭（调用方需持有锁）
+func (s *PcmStream) close() {
+	s.stopEventWatcher()
+
+	// MP3 / FLAC 流式解码器
+	s.closeStreamingDecoders()
+
+	// 可 Seek 解码器
+	if s.seekableDec != nil {
+		s.seekableDec.Close()
 	}
-	if stream.seekableDec != nil {
-		stream.seekableDec.Close()
+	if s.flacSeekableDec != nil {
+		s.flacSeekableDec.Close()
 	}
-	
-	// FLAC 解码器
-	if stream.flacStreamingDec != nil {
-		stream.flacStreamingDec.Close()
+
+	// 缓存（置空后下载完成回调不再创建解码器）
+	if s.cache != nil {
+		s.cache.Close()
+		s.cache = nil
 	}
-	if stream.flacSeekableDec != nil {
-		stream.flacSeekableDec.Close()
+
+	if s.next != nil {
+		next := s.next
+		s.next = nil
+		next.mutex.Lock()
+		next.close()
+		next.mutex.Unlock()
 	}
-	
-	// 缓存
-	if stream.cache != nil {
-		stream.cache.Close()
+}
+
+//export NeteaseChainPcmStream
+// NeteaseChainPcmStream 把 nextStreamId 链接到 streamId 之后，当前流结束时无缝切换到下一个流
+// 切换后继续通过 streamId 读取（PcmStreamInfo.songId 随之变化），nextStreamId 句柄由当前流接管，不要再单独使用
+// nextStreamId <= 0 表示取消链接并关闭已链接的流
+// 返回: 0 = 成功, -1 = 流不存在
+func NeteaseChainPcmStream(streamIdC C.longlong, nextStreamIdC C.longlong) C.int {
+	streamId := int64(streamIdC)
+	nextStreamId := int64(nextStreamIdC)
+
+	if streamId == nextStreamId {
+		setError(ErrInvalidArgument, "Cannot chain a stream to itself")
+		return -1
 	}
+
+	streamsMutex.Lock()
+	stream, exists := activeStreams[streamId]
+	var next *PcmStream
+	if exists && nextStreamId > 0 {
+		next, exists = activeStreams[nextStreamId]
+		if exists {
+			delete(activeStreams, nextStreamId)
+		}
+	}
+	streamsMutex.Unlock()
+
+	if !exists {
+		setError(ErrNotFound, "Stream not found")
+		return -1
+	}
+
+	stream.mutex.Lock()
+	previous := stream.next
+	stream.next = next
+	stream.mutex.Unlock()
+
+	// 替换掉的流不再有句柄，直接关闭
+	if previous != nil {
+		previous.mutex.Lock()
+		previous.close()
+		previous.mutex.Unlock()
+	}
+	return 0
 }
 
 //export NeteaseIsPcmStreamReady
@@ -533,31 +1337,46 @@ func NeteaseIsPcmStreamReady(streamIdC C.longlong) C.int {
 	stream.mutex.Lock()
 	defer stream.mutex.Unlock()
 
-	if stream.format == FormatFLAC {
+	if stream.decoderReady() {
+		return 1
+	}
+	return 0
+}
+
+// decoderReady 当前使用的解码器是否已准备好（调用方需持有锁）
+func (s *PcmStream) decoderReady() bool {
+	if s.format.usesPacketDecoder() {
+		if s.packetDec != nil {
+			_, _, _, isReady, _ := s.packetDec.GetInfo()
+			if isReady {
+				return true
+			}
+		}
+	} else if s.format == FormatFLAC {
 		// FLAC 格式
-		if stream.useSeekable && stream.flacSeekableDec != nil {
-			if stream.flacSeekableDec.IsReady() {
-				return 1
+		if s.useSeekable && s.flacSeekableDec != nil {
+			if s.flacSeekableDec.IsReady() {
+				return true
 			}
-		} else if stream.flacStreamingDec != nil {
-			_, _, isReady, _ := stream.flacStreamingDec.GetInfo()
+		} else if s.flacStreamingDec != nil {
+			_, _, isReady, _ := s.flacStreamingDec.GetInfo()
 			if isReady {
-				return 1
+				return true
 			}
 		}
 	} else {
 		// MP3 格式
-		if stream.useSeekable && stream.seekableDec != nil {
-			if stream.seekableDec.IsReady() {
-				return 1
+		if s.useSeekable && s.seekableDec != nil {
+			if s.seekableDec.IsReady() {
+				return true
 			}
-		} else if stream.streamingDec != nil {
-			if stream.streamingDec.IsReady() {
-				return 1
+		} else if s.streamingDec != nil {
+			if s.streamingDec.IsReady() {
+				return true
 			}
 		}
 	}
-	return 0
+	return false
 }
 
 //export NeteaseGetPcmStreamError
@@ -579,7 +1398,20 @@ func NeteaseGetPcmStreamError(streamIdC C.longlong) *C.char {
 		return C.CString(stream.lastError)
 	}
 
-	if stream.format == FormatFLAC {
+	if stream.cache != nil {
+		if state, _, downloadErr := stream.cache.GetState(); state == DownloadFailed {
+			return C.CString("Download failed: " + downloadErr)
+		}
+	}
+
+	if stream.format.usesPacketDecoder() {
+		if stream.packetDec != nil {
+			_, _, _, _, err := stream.packetDec.GetInfo()
+			if err != "" {
+				return C.CString(err)
+			}
+		}
+	} else if stream.format == FormatFLAC {
 		if stream.flacStreamingDec != nil {
 			_, _, _, err := stream.flacStreamingDec.GetInfo()
 			if err != "" {
@@ -649,7 +1481,10 @@ func NeteaseGetPendingSeekFrame(streamIdC C.longlong) C.longlong {
 	stream.mutex.Lock()
 	defer stream.mutex.Unlock()
 
-	return C.longlong(stream.pendingSeek)
+	if stream.pendingSeek < 0 {
+		return -1
+	}
+	return C.longlong(stream.toOutputFrames(uint64(stream.pendingSeek)))
 }
 
 //export NeteaseCancelPendingSeek
@@ -4,7 +4,6 @@ import (
 	"context"
 	"errors"
 	"io"
-	"net/http"
 	"sync"
 	"time"
 
@@ -12,28 +11,38 @@ import (
 )
 
 // StreamingDecoder 使用 minimp3 的流式解码器（边下边播）
+// 数据来自正在下载的缓存文件，与缓存共用同一个下载
 type StreamingDecoder struct {
-	url        string
+	reader     io.ReadSeekCloser
+	info       *mp3StreamInfo // 文件头信息（为 nil 时由解码协程从缓存读取）
+	openWait   time.Duration  // 等待文件头下载的最长时间
 	decoder    *minimp3.Decoder
-	httpResp   *http.Response
 	ctx        context.Context
 	cancel     context.CancelFunc
 	mutex      sync.Mutex
-	buffer     []byte // 已解码的 PCM 数据
+	ring       *pcmRingBuffer // 已解码的 PCM 数据（知道采样率后创建）
+	bufferCfg  decodeBufferConfig
 	sampleRate int
 	channels   int
 	isReady    bool
 	isEOF      bool
+	isClosed   bool
 	lastError  string
 }
 
 // NewStreamingDecoder 创建流式解码器
-func NewStreamingDecoder(url string) *StreamingDecoder {
+// reader 通常是 AudioCache.NewReaderAt() 返回的缓存读取器，解码器关闭时会一并关闭
+// info 为 nil 时 reader 必须从文件开头读取，由解码协程先读取文件头（最多等待 openTimeout）
+// bufferCfg: 缓冲区容量和预缓冲时长
+func NewStreamingDecoder(reader io.ReadSeekCloser, info *mp3StreamInfo, bufferCfg decodeBufferConfig, openTimeout time.Duration) *StreamingDecoder {
 	ctx, cancel := context.WithCancel(context.Background())
 	return &StreamingDecoder{
-		url:    url,
-		ctx:    ctx,
-		cancel: cancel,
+		reader:    reader,
+		info:      info,
+		openWait:  openTimeout,
+		ctx:       ctx,
+		cancel:    cancel,
+		bufferCfg: bufferCfg,
 	}
 }
 
@@ -43,51 +52,41 @@ func (d *StreamingDecoder) Start() {
 }
 
 func (d *StreamingDecoder) startDecoding() {
-	req, err := http.NewRequestWithContext(d.ctx, "GET", d.url, nil)
-	if err != nil {
-		d.setError("Failed to create request: " + err.Error())
-		return
-	}
-
-	req.Header.Set("User-Agent", "Mozilla/5.0")
-
-	transport := &http.Transport{
-		ResponseHeaderTimeout: 30 * time.Second,
-		IdleConnTimeout:       90 * time.Second,
-	}
-	client := &http.Client{Transport: transport}
-
-	resp, err := client.Do(req)
-	if err != nil {
-		d.setError("Failed to fetch audio: " + err.Error())
-		return
+	// 采样率和声道数取自文件头（minimp3 解码协程写入的字段不能在这里读取）
+	info := d.info
+	if info == nil {
+		// 超时后关闭读取器，让等待下载的读取立即返回
+		timer := time.AfterFunc(d.openWait, func() { d.reader.Close() })
+		header, err := parseMp3StreamInfo(d.readAt)
+		if !timer.Stop() {
+			d.setError("Timed out waiting for MP3 header")
+			return
+		}
+		if err == nil {
+			_, err = d.reader.Seek(0, io.SeekStart)
+		}
+		if err != nil {
+			d.setError("Failed to read MP3 header: " + err.Error())
+			d.reader.Close()
+			return
+		}
+		info = header
 	}
-	d.httpResp = resp
 
-	decoder, err := minimp3.NewDecoder(resp.Body)
+	decoder, err := minimp3.NewDecoder(d.reader)
 	if err != nil {
 		d.setError("Failed to create decoder: " + err.Error())
-		resp.Body.Close()
+		d.reader.Close()
 		return
 	}
 	d.decoder = decoder
 
-	// 等待解码器准备好
-	for i := 0; i < 100; i++ {
-		if decoder.SampleRate > 0 {
-			break
-		}
-		time.Sleep(10 * time.Millisecond)
-	}
-
 	d.mutex.Lock()
-	d.sampleRate = decoder.SampleRate
-	d.channels = decoder.Channels
-	if d.sampleRate == 0 {
-		d.sampleRate = 44100
-	}
-	if d.channels == 0 {
-		d.channels = 2
+	d.sampleRate = info.sampleRate
+	d.channels = info.channels
+	d.ring = newPcmRingBuffer(d.sampleRate, d.channels, d.bufferCfg.seconds)
+	if d.isClosed {
+		d.ring.Close()
 	}
 	// 先不设置 isReady，等有数据后再设置
 	d.mutex.Unlock()
@@ -97,15 +96,22 @@ func (d *StreamingDecoder) startDecoding() {
 
 func (d *StreamingDecoder) decodeLoop() {
 	defer func() {
-		if d.httpResp != nil {
-			d.httpResp.Body.Close()
-		}
+		d.reader.Close()
 		if d.decoder != nil {
 			d.decoder.Close()
 		}
 	}()
 
+	d.mutex.Lock()
+	ring := d.ring
+	// 当缓冲区有足够数据时才设置 isReady，这样 C# 端 WaitForReady 会等待到有实际数据
+	// 至少需要预缓冲时长的数据（缓冲区更小时为缓冲区满）
+	readyTarget := ring.readyTarget(d.sampleRate, d.channels, d.bufferCfg.prebufferSeconds)
+	d.mutex.Unlock()
+
 	buffer := make([]byte, 4096)
+	samples := make([]float32, len(buffer)/2)
+	ready := false
 	for {
 		select {
 		case <-d.ctx.Done():
@@ -115,15 +121,22 @@ func (d *StreamingDecoder) decodeLoop() {
 
 		n, err := d.decoder.Read(buffer)
 		if n > 0 {
-			d.mutex.Lock()
-			d.buffer = append(d.buffer, buffer[:n]...)
-			// 当缓冲区有足够数据时才设置 isReady
-			// 这样 C# 端 WaitForReady 会等待到有实际数据
-			// 至少需要 0.5 秒的数据（44100 * 2ch * 2bytes * 0.5s = 88200 bytes）
-			if !d.isReady && len(d.buffer) >= 88200 {
+			count := n / 2
+			for i := 0; i < count; i++ {
+				sample := int16(buffer[i*2]) | int16(buffer[i*2+1])<<8
+				samples[i] = float32(sample) / 32768.0
+			}
+			// 缓冲区满时在这里等待读取方腾出空间，关闭后返回 false
+			if !ring.Write(samples[:count]) {
+				return
+			}
+
+			if !ready && ring.Len() >= readyTarget {
+				ready = true
+				d.mutex.Lock()
 				d.isReady = true
+				d.mutex.Unlock()
 			}
-			d.mutex.Unlock()
 		}
 
 		if err != nil {
@@ -141,15 +154,16 @@ func (d *StreamingDecoder) decodeLoop() {
 			d.mutex.Unlock()
 			return
 		}
+	}
+}
 
-		// 控制缓冲区大小
-		d.mutex.Lock()
-		bufLen := len(d.buffer)
-		d.mutex.Unlock()
-		if bufLen > 1024*1024 {
-			time.Sleep(10 * time.Millisecond)
-		}
+// readAt 读取文件中指定位置的数据（未下载时等待）
+func (d *StreamingDecoder) readAt(p []byte, off int64) bool {
+	if _, err := d.reader.Seek(off, io.SeekStart); err != nil {
+		return false
 	}
+	_, err := io.ReadFull(d.reader, p)
+	return err == nil
 }
 
 func (d *StreamingDecoder) setError(msg string) {
@@ -165,39 +179,29 @@ func (d *StreamingDecoder) ReadFrames(buffer []float32, framesToRead int) int {
 	d.mutex.Lock()
 	defer d.mutex.Unlock()
 
-	if !d.isReady {
+	if !d.isReady || d.ring == nil {
 		return 0
 	}
 
-	bytesPerFrame := d.channels * 2 // int16
-	bytesNeeded := framesToRead * bytesPerFrame
+	samplesNeeded := framesToRead * d.channels
+	available := d.ring.Len()
 
-	if len(d.buffer) < bytesNeeded {
-		if d.isEOF {
-			bytesNeeded = len(d.buffer)
-			framesToRead = bytesNeeded / bytesPerFrame
-		} else {
-			return 0
-		}
+	// 数据不足一次读取时等待更多数据（缓冲区已满或解码结束时有多少读多少）
+	if available < samplesNeeded && !d.isEOF && available < d.ring.Cap() {
+		return 0
+	}
+	if samplesNeeded > available {
+		samplesNeeded = available / d.channels * d.channels
 	}
 
-	if framesToRead == 0 {
+	if samplesNeeded == 0 {
 		if d.isEOF {
 			return -2 // EOF
 		}
 		return 0
 	}
 
-	// 读取并转换
-	srcData := d.buffer[:bytesNeeded]
-	d.buffer = d.buffer[bytesNeeded:]
-
-	for i := 0; i < framesToRead*d.channels; i++ {
-		sample := int16(srcData[i*2]) | int16(srcData[i*2+1])<<8
-		buffer[i] = float32(sample) / 32768.0
-	}
-
-	return framesToRead
+	return d.ring.Read(buffer[:samplesNeeded]) / d.channels
 }
 
 // GetInfo 获取解码器信息
@@ -207,6 +211,16 @@ func (d *StreamingDecoder) GetInfo() (sampleRate, channels int, isReady bool, er
 	return d.sampleRate, d.channels, d.isReady, d.lastError
 }
 
+// Buffered 获取已缓冲的帧数、缓冲区容量（帧）和是否已解码到结尾
+func (d *StreamingDecoder) Buffered() (frames, capacity int, finished bool) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.ring != nil && d.channels > 0 {
+		frames, capacity = d.ring.Len()/d.channels, d.ring.Cap()/d.channels
+	}
+	return frames, capacity, d.isEOF
+}
+
 // IsReady 是否准备好
 func (d *StreamingDecoder) IsReady() bool {
 	d.mutex.Lock()
@@ -224,4 +238,16 @@ func (d *StreamingDecoder) IsEOF() bool {
 // Close 关闭解码器
 func (d *StreamingDecoder) Close() {
 	d.cancel()
+
+	// 唤醒等待缓冲区空间的解码协程
+	d.mutex.Lock()
+	d.isClosed = true
+	ring := d.ring
+	d.mutex.Unlock()
+	if ring != nil {
+		ring.Close()
+	}
+
+	// 关闭读取器，唤醒正在等待缓存数据的解码协程
+	d.reader.Close()
 }
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// blockingReader 一直没有数据，关闭后读取立即返回（模拟下载停滞的缓存读取器）
+type blockingReader struct {
+	closed chan struct{}
+}
+
+func (r *blockingReader) Read(p []byte) (int, error) {
+	<-r.closed
+	return 0, io.ErrClosedPipe
+}
+
+func (r *blockingReader) Seek(offset int64, whence int) (int64, error) { return offset, nil }
+
+func (r *blockingReader) Close() error {
+	select {
+	case <-r.closed:
+	default:
+		close(r.closed)
+	}
+	return nil
+}
+
+type nopSeekCloser struct{ *bytes.Reader }
+
+func (nopSeekCloser) Close() error { return nil }
+
+// waitDecoderInfo 等待解码器得到采样率或出错
+func waitDecoderInfo(t *testing.T, d *StreamingDecoder) (sampleRate, channels int, errStr string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		sampleRate, channels, _, errStr = d.GetInfo()
+		if sampleRate > 0 || errStr != "" {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("decoder did not report its format or an error")
+	return
+}
+
+func TestStreamingDecoderFormatFromHeader(t *testing.T) {
+	// MPEG-2 Layer III 64kbps 22050Hz 单声道，每帧 208 字节
+	header := []byte{0xFF, 0xF3, 0x80, 0xC4}
+	var data []byte
+	for i := 0; i < 20; i++ {
+		frame := make([]byte, 208)
+		copy(frame, header)
+		data = append(data, frame...)
+	}
+
+	d := NewStreamingDecoder(nopSeekCloser{bytes.NewReader(data)}, nil, decodeBufferConfig{seconds: 1}, time.Second)
+	d.Start()
+	defer d.Close()
+
+	sampleRate, channels, errStr := waitDecoderInfo(t, d)
+	if errStr != "" {
+		t.Fatalf("decoder error: %s", errStr)
+	}
+	if sampleRate != 22050 || channels != 1 {
+		t.Fatalf("format = %d Hz, %d channels, want 22050 Hz, 1 channel", sampleRate, channels)
+	}
+}
+
+func TestStreamingDecoderKnownHeader(t *testing.T) {
+	// Seek 时传入已解析的文件头，读取器不需要从文件开头开始
+	info := &mp3StreamInfo{sampleRate: 48000, channels: 2}
+	reader := &blockingReader{closed: make(chan struct{})}
+	d := NewStreamingDecoder(reader, info, decodeBufferConfig{seconds: 1}, time.Second)
+	d.Start()
+	defer d.Close()
+
+	sampleRate, channels, errStr := waitDecoderInfo(t, d)
+	if errStr != "" || sampleRate != 48000 || channels != 2 {
+		t.Fatalf("GetInfo() = %d, %d, %q, want 48000, 2, no error", sampleRate, channels, errStr)
+	}
+}
+
+func TestStreamingDecoderHeaderTimeout(t *testing.T) {
+	reader := &blockingReader{closed: make(chan struct{})}
+	d := NewStreamingDecoder(reader, nil, decodeBufferConfig{seconds: 1}, 50*time.Millisecond)
+	d.Start()
+	defer d.Close()
+
+	sampleRate, _, errStr := waitDecoderInfo(t, d)
+	if !strings.Contains(errStr, "Timed out") {
+		t.Fatalf("error = %q, want a timeout", errStr)
+	}
+	if sampleRate != 0 {
+		t.Fatalf("sampleRate = %d after timeout, want 0 (no guessed format)", sampleRate)
+	}
+	if !d.IsEOF() {
+		t.Fatal("decoder not finished after header timeout")
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"io"
+
+	"github.com/jfreymuth/oggvorbis"
+)
+
+// vorbisChunkFrames 每次解码的帧数
+const vorbisChunkFrames = 4096
+
+// vorbisSource Ogg Vorbis 音源
+type vorbisSource struct {
+	reader *oggvorbis.Reader
+	buffer []float32
+}
+
+func openVorbisSource(reader io.ReadSeeker) (packetSource, error) {
+	r, err := oggvorbis.NewReader(reader)
+	if err != nil {
+		return nil, err
+	}
+	return &vorbisSource{
+		reader: r,
+		buffer: make([]float32, vorbisChunkFrames*r.Channels()),
+	}, nil
+}
+
+func (s *vorbisSource) info() (sampleRate, channels int, totalFrames uint64) {
+	sampleRate, channels = s.reader.SampleRate(), s.reader.Channels()
+	if length := s.reader.Length(); length > 0 {
+		totalFrames = uint64(length)
+	}
+	return
+}
+
+// seek Vorbis 可以精确定位到样本（库内部按页二分查找）
+func (s *vorbisSource) seek(frame uint64) (int64, error) {
+	if frame == 0 && s.reader.Position() == 0 {
+		return 0, nil
+	}
+	if err := s.reader.SetPosition(int64(frame)); err != nil {
+		return 0, err
+	}
+	return s.reader.Position(), nil
+}
+
+func (s *vorbisSource) decode() ([]float32, error) {
+	n, err := s.reader.Read(s.buffer)
+	if n > 0 {
+		// 返回副本，buffer 会被下一次解码覆盖
+		samples := make([]float32, n)
+		copy(samples, s.buffer[:n])
+		return samples, nil
+	}
+	if err == nil {
+		return nil, nil
+	}
+	return nil, err
+}
+
+func (s *vorbisSource) close() {}
@@ -0,0 +1,283 @@
+package main
+
+/*
+#include <stdlib.h>
+*/
+import "C"
+import (
+	"encoding/json"
+	"net/http"
+	stdcookiejar "net/http/cookiejar"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/go-musicfox/go-musicfox/internal/storage"
+	"github.com/go-musicfox/go-musicfox/internal/structs"
+	"github.com/go-musicfox/netease-music/service"
+	"github.com/go-musicfox/netease-music/util"
+	"github.com/telanflow/cookiejar"
+)
+
+// Session 一个独立的登录会话：Cookie、用户信息、二维码登录状态和创建的流
+// NeteaseInit 创建默认会话（句柄 0），NeteaseCreateSession 可以再创建其他会话（例如访客）
+type Session struct {
+	id        int64
+	dataDir   string // Cookie 和用户信息的保存目录，空字符串表示不保存（访客）
+	isDefault bool
+	jar       http.CookieJar
+
+	mutex   sync.Mutex // 保护 user、qrState 和 closed
+	user    *structs.User
+	qrState *QRLoginState
+	closed  bool // 已销毁（仍持有会话的下载、预取等不能再使用它的 Cookie）
+}
+
+var (
+	sessionsMutex  sync.Mutex
+	activeSessions          = make(map[int64]*Session)
+	nextSessionId  int64    = 1
+	defaultSession *Session // 不带会话句柄的导出函数使用
+
+	// 接口库只有一个全局 Cookie 容器，请求前切换到会话的 Cookie，因此不同会话的请求依次进行
+	apiMutex sync.Mutex
+)
+
+// newSession 创建会话并加载保存的 Cookie 和用户信息
+func newSession(dataDir string, isDefault bool) (*Session, error) {
+	s := &Session{dataDir: dataDir, isDefault: isDefault}
+
+	if dataDir != "" {
+		if err := os.MkdirAll(dataDir, 0755); err != nil {
+			return nil, newError(ErrIO, "Failed to create data directory: "+err.Error())
+		}
+		jar, err := cookiejar.NewFileJar(filepath.Join(dataDir, "cookie"), nil)
+		if err != nil {
+			return nil, newError(ErrIO, "Failed to load cookie jar: "+err.Error())
+		}
+		s.jar = jar
+	} else {
+		jar, err := stdcookiejar.New(nil)
+		if err != nil {
+			return nil, newError(ErrInternal, "Failed to create cookie jar: "+err.Error())
+		}
+		s.jar = jar
+	}
+
+	s.user = s.loadUser()
+
+	sessionsMutex.Lock()
+	s.id = nextSessionId
+	nextSessionId++
+	activeSessions[s.id] = s
+	if isDefault {
+		defaultSession = s
+	}
+	sessionsMutex.Unlock()
+	return s, nil
+}
+
+// getDefaultSession 获取默认会话，未初始化时返回 nil
+func getDefaultSession() *Session {
+	sessionsMutex.Lock()
+	defer sessionsMutex.Unlock()
+	return defaultSession
+}
+
+// getSession 根据句柄获取会话（0 为默认会话），不存在时记录错误并返回 nil
+func getSession(handle int64) *Session {
+	sessionsMutex.Lock()
+	defer sessionsMutex.Unlock()
+
+	if handle == 0 {
+		if defaultSession == nil {
+			setError(ErrNotInitialized, "Not initialized")
+		}
+		return defaultSession
+	}
+	s, exists := activeSessions[handle]
+	if !exists {
+		setError(ErrNotFound, "Session not found")
+		return nil
+	}
+	return s
+}
+
+// lockApi 切换到本会话的 Cookie 并锁定接口调用，返回解锁函数
+// 会话已销毁时使用空的 Cookie 容器，不再发送它的 Cookie
+func (s *Session) lockApi() func() {
+	apiMutex.Lock()
+	if s.isClosed() {
+		jar, _ := stdcookiejar.New(nil)
+		util.SetGlobalCookieJar(jar)
+	} else {
+		util.SetGlobalCookieJar(s.jar)
+	}
+	return apiMutex.Unlock
+}
+
+// isClosed 会话是否已销毁
+func (s *Session) isClosed() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.closed
+}
+
+// currentUser 获取登录的用户，未登录时返回 nil
+func (s *Session) currentUser() *structs.User {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.user == nil || s.user.UserId == 0 {
+		return nil
+	}
+	return s.user
+}
+
+// setUser 更新登录的用户并保存
+func (s *Session) setUser(user structs.User) {
+	s.mutex.Lock()
+	s.user = &user
+	s.mutex.Unlock()
+	s.saveUser(user)
+}
+
+// loadUser 加载保存的用户信息（默认会话使用 go-musicfox 的数据库，其他会话保存在 dataDir 中）
+func (s *Session) loadUser() *structs.User {
+	var data []byte
+	if s.isDefault {
+		table := storage.NewTable()
+		jsonStr, err := table.GetByKVModel(storage.User{})
+		if err != nil {
+			return nil
+		}
+		data = jsonStr
+	} else if s.dataDir != "" {
+		fileData, err := os.ReadFile(filepath.Join(s.dataDir, "user.json"))
+		if err != nil {
+			return nil
+		}
+		data = fileData
+	} else {
+		return nil
+	}
+
+	user, err := structs.NewUserFromLocalJson(data)
+	if err != nil {
+		return nil
+	}
+	return &user
+}
+
+// saveUser 保存用户信息（访客会话不保存）
+func (s *Session) saveUser(user structs.User) {
+	if s.isDefault {
+		table := storage.NewTable()
+		_ = table.SetByKVModel(storage.User{}, user)
+		return
+	}
+	if s.dataDir == "" {
+		return
+	}
+	if data, err := json.Marshal(user); err == nil {
+		_ = os.WriteFile(filepath.Join(s.dataDir, "user.json"), data, 0644)
+	}
+}
+
+// refreshLogin 刷新登录状态并重新获取用户信息（调用方需持有 lockApi）
+func (s *Session) refreshLogin() error {
+	refreshService := service.LoginRefreshService{}
+	refreshService.LoginRefresh()
+
+	code, resp := (&service.UserAccountService{}).AccountInfo()
+	if code != 200 {
+		return newApiError(code, "Failed to get account info, code: "+strconv.FormatFloat(code, 'f', 0, 64))
+	}
+
+	user, err := structs.NewUserFromJsonForLogin(resp)
+	if err != nil {
+		return newError(ErrApi, "Failed to parse user info: "+err.Error())
+	}
+	s.setUser(user)
+	return nil
+}
+
+// clearQRState 登录结束后清除二维码状态（期间重新获取了二维码时保留新的状态）
+func (s *Session) clearQRState(state *QRLoginState) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.qrState == state {
+		s.qrState = nil
+	}
+}
+
+// closeStreams 关闭本会话创建的流（已交给混音器的流由混音器负责关闭）
+func (s *Session) closeStreams() {
+	streamsMutex.Lock()
+	var streams []*PcmStream
+	for id, stream := range activeStreams {
+		if stream.session == s {
+			streams = append(streams, stream)
+			delete(activeStreams, id)
+		}
+	}
+	streamsMutex.Unlock()
+
+	for _, stream := range streams {
+		closeStream(stream)
+	}
+}
+
+//export NeteaseCreateSession
+// NeteaseCreateSession 创建独立的会话（需要先调用 NeteaseInit）
+// dataDir: 保存 Cookie 和用户信息的目录，空字符串创建不保存任何数据的访客会话
+// 返回: 会话句柄，-1 = 失败
+func NeteaseCreateSession(dataDirC *C.char) C.longlong {
+	if getSession(0) == nil {
+		return -1
+	}
+
+	s, err := newSession(C.GoString(dataDirC), false)
+	if err != nil {
+		setErrorFrom(err, ErrIO)
+		return -1
+	}
+	return C.longlong(s.id)
+}
+
+//export NeteaseDestroySession
+// NeteaseDestroySession 销毁会话并关闭它创建的流（默认会话不能销毁）
+// 返回: 0 = 成功, -1 = 失败
+func NeteaseDestroySession(sessionC C.longlong) C.int {
+	handle := int64(sessionC)
+
+	sessionsMutex.Lock()
+	s, exists := activeSessions[handle]
+	if exists && s.isDefault {
+		sessionsMutex.Unlock()
+		setError(ErrInvalidArgument, "Cannot destroy the default session")
+		return -1
+	}
+	delete(activeSessions, handle)
+	sessionsMutex.Unlock()
+
+	if !exists {
+		setError(ErrNotFound, "Session not found")
+		return -1
+	}
+
+	s.mutex.Lock()
+	s.closed = true
+	s.qrState = nil
+	s.mutex.Unlock()
+
+	// 释放仍然引用该会话的流、预取、下载任务和缓存
+	s.closeStreams()
+	closeSessionMixerStreams(s)
+	cancelSessionPrefetches(s)
+	detachDownloadSession(s)
+	if audioCacheManager != nil {
+		audioCacheManager.rebindSession(s, getDefaultSession())
+	}
+	return 0
+}